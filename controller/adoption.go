@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/zalando-incubator/stackset-controller/pkg/core"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AdoptResources adopts the existing Deployment and Service named by the
+// adoption annotations as the initial stack of the version requested by the
+// adopt-stack annotation. The pods of the Deployment are labeled with the
+// selector labels of the stack, so they keep being selected by the Service
+// once its selector is updated. An adoption which failed after the stack was
+// created is resumed with the existing stack. In dry-run mode the adoption is
+// only reported via an event.
+func (c *StackSetController) AdoptResources(ctx context.Context, ssc *core.StackSetContainer) error {
+	version, ok := ssc.AdoptionVersion()
+	if !ok {
+		return nil
+	}
+
+	namespace := ssc.StackSet.Namespace
+	deploymentName, serviceName := ssc.AdoptedResourceNames(version)
+
+	deployment, err := c.client.AppsV1().Deployments(namespace).Get(ctx, deploymentName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	service, err := c.client.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		service = nil
+	} else if err != nil {
+		return err
+	}
+
+	sc, err := ssc.ResumeAdoption(version, deployment, service)
+	if err != nil {
+		return err
+	}
+	resumed := sc != nil
+	if !resumed {
+		sc, err = ssc.NewAdoptedStack(version, deployment, service)
+		if err != nil {
+			return err
+		}
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	pods, err := c.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+
+	adopted := "Deployment " + deployment.Name
+	if sc.OwnsAdoptedService(service) {
+		adopted += " and Service " + service.Name
+	}
+
+	if ssc.AdoptionDryRun() {
+		c.recorder.Eventf(
+			ssc.StackSet,
+			v1.EventTypeNormal,
+			"AdoptionDryRun",
+			"Would adopt %s as stack %s and label %d pods",
+			adopted,
+			sc.Name(),
+			len(pods.Items))
+		return nil
+	}
+
+	if !resumed {
+		created, err := c.client.ZalandoV1().Stacks(namespace).Create(ctx, sc.Stack, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		fixupStackTypeMeta(created)
+		sc = &core.StackContainer{Stack: created}
+	}
+
+	for _, pod := range pods.Items {
+		updated := pod.DeepCopy()
+		sc.AdoptObjectMeta(&updated.ObjectMeta, false)
+		_, err := c.client.CoreV1().Pods(namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	adoptedDeployment := deployment.DeepCopy()
+	sc.AdoptObjectMeta(&adoptedDeployment.ObjectMeta, true)
+	adoptedDeployment, err = c.client.AppsV1().Deployments(namespace).Update(ctx, adoptedDeployment, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	sc.Resources.Deployment = adoptedDeployment
+
+	if sc.OwnsAdoptedService(service) {
+		adoptedService := service.DeepCopy()
+		sc.AdoptObjectMeta(&adoptedService.ObjectMeta, true)
+		adoptedService, err = c.client.CoreV1().Services(namespace).Update(ctx, adoptedService, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		sc.Resources.Service = adoptedService
+	}
+
+	c.recorder.Eventf(
+		ssc.StackSet,
+		v1.EventTypeNormal,
+		"AdoptedResources",
+		"Adopted %s as stack %s",
+		adopted,
+		sc.Name())
+
+	// Persist ObservedStackVersion in the status before the annotations are
+	// removed, so a failed update is retried by resuming the adoption
+	status := ssc.StackSet.DeepCopy()
+	status.Status.ObservedStackVersion = version
+	updated, err := c.client.ZalandoV1().StackSets(namespace).UpdateStatus(ctx, status, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	fixupStackSetTypeMeta(updated)
+	ssc.StackSet = updated
+
+	// Remove the annotations and send the traffic to the adopted stack
+	result, err := c.client.ZalandoV1().StackSets(namespace).Update(ctx, ssc.GenerateAdoptedStackSet(sc.Name()), metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	fixupStackSetTypeMeta(result)
+	ssc.StackSet = result
+
+	ssc.StackContainers[sc.Stack.UID] = sc
+	return nil
+}
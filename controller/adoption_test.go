@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"github.com/zalando-incubator/stackset-controller/pkg/core"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAdoptResources(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		dryRun       bool
+		resourceName string
+		resume       bool
+	}{
+		{
+			name: "resources are adopted",
+		},
+		{
+			name:   "adoption is only reported in dry-run mode",
+			dryRun: true,
+		},
+		{
+			name:         "resources with other names are adopted",
+			resourceName: "legacy-app",
+		},
+		{
+			name:   "adoption is resumed with the stack created before",
+			resume: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			stackset := testStackset("foo", "default", "123")
+			stackset.Annotations = map[string]string{core.AdoptStackAnnotationKey: "v1"}
+			if tc.dryRun {
+				stackset.Annotations[core.AdoptDryRunAnnotationKey] = "true"
+			}
+			resourceName := "foo-v1"
+			if tc.resourceName != "" {
+				resourceName = tc.resourceName
+				stackset.Annotations[core.AdoptDeploymentAnnotationKey] = resourceName
+				stackset.Annotations[core.AdoptServiceAnnotationKey] = resourceName
+			}
+			stackset.Spec.Ingress = &zv1.StackSetIngressSpec{}
+
+			appLabels := map[string]string{"application": "foo"}
+			deployment := apps.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: stackset.Namespace,
+				},
+				Spec: apps.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: appLabels},
+					Template: v1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: appLabels},
+					},
+				},
+			}
+			service := v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: stackset.Namespace,
+				},
+				Spec: v1.ServiceSpec{
+					Selector: appLabels,
+				},
+			}
+			pod := v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo-v1-abc",
+					Namespace: stackset.Namespace,
+					Labels:    appLabels,
+				},
+			}
+
+			err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+			require.NoError(t, err)
+			err = env.CreateDeployments(context.Background(), []apps.Deployment{deployment})
+			require.NoError(t, err)
+			err = env.CreateServices(context.Background(), []v1.Service{service})
+			require.NoError(t, err)
+			_, err = env.client.CoreV1().Pods(pod.Namespace).Create(context.Background(), &pod, metav1.CreateOptions{})
+			require.NoError(t, err)
+
+			container := core.NewContainer(&stackset, &core.SimpleTrafficReconciler{}, "", nil)
+			if tc.resume {
+				// The previous adoption created the stack, but failed to
+				// update the StackSet
+				stack := *baseTestStack.DeepCopy()
+				stack.Namespace = stackset.Namespace
+				stack.Labels = map[string]string{
+					core.StacksetHeritageLabelKey: "foo",
+					core.StackVersionLabelKey:     "v1",
+				}
+				err = env.CreateStacks(context.Background(), []zv1.Stack{stack})
+				require.NoError(t, err)
+				container.StackContainers[stack.UID] = &core.StackContainer{Stack: &stack}
+			}
+			err = env.controller.AdoptResources(context.Background(), container)
+			require.NoError(t, err)
+
+			stack, err := env.client.ZalandoV1().Stacks(stackset.Namespace).Get(context.Background(), "foo-v1", metav1.GetOptions{})
+			if tc.dryRun {
+				require.True(t, errors.IsNotFound(err))
+				require.Empty(t, container.StackContainers)
+				return
+			}
+			require.NoError(t, err)
+
+			adoptedPod, err := env.client.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{
+				"application":                 "foo",
+				core.StacksetHeritageLabelKey: "foo",
+				core.StackVersionLabelKey:     "v1",
+			}, adoptedPod.Labels)
+
+			adoptedDeployment, err := env.client.AppsV1().Deployments(stackset.Namespace).Get(context.Background(), deployment.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{
+				core.StacksetHeritageLabelKey: "foo",
+				core.StackVersionLabelKey:     "v1",
+			}, adoptedDeployment.Labels)
+			require.Equal(t, stack.Name, adoptedDeployment.OwnerReferences[0].Name)
+
+			adoptedService, err := env.client.CoreV1().Services(stackset.Namespace).Get(context.Background(), service.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			if tc.resourceName != "" {
+				// A Service with another name is left in place
+				require.Empty(t, adoptedService.OwnerReferences)
+				adoptedService = nil
+			} else {
+				require.Equal(t, stack.Name, adoptedService.OwnerReferences[0].Name)
+			}
+
+			updated, err := env.client.ZalandoV1().StackSets(stackset.Namespace).Get(context.Background(), stackset.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Empty(t, updated.Annotations)
+			require.Equal(t, []*zv1.DesiredTraffic{{StackName: "foo-v1", Weight: 100}}, updated.Spec.Traffic)
+			require.Equal(t, "v1", updated.Status.ObservedStackVersion)
+
+			require.Len(t, container.StackContainers, 1)
+			sc := container.StackContainers[stack.UID]
+			require.Equal(t, adoptedDeployment, sc.Resources.Deployment)
+			require.Equal(t, adoptedService, sc.Resources.Service)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zalando-incubator/stackset-controller/pkg/core"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// readinessCheckResult is the cached result of a readiness check.
+type readinessCheckResult struct {
+	url        string
+	generation int64
+	succeeded  bool
+	message    string
+	expires    time.Time
+}
+
+// readinessChecker performs the HTTP readiness checks of the stacks and
+// caches their results per stack.
+type readinessChecker struct {
+	client  *http.Client
+	now     func() time.Time
+	results map[types.UID]readinessCheckResult
+	sync.Mutex
+}
+
+func newReadinessChecker() *readinessChecker {
+	return &readinessChecker{
+		client:  &http.Client{},
+		now:     time.Now,
+		results: make(map[types.UID]readinessCheckResult),
+	}
+}
+
+// Check returns the result of the readiness check of a stack. The check is
+// only performed if there's no cached result for the same request and
+// stack generation.
+func (r *readinessChecker) Check(ctx context.Context, uid types.UID, generation int64, request *core.ReadinessCheckRequest) (bool, string) {
+	now := r.now()
+
+	r.Lock()
+	cached, ok := r.results[uid]
+	r.Unlock()
+	if ok && cached.url == request.URL && cached.generation == generation && now.Before(cached.expires) {
+		return cached.succeeded, cached.message
+	}
+
+	succeeded, message := r.check(ctx, request)
+
+	r.Lock()
+	defer r.Unlock()
+	// drop the results of stacks which are no longer checked
+	for key, result := range r.results {
+		if !now.Before(result.expires) {
+			delete(r.results, key)
+		}
+	}
+	r.results[uid] = readinessCheckResult{
+		url:        request.URL,
+		generation: generation,
+		succeeded:  succeeded,
+		message:    message,
+		expires:    now.Add(request.Period),
+	}
+	return succeeded, message
+}
+
+func (r *readinessChecker) check(ctx context.Context, request *core.ReadinessCheckRequest) (bool, string) {
+	ctx, cancel := context.WithTimeout(ctx, request.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, request.URL, nil)
+	if err != nil {
+		return false, fmt.Sprintf("GET %s failed: %v", request.URL, err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, fmt.Sprintf("GET %s failed: %v", request.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != request.ExpectedStatusCode {
+		return false, fmt.Sprintf("GET %s returned status %d, expected %d", request.URL, resp.StatusCode, request.ExpectedStatusCode)
+	}
+	return true, fmt.Sprintf("GET %s returned status %d", request.URL, resp.StatusCode)
+}
+
+// reconcileReadinessChecks performs the readiness checks of the stacks whose
+// traffic should be increased and records the results in the stacks.
+func (c *StackSetController) reconcileReadinessChecks(ctx context.Context, ssc *core.StackSetContainer) {
+	for _, sc := range ssc.StackContainers {
+		if !sc.ReadinessCheckRequired() {
+			continue
+		}
+
+		var succeeded bool
+		var message string
+		request, err := sc.ReadinessCheckRequest()
+		if err != nil {
+			message = fmt.Sprintf("invalid readiness check: %v", err)
+		} else {
+			succeeded, message = c.readinessChecker.Check(ctx, sc.Stack.UID, sc.Stack.Generation, request)
+		}
+
+		if !succeeded {
+			c.stackLogger(ssc, sc).Infof("Readiness check failed: %s", message)
+		}
+		sc.SetReadinessCheckResult(succeeded, message)
+	}
+}
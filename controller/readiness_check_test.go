@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/stackset-controller/pkg/core"
+)
+
+func TestReadinessCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		statusCode         int
+		expectedStatusCode int
+		expected           bool
+	}{
+		{
+			name:               "expected status code",
+			statusCode:         http.StatusOK,
+			expectedStatusCode: http.StatusOK,
+			expected:           true,
+		},
+		{
+			name:               "custom expected status code",
+			statusCode:         http.StatusNoContent,
+			expectedStatusCode: http.StatusNoContent,
+			expected:           true,
+		},
+		{
+			name:               "unexpected status code",
+			statusCode:         http.StatusServiceUnavailable,
+			expectedStatusCode: http.StatusOK,
+			expected:           false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/health", r.URL.Path)
+				w.WriteHeader(tc.statusCode)
+			}))
+			defer server.Close()
+
+			checker := newReadinessChecker()
+			succeeded, message := checker.Check(context.Background(), "123", 1, &core.ReadinessCheckRequest{
+				URL:                server.URL + "/health",
+				ExpectedStatusCode: tc.expectedStatusCode,
+				Timeout:            time.Second,
+				Period:             time.Minute,
+			})
+			require.Equal(t, tc.expected, succeeded, message)
+		})
+	}
+}
+
+func TestReadinessCheckUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	checker := newReadinessChecker()
+	succeeded, _ := checker.Check(context.Background(), "123", 1, &core.ReadinessCheckRequest{
+		URL:                url,
+		ExpectedStatusCode: http.StatusOK,
+		Timeout:            time.Second,
+		Period:             time.Minute,
+	})
+	require.False(t, succeeded)
+}
+
+func TestReadinessCheckCache(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	checker := newReadinessChecker()
+	checker.now = func() time.Time {
+		return now
+	}
+
+	request := &core.ReadinessCheckRequest{
+		URL:                server.URL,
+		ExpectedStatusCode: http.StatusOK,
+		Timeout:            time.Second,
+		Period:             time.Minute,
+	}
+
+	check := func(generation int64) {
+		succeeded, message := checker.Check(context.Background(), "123", generation, request)
+		require.True(t, succeeded, message)
+	}
+
+	check(1)
+	require.EqualValues(t, 1, atomic.LoadInt32(&requests))
+
+	// result is cached
+	now = now.Add(30 * time.Second)
+	check(1)
+	require.EqualValues(t, 1, atomic.LoadInt32(&requests))
+
+	// stack changed
+	check(2)
+	require.EqualValues(t, 2, atomic.LoadInt32(&requests))
+
+	// result expired
+	now = now.Add(time.Minute)
+	check(2)
+	require.EqualValues(t, 3, atomic.LoadInt32(&requests))
+}
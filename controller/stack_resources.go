@@ -2,15 +2,21 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	"github.com/zalando-incubator/stackset-controller/pkg/core"
 	apps "k8s.io/api/apps/v1"
 	"k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func pint32Equal(p1, p2 *int32) bool {
@@ -66,7 +72,7 @@ func (c *StackSetController) ReconcileStackDeployment(ctx context.Context, stack
 		apiv1.EventTypeNormal,
 		"UpdatedDeployment",
 		"Updated Deployment %s",
-		deployment.Name)
+		updated.Name)
 	return nil
 }
 
@@ -108,8 +114,11 @@ func (c *StackSetController) ReconcileStackHPA(ctx context.Context, stack *zv1.S
 		return nil
 	}
 
-	// Check if we need to update the HPA
-	if core.IsResourceUpToDate(stack, existing.ObjectMeta) && pint32Equal(existing.Spec.MinReplicas, hpa.Spec.MinReplicas) {
+	// Check if we need to update the HPA. The replicas change without a new
+	// stack generation, e.g. for prescaling or gradual scale-down.
+	if core.IsResourceUpToDate(stack, existing.ObjectMeta) &&
+		pint32Equal(existing.Spec.MinReplicas, hpa.Spec.MinReplicas) &&
+		existing.Spec.MaxReplicas == hpa.Spec.MaxReplicas {
 		return nil
 	}
 
@@ -130,6 +139,305 @@ func (c *StackSetController) ReconcileStackHPA(ctx context.Context, stack *zv1.S
 	return nil
 }
 
+// ReconcileStackPDB creates, updates and deletes the PodDisruptionBudget of
+// a stack.
+func (c *StackSetController) ReconcileStackPDB(ctx context.Context, stack *zv1.Stack, existing *policyv1.PodDisruptionBudget, generateUpdated func() (*policyv1.PodDisruptionBudget, error)) error {
+	pdb, err := generateUpdated()
+	if err != nil {
+		return err
+	}
+
+	// PDB removed
+	if pdb == nil {
+		if existing != nil {
+			err := c.client.PolicyV1().PodDisruptionBudgets(existing.Namespace).Delete(ctx, existing.Name, metav1.DeleteOptions{})
+			if err != nil {
+				return err
+			}
+			c.recorder.Eventf(
+				stack,
+				apiv1.EventTypeNormal,
+				"DeletedPDB",
+				"Deleted PodDisruptionBudget %s",
+				existing.Name)
+		}
+		return nil
+	}
+
+	// Create new PDB
+	if existing == nil {
+		_, err := c.client.PolicyV1().PodDisruptionBudgets(pdb.Namespace).Create(ctx, pdb, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		c.recorder.Eventf(
+			stack,
+			apiv1.EventTypeNormal,
+			"CreatedPDB",
+			"Created PodDisruptionBudget %s",
+			pdb.Name)
+		return nil
+	}
+
+	// Check if we need to update the PDB
+	if core.IsResourceUpToDate(stack, existing.ObjectMeta) {
+		return nil
+	}
+
+	updated := existing.DeepCopy()
+	syncObjectMeta(updated, pdb)
+	updated.Spec = pdb.Spec
+
+	_, err = c.client.PolicyV1().PodDisruptionBudgets(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		stack,
+		apiv1.EventTypeNormal,
+		"UpdatedPDB",
+		"Updated PodDisruptionBudget %s",
+		pdb.Name)
+	return nil
+}
+
+var (
+	podMonitorGVR = schema.GroupVersionResource{
+		Group:    "monitoring.coreos.com",
+		Version:  "v1",
+		Resource: "podmonitors",
+	}
+	serviceMonitorGVR = schema.GroupVersionResource{
+		Group:    "monitoring.coreos.com",
+		Version:  "v1",
+		Resource: "servicemonitors",
+	}
+	scaledObjectGVR = schema.GroupVersionResource{
+		Group:    "keda.sh",
+		Version:  "v1alpha1",
+		Resource: "scaledobjects",
+	}
+	vpaGVR = schema.GroupVersionResource{
+		Group:    "autoscaling.k8s.io",
+		Version:  "v1",
+		Resource: "verticalpodautoscalers",
+	}
+)
+
+// monitorGVR returns the resource of the PodMonitor or ServiceMonitor.
+func monitorGVR(monitor *unstructured.Unstructured) schema.GroupVersionResource {
+	if monitor.GetKind() == string(zv1.MonitorKindServiceMonitor) {
+		return serviceMonitorGVR
+	}
+	return podMonitorGVR
+}
+
+// ReconcileStackMonitor creates or updates the PodMonitor or ServiceMonitor
+// of the stack. Monitors which aren't generated anymore, e.g. because the
+// kind changed, are deleted. Since the monitor depends on the StackSet
+// rather than the stack, it's compared with the generated one instead of
+// relying on the stack generation.
+func (c *StackSetController) ReconcileStackMonitor(ctx context.Context, stack *zv1.Stack, existing []*unstructured.Unstructured, generateUpdated func() (*unstructured.Unstructured, error)) error {
+	monitor, err := generateUpdated()
+	if err != nil {
+		return err
+	}
+
+	var current *unstructured.Unstructured
+	for _, m := range existing {
+		if monitor != nil && m.GetKind() == monitor.GetKind() && m.GetName() == monitor.GetName() {
+			current = m
+			continue
+		}
+
+		err := c.client.Dynamic().Resource(monitorGVR(m)).Namespace(m.GetNamespace()).Delete(ctx, m.GetName(), metav1.DeleteOptions{})
+		if err != nil {
+			return err
+		}
+		c.recorder.Eventf(
+			stack,
+			apiv1.EventTypeNormal,
+			"DeletedMonitor",
+			"Deleted %s %s",
+			m.GetKind(),
+			m.GetName())
+	}
+
+	if monitor == nil {
+		return nil
+	}
+
+	// Create new monitor
+	if current == nil {
+		_, err := c.client.Dynamic().Resource(monitorGVR(monitor)).Namespace(monitor.GetNamespace()).Create(ctx, monitor, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		c.recorder.Eventf(
+			stack,
+			apiv1.EventTypeNormal,
+			"CreatedMonitor",
+			"Created %s %s",
+			monitor.GetKind(),
+			monitor.GetName())
+		return nil
+	}
+
+	// Check if we need to update the monitor
+	if equality.Semantic.DeepEqual(current.Object["spec"], monitor.Object["spec"]) &&
+		equality.Semantic.DeepEqual(current.GetLabels(), monitor.GetLabels()) &&
+		equality.Semantic.DeepEqual(current.GetAnnotations(), monitor.GetAnnotations()) {
+		return nil
+	}
+
+	updated := current.DeepCopy()
+	syncObjectMeta(updated, monitor)
+	updated.Object["spec"] = monitor.Object["spec"]
+
+	_, err = c.client.Dynamic().Resource(monitorGVR(updated)).Namespace(updated.GetNamespace()).Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		stack,
+		apiv1.EventTypeNormal,
+		"UpdatedMonitor",
+		"Updated %s %s",
+		monitor.GetKind(),
+		monitor.GetName())
+	return nil
+}
+
+// ReconcileStackScaledObject creates, updates or deletes the KEDA
+// ScaledObject of the stack. Since the replicas depend on the prescaling and
+// scale-down state, it's compared with the generated one instead of relying
+// on the stack generation.
+func (c *StackSetController) ReconcileStackScaledObject(ctx context.Context, stack *zv1.Stack, existing *unstructured.Unstructured, generateUpdated func() (*unstructured.Unstructured, error)) error {
+	scaledObject, err := generateUpdated()
+	if err != nil {
+		return err
+	}
+
+	// ScaledObject removed
+	if scaledObject == nil {
+		if existing != nil {
+			err := c.client.Dynamic().Resource(scaledObjectGVR).Namespace(existing.GetNamespace()).Delete(ctx, existing.GetName(), metav1.DeleteOptions{})
+			if err != nil {
+				return err
+			}
+			c.recorder.Eventf(
+				stack,
+				apiv1.EventTypeNormal,
+				"DeletedScaledObject",
+				"Deleted ScaledObject %s",
+				existing.GetName())
+		}
+		return nil
+	}
+
+	// Create new ScaledObject
+	if existing == nil {
+		_, err := c.client.Dynamic().Resource(scaledObjectGVR).Namespace(scaledObject.GetNamespace()).Create(ctx, scaledObject, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		c.recorder.Eventf(
+			stack,
+			apiv1.EventTypeNormal,
+			"CreatedScaledObject",
+			"Created ScaledObject %s",
+			scaledObject.GetName())
+		return nil
+	}
+
+	// Check if we need to update the ScaledObject
+	if equality.Semantic.DeepEqual(existing.Object["spec"], scaledObject.Object["spec"]) &&
+		equality.Semantic.DeepEqual(existing.GetLabels(), scaledObject.GetLabels()) &&
+		equality.Semantic.DeepEqual(existing.GetAnnotations(), scaledObject.GetAnnotations()) {
+		return nil
+	}
+
+	updated := existing.DeepCopy()
+	syncObjectMeta(updated, scaledObject)
+	updated.Object["spec"] = scaledObject.Object["spec"]
+
+	_, err = c.client.Dynamic().Resource(scaledObjectGVR).Namespace(updated.GetNamespace()).Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		stack,
+		apiv1.EventTypeNormal,
+		"UpdatedScaledObject",
+		"Updated ScaledObject %s",
+		scaledObject.GetName())
+	return nil
+}
+
+// ReconcileStackVPA creates, updates or deletes the VerticalPodAutoscaler of
+// the stack. If the generated VerticalPodAutoscaler contains a status, i.e.
+// the recommendation of the previous stack, it's set once after creation and
+// left to the VPA recommender afterwards.
+func (c *StackSetController) ReconcileStackVPA(ctx context.Context, stack *zv1.Stack, existing *unstructured.Unstructured, generateUpdated func() (*unstructured.Unstructured, error)) error {
+	vpa, err := generateUpdated()
+	if err != nil {
+		return err
+	}
+
+	// VPA removed
+	if vpa == nil {
+		if existing != nil {
+			err := c.client.Dynamic().Resource(vpaGVR).Namespace(existing.GetNamespace()).Delete(ctx, existing.GetName(), metav1.DeleteOptions{})
+			if err != nil {
+				return err
+			}
+			c.recorder.Eventf(
+				stack,
+				apiv1.EventTypeNormal,
+				"DeletedVPA",
+				"Deleted VerticalPodAutoscaler %s",
+				existing.GetName())
+		}
+		return nil
+	}
+
+	// Create new VPA
+	if existing == nil {
+		_, err := c.client.Dynamic().Resource(vpaGVR).Namespace(vpa.GetNamespace()).Create(ctx, vpa, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		c.recorder.Eventf(
+			stack,
+			apiv1.EventTypeNormal,
+			"CreatedVPA",
+			"Created VerticalPodAutoscaler %s",
+			vpa.GetName())
+		return nil
+	}
+
+	// Check if we need to update the VPA
+	if core.IsResourceUpToDate(stack, metav1.ObjectMeta{Annotations: existing.GetAnnotations()}) {
+		return nil
+	}
+
+	updated := existing.DeepCopy()
+	syncObjectMeta(updated, vpa)
+	updated.Object["spec"] = vpa.Object["spec"]
+
+	_, err = c.client.Dynamic().Resource(vpaGVR).Namespace(updated.GetNamespace()).Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		stack,
+		apiv1.EventTypeNormal,
+		"UpdatedVPA",
+		"Updated VerticalPodAutoscaler %s",
+		vpa.GetName())
+	return nil
+}
+
 func (c *StackSetController) ReconcileStackService(ctx context.Context, stack *zv1.Stack, existing *apiv1.Service, generateUpdated func() (*apiv1.Service, error)) error {
 	service, err := generateUpdated()
 	if err != nil {
@@ -293,3 +601,190 @@ func (c *StackSetController) ReconcileStackRouteGroup(ctx context.Context, stack
 		routegroup.Name)
 	return nil
 }
+
+// ReconcileStackJob creates the Job of a hook. Jobs are never updated, they're
+// cleaned up together with the stack. A failed Job is only deleted if the hook
+// should be retried, it's created again in the next reconciliation.
+func (c *StackSetController) ReconcileStackJob(ctx context.Context, stack *zv1.Stack, existing *batchv1.Job, retry bool, generateUpdated func() (*batchv1.Job, error)) error {
+	if existing != nil {
+		if !retry {
+			return nil
+		}
+
+		propagationPolicy := metav1.DeletePropagationBackground
+		err := c.client.BatchV1().Jobs(existing.Namespace).Delete(ctx, existing.Name, metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+		if err != nil {
+			return err
+		}
+		c.recorder.Eventf(
+			stack,
+			apiv1.EventTypeNormal,
+			"DeletedJob",
+			"Deleted failed Job %s to retry the hook",
+			existing.Name)
+		return nil
+	}
+
+	job, err := generateUpdated()
+	if err != nil {
+		return err
+	}
+
+	if job == nil {
+		return nil
+	}
+
+	_, err = c.client.BatchV1().Jobs(job.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		stack,
+		apiv1.EventTypeNormal,
+		"CreatedJob",
+		"Created Job %s",
+		job.Name)
+	return nil
+}
+
+// ReconcileStackConfigMaps creates, updates and deletes the stack's copies
+// of the ConfigMaps defined in the stack spec.
+func (c *StackSetController) ReconcileStackConfigMaps(ctx context.Context, stack *zv1.Stack, existing []*apiv1.ConfigMap, generateUpdated func() []*apiv1.ConfigMap) error {
+	configMaps := generateUpdated()
+
+	existingByName := make(map[string]*apiv1.ConfigMap, len(existing))
+	for _, configMap := range existing {
+		existingByName[configMap.Name] = configMap
+	}
+
+	for _, configMap := range configMaps {
+		current, ok := existingByName[configMap.Name]
+		delete(existingByName, configMap.Name)
+
+		// Create new ConfigMap
+		if !ok {
+			_, err := c.client.CoreV1().ConfigMaps(configMap.Namespace).Create(ctx, configMap, metav1.CreateOptions{})
+			if err != nil {
+				return err
+			}
+			c.recorder.Eventf(
+				stack,
+				apiv1.EventTypeNormal,
+				"CreatedConfigMap",
+				"Created ConfigMap %s",
+				configMap.Name)
+			continue
+		}
+
+		// Check if we need to update the ConfigMap
+		if core.IsResourceUpToDate(stack, current.ObjectMeta) {
+			continue
+		}
+
+		updated := current.DeepCopy()
+		syncObjectMeta(updated, configMap)
+		updated.Data = configMap.Data
+		updated.BinaryData = configMap.BinaryData
+
+		_, err := c.client.CoreV1().ConfigMaps(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		c.recorder.Eventf(
+			stack,
+			apiv1.EventTypeNormal,
+			"UpdatedConfigMap",
+			"Updated ConfigMap %s",
+			configMap.Name)
+	}
+
+	// ConfigMaps removed from the stack spec
+	for _, configMap := range existingByName {
+		err := c.client.CoreV1().ConfigMaps(configMap.Namespace).Delete(ctx, configMap.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return err
+		}
+		c.recorder.Eventf(
+			stack,
+			apiv1.EventTypeNormal,
+			"DeletedConfigMap",
+			"Deleted ConfigMap %s",
+			configMap.Name)
+	}
+	return nil
+}
+
+// ReconcileStackSecrets creates, updates and deletes the stack's copies of
+// the Secrets referenced in the stack spec. The data of a copy is taken from
+// the referenced Secret when the copy is created and never updated
+// afterwards.
+func (c *StackSetController) ReconcileStackSecrets(ctx context.Context, stack *zv1.Stack, existing []*apiv1.Secret, generateUpdated func() []*apiv1.Secret) error {
+	secrets := generateUpdated()
+
+	existingByName := make(map[string]*apiv1.Secret, len(existing))
+	for _, secret := range existing {
+		existingByName[secret.Name] = secret
+	}
+
+	for _, secret := range secrets {
+		current, ok := existingByName[secret.Name]
+		delete(existingByName, secret.Name)
+
+		// Create new Secret
+		if !ok {
+			sourceName := secret.Annotations[core.SecretSourceAnnotationKey]
+			source, err := c.client.CoreV1().Secrets(secret.Namespace).Get(ctx, sourceName, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to get Secret %s: %v", sourceName, err)
+			}
+			core.CopySecretData(secret, source)
+
+			_, err = c.client.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+			if err != nil {
+				return err
+			}
+			c.recorder.Eventf(
+				stack,
+				apiv1.EventTypeNormal,
+				"CreatedSecret",
+				"Created Secret %s from %s",
+				secret.Name,
+				sourceName)
+			continue
+		}
+
+		// Check if we need to update the Secret
+		if core.IsResourceUpToDate(stack, current.ObjectMeta) {
+			continue
+		}
+
+		updated := current.DeepCopy()
+		syncObjectMeta(updated, secret)
+
+		_, err := c.client.CoreV1().Secrets(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		c.recorder.Eventf(
+			stack,
+			apiv1.EventTypeNormal,
+			"UpdatedSecret",
+			"Updated Secret %s",
+			secret.Name)
+	}
+
+	// Secrets removed from the stack spec
+	for _, secret := range existingByName {
+		err := c.client.CoreV1().Secrets(secret.Namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return err
+		}
+		c.recorder.Eventf(
+			stack,
+			apiv1.EventTypeNormal,
+			"DeletedSecret",
+			"Deleted Secret %s",
+			secret.Name)
+	}
+	return nil
+}
@@ -3,17 +3,23 @@ package controller
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"github.com/zalando-incubator/stackset-controller/pkg/core"
 	apps "k8s.io/api/apps/v1"
 	autoscaling "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -579,6 +585,55 @@ func TestReconcileStackHPA(t *testing.T) {
 	}
 }
 
+func TestReconcileStackHPAGradualScaledown(t *testing.T) {
+	env := NewTestEnvironment()
+
+	minReplicas := int32(1)
+	utilization := int32(80)
+	stackset := testStackSet.DeepCopy()
+	stackset.Spec.StackLifecycle.GradualScaledown = &zv1.GradualScaledown{IntervalSeconds: 60}
+
+	stack := baseTestStack.DeepCopy()
+	stack.Spec.Autoscaler = &zv1.Autoscaler{
+		MinReplicas: &minReplicas,
+		MaxReplicas: 20,
+		Metrics: []zv1.AutoscalerMetrics{
+			{Type: zv1.CPUAutoscalerMetric, AverageUtilization: &utilization},
+		},
+	}
+	stack.Status.LastTrafficReplicas = 16
+
+	ssc := core.NewContainer(stackset, &core.SimpleTrafficReconciler{}, "", nil)
+	sc := &core.StackContainer{Stack: stack}
+	ssc.StackContainers[stack.UID] = sc
+
+	reconcile := func(noTrafficSince time.Duration) *autoscaling.HorizontalPodAutoscaler {
+		stack.Status.NoTrafficSince = &metav1.Time{Time: time.Now().Add(-noTrafficSince)}
+		require.NoError(t, ssc.UpdateFromResources())
+
+		err := env.controller.ReconcileStackHPA(context.Background(), stack, sc.Resources.HPA, sc.GenerateHPA)
+		require.NoError(t, err)
+
+		hpa, err := env.client.AutoscalingV2().HorizontalPodAutoscalers(stack.Namespace).Get(context.Background(), stack.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		sc.Resources.HPA = hpa
+		return hpa
+	}
+
+	// The stack just lost its traffic
+	hpa := reconcile(0)
+	require.EqualValues(t, 16, hpa.Spec.MaxReplicas)
+
+	// The maximum is lowered in every step, while the minimum stays below
+	hpa = reconcile(61 * time.Second)
+	require.EqualValues(t, 8, hpa.Spec.MaxReplicas)
+	require.EqualValues(t, 1, *hpa.Spec.MinReplicas)
+
+	hpa = reconcile(121 * time.Second)
+	require.EqualValues(t, 4, hpa.Spec.MaxReplicas)
+	require.EqualValues(t, 1, *hpa.Spec.MinReplicas)
+}
+
 func TestReconcileStackIngress(t *testing.T) {
 	exampleRules := []networking.IngressRule{
 		{
@@ -887,3 +942,599 @@ func TestReconcileStackRouteGroup(t *testing.T) {
 		})
 	}
 }
+
+func TestReconcileStackJob(t *testing.T) {
+	jobMeta := stackOwned(baseTestStack)
+	jobMeta.Name = "foo-v1-pre-traffic"
+
+	exampleBackoffLimit := int32(1)
+	exampleUpdatedBackoffLimit := int32(5)
+
+	for _, tc := range []struct {
+		name     string
+		existing *batchv1.Job
+		retry    bool
+		updated  *batchv1.Job
+		expected *batchv1.Job
+	}{
+		{
+			name: "job is created if it doesn't exist",
+			updated: &batchv1.Job{
+				ObjectMeta: jobMeta,
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &exampleBackoffLimit,
+				},
+			},
+			expected: &batchv1.Job{
+				ObjectMeta: jobMeta,
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &exampleBackoffLimit,
+				},
+			},
+		},
+		{
+			name:     "job is not created if it's not needed",
+			updated:  nil,
+			expected: nil,
+		},
+		{
+			name: "existing job is not updated",
+			existing: &batchv1.Job{
+				ObjectMeta: jobMeta,
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &exampleBackoffLimit,
+				},
+			},
+			updated: &batchv1.Job{
+				ObjectMeta: jobMeta,
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &exampleUpdatedBackoffLimit,
+				},
+			},
+			expected: &batchv1.Job{
+				ObjectMeta: jobMeta,
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &exampleBackoffLimit,
+				},
+			},
+		},
+		{
+			name: "existing job is not removed",
+			existing: &batchv1.Job{
+				ObjectMeta: jobMeta,
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &exampleBackoffLimit,
+				},
+			},
+			updated: nil,
+			expected: &batchv1.Job{
+				ObjectMeta: jobMeta,
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &exampleBackoffLimit,
+				},
+			},
+		},
+		{
+			name: "existing job is removed to retry the hook",
+			existing: &batchv1.Job{
+				ObjectMeta: jobMeta,
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &exampleBackoffLimit,
+				},
+			},
+			retry: true,
+			updated: &batchv1.Job{
+				ObjectMeta: jobMeta,
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &exampleUpdatedBackoffLimit,
+				},
+			},
+			expected: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+			stack := baseTestStack
+
+			err := env.CreateStacksets(context.Background(), []zv1.StackSet{testStackSet})
+			require.NoError(t, err)
+
+			err = env.CreateStacks(context.Background(), []zv1.Stack{stack})
+			require.NoError(t, err)
+
+			if tc.existing != nil {
+				err = env.CreateJobs(context.Background(), []batchv1.Job{*tc.existing})
+				require.NoError(t, err)
+			}
+
+			err = env.controller.ReconcileStackJob(context.Background(), &stack, tc.existing, tc.retry, func() (*batchv1.Job, error) {
+				return tc.updated, nil
+			})
+			require.NoError(t, err)
+
+			updated, err := env.client.BatchV1().Jobs(stack.Namespace).Get(context.Background(), jobMeta.Name, metav1.GetOptions{})
+			if tc.expected != nil {
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, updated)
+			} else {
+				require.True(t, errors.IsNotFound(err))
+			}
+		})
+	}
+}
+
+func TestReconcileStackConfigMaps(t *testing.T) {
+	configMap := func(name string, owned metav1.ObjectMeta, data string) *v1.ConfigMap {
+		objectMeta := *owned.DeepCopy()
+		objectMeta.Name = name
+		return &v1.ConfigMap{
+			ObjectMeta: objectMeta,
+			Data:       map[string]string{"key": data},
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		existing []*v1.ConfigMap
+		updated  []*v1.ConfigMap
+		expected []v1.ConfigMap
+	}{
+		{
+			name:     "configmap is created if it doesn't exist",
+			updated:  []*v1.ConfigMap{configMap("foo-v1-config", baseTestStackOwned, "value")},
+			expected: []v1.ConfigMap{*configMap("foo-v1-config", baseTestStackOwned, "value")},
+		},
+		{
+			name:     "configmap is not updated if the stack didn't change",
+			existing: []*v1.ConfigMap{configMap("foo-v1-config", updatedTestStackOwned, "value")},
+			updated:  []*v1.ConfigMap{configMap("foo-v1-config", updatedTestStackOwned, "updated")},
+			expected: []v1.ConfigMap{*configMap("foo-v1-config", updatedTestStackOwned, "value")},
+		},
+		{
+			name:     "configmap is updated if the stack changed",
+			existing: []*v1.ConfigMap{configMap("foo-v1-config", baseTestStackOwned, "value")},
+			updated:  []*v1.ConfigMap{configMap("foo-v1-config", updatedTestStackOwned, "updated")},
+			expected: []v1.ConfigMap{*configMap("foo-v1-config", updatedTestStackOwned, "updated")},
+		},
+		{
+			name:     "configmap is deleted if it's no longer defined",
+			existing: []*v1.ConfigMap{configMap("foo-v1-config", updatedTestStackOwned, "value")},
+			updated:  nil,
+			expected: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+			stack := updatedTestStack
+
+			for _, configMap := range tc.existing {
+				_, err := env.client.CoreV1().ConfigMaps(stack.Namespace).Create(context.Background(), configMap, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			err := env.controller.ReconcileStackConfigMaps(context.Background(), &stack, tc.existing, func() []*v1.ConfigMap {
+				return tc.updated
+			})
+			require.NoError(t, err)
+
+			result, err := env.client.CoreV1().ConfigMaps(stack.Namespace).List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, result.Items)
+		})
+	}
+}
+
+func TestReconcileStackSecrets(t *testing.T) {
+	source := func(data string) *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "credentials",
+				Namespace: baseTestStack.Namespace,
+			},
+			Type: v1.SecretTypeOpaque,
+			Data: map[string][]byte{"password": []byte(data)},
+		}
+	}
+	secret := func(owned metav1.ObjectMeta, data string) *v1.Secret {
+		objectMeta := *owned.DeepCopy()
+		objectMeta.Name = "foo-v1-credentials"
+		objectMeta.Annotations = map[string]string{core.SecretSourceAnnotationKey: "credentials"}
+		result := &v1.Secret{ObjectMeta: objectMeta}
+		if data != "" {
+			result.Type = v1.SecretTypeOpaque
+			result.Data = map[string][]byte{"password": []byte(data)}
+		}
+		return result
+	}
+
+	for _, tc := range []struct {
+		name          string
+		source        *v1.Secret
+		existing      []*v1.Secret
+		updated       []*v1.Secret
+		expected      []*v1.Secret
+		expectedError string
+	}{
+		{
+			name:     "secret is copied if it doesn't exist",
+			source:   source("value"),
+			updated:  []*v1.Secret{secret(baseTestStackOwned, "")},
+			expected: []*v1.Secret{secret(baseTestStackOwned, "value")},
+		},
+		{
+			name:          "secret can't be copied without the source",
+			updated:       []*v1.Secret{secret(baseTestStackOwned, "")},
+			expectedError: `failed to get Secret credentials: secrets "credentials" not found`,
+		},
+		{
+			name:     "secret isn't updated if the source changed",
+			source:   source("updated"),
+			existing: []*v1.Secret{secret(baseTestStackOwned, "value")},
+			updated:  []*v1.Secret{secret(updatedTestStackOwned, "")},
+			expected: []*v1.Secret{secret(updatedTestStackOwned, "value")},
+		},
+		{
+			name:     "secret is deleted if it's no longer referenced",
+			existing: []*v1.Secret{secret(updatedTestStackOwned, "value")},
+			updated:  nil,
+			expected: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+			stack := updatedTestStack
+
+			if tc.source != nil {
+				_, err := env.client.CoreV1().Secrets(stack.Namespace).Create(context.Background(), tc.source, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+			for _, secret := range tc.existing {
+				_, err := env.client.CoreV1().Secrets(stack.Namespace).Create(context.Background(), secret, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			err := env.controller.ReconcileStackSecrets(context.Background(), &stack, tc.existing, func() []*v1.Secret {
+				return tc.updated
+			})
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+
+			result, err := env.client.CoreV1().Secrets(stack.Namespace).List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			var secrets []*v1.Secret
+			for i := range result.Items {
+				if result.Items[i].Name != "credentials" {
+					secrets = append(secrets, &result.Items[i])
+				}
+			}
+			require.Equal(t, tc.expected, secrets)
+		})
+	}
+}
+
+func TestReconcileStackPDB(t *testing.T) {
+	maxUnavailable := intstr.FromInt(1)
+	updatedMaxUnavailable := intstr.FromInt(2)
+
+	for _, tc := range []struct {
+		name     string
+		stack    zv1.Stack
+		existing *policyv1.PodDisruptionBudget
+		updated  *policyv1.PodDisruptionBudget
+		expected *policyv1.PodDisruptionBudget
+	}{
+		{
+			name:  "PDB is created if it doesn't exist",
+			stack: baseTestStack,
+			updated: &policyv1.PodDisruptionBudget{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       policyv1.PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable},
+			},
+			expected: &policyv1.PodDisruptionBudget{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       policyv1.PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable},
+			},
+		},
+		{
+			name:  "PDB is removed if it's no longer needed",
+			stack: baseTestStack,
+			existing: &policyv1.PodDisruptionBudget{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       policyv1.PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable},
+			},
+			updated:  nil,
+			expected: nil,
+		},
+		{
+			name:  "PDB is not updated if the stack didn't change",
+			stack: baseTestStack,
+			existing: &policyv1.PodDisruptionBudget{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       policyv1.PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable},
+			},
+			updated: &policyv1.PodDisruptionBudget{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       policyv1.PodDisruptionBudgetSpec{MaxUnavailable: &updatedMaxUnavailable},
+			},
+			expected: &policyv1.PodDisruptionBudget{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       policyv1.PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable},
+			},
+		},
+		{
+			name:  "PDB is updated if the stack changed",
+			stack: updatedTestStack,
+			existing: &policyv1.PodDisruptionBudget{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       policyv1.PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable},
+			},
+			updated: &policyv1.PodDisruptionBudget{
+				ObjectMeta: updatedTestStackOwned,
+				Spec:       policyv1.PodDisruptionBudgetSpec{MaxUnavailable: &updatedMaxUnavailable},
+			},
+			expected: &policyv1.PodDisruptionBudget{
+				ObjectMeta: updatedTestStackOwned,
+				Spec:       policyv1.PodDisruptionBudgetSpec{MaxUnavailable: &updatedMaxUnavailable},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			if tc.existing != nil {
+				_, err := env.client.PolicyV1().PodDisruptionBudgets(tc.existing.Namespace).Create(context.Background(), tc.existing, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			err := env.controller.ReconcileStackPDB(context.Background(), &tc.stack, tc.existing, func() (*policyv1.PodDisruptionBudget, error) {
+				return tc.updated, nil
+			})
+			require.NoError(t, err)
+
+			updated, err := env.client.PolicyV1().PodDisruptionBudgets(tc.stack.Namespace).Get(context.Background(), tc.stack.Name, metav1.GetOptions{})
+			if tc.expected != nil {
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, updated)
+			} else {
+				require.True(t, errors.IsNotFound(err))
+			}
+		})
+	}
+}
+
+func testMonitor(kind zv1.MonitorKind, port string) *unstructured.Unstructured {
+	monitor := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"endpoints": []interface{}{
+					map[string]interface{}{"port": port},
+				},
+			},
+		},
+	}
+	monitor.SetAPIVersion("monitoring.coreos.com/v1")
+	monitor.SetKind(string(kind))
+	monitor.SetName(baseTestStackOwned.Name)
+	monitor.SetNamespace(baseTestStackOwned.Namespace)
+	monitor.SetAnnotations(baseTestStackOwned.Annotations)
+	monitor.SetOwnerReferences(baseTestStackOwned.OwnerReferences)
+	return monitor
+}
+
+func TestReconcileStackMonitor(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		existing []*unstructured.Unstructured
+		updated  *unstructured.Unstructured
+		expected []*unstructured.Unstructured
+	}{
+		{
+			name:     "monitor is created if it doesn't exist",
+			updated:  testMonitor(zv1.MonitorKindServiceMonitor, "metrics"),
+			expected: []*unstructured.Unstructured{testMonitor(zv1.MonitorKindServiceMonitor, "metrics")},
+		},
+		{
+			name:     "monitor is removed if it's no longer needed",
+			existing: []*unstructured.Unstructured{testMonitor(zv1.MonitorKindServiceMonitor, "metrics")},
+			updated:  nil,
+			expected: nil,
+		},
+		{
+			name:     "monitor is kept if it didn't change",
+			existing: []*unstructured.Unstructured{testMonitor(zv1.MonitorKindServiceMonitor, "metrics")},
+			updated:  testMonitor(zv1.MonitorKindServiceMonitor, "metrics"),
+			expected: []*unstructured.Unstructured{testMonitor(zv1.MonitorKindServiceMonitor, "metrics")},
+		},
+		{
+			name:     "monitor is updated if the template changed",
+			existing: []*unstructured.Unstructured{testMonitor(zv1.MonitorKindServiceMonitor, "metrics")},
+			updated:  testMonitor(zv1.MonitorKindServiceMonitor, "admin"),
+			expected: []*unstructured.Unstructured{testMonitor(zv1.MonitorKindServiceMonitor, "admin")},
+		},
+		{
+			name:     "monitor is replaced if the kind changed",
+			existing: []*unstructured.Unstructured{testMonitor(zv1.MonitorKindServiceMonitor, "metrics")},
+			updated:  testMonitor(zv1.MonitorKindPodMonitor, "metrics"),
+			expected: []*unstructured.Unstructured{testMonitor(zv1.MonitorKindPodMonitor, "metrics")},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			for _, monitor := range tc.existing {
+				_, err := env.client.Dynamic().Resource(monitorGVR(monitor)).Namespace(monitor.GetNamespace()).Create(context.Background(), monitor, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			err := env.controller.ReconcileStackMonitor(context.Background(), &baseTestStack, tc.existing, func() (*unstructured.Unstructured, error) {
+				return tc.updated, nil
+			})
+			require.NoError(t, err)
+
+			var monitors []*unstructured.Unstructured
+			for _, gvr := range []schema.GroupVersionResource{podMonitorGVR, serviceMonitorGVR} {
+				list, err := env.client.Dynamic().Resource(gvr).Namespace(baseTestStack.Namespace).List(context.Background(), metav1.ListOptions{})
+				require.NoError(t, err)
+				for i := range list.Items {
+					monitors = append(monitors, &list.Items[i])
+				}
+			}
+			require.Equal(t, tc.expected, monitors)
+		})
+	}
+}
+
+func testScaledObject(minReplicas int64) *unstructured.Unstructured {
+	scaledObject := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"minReplicaCount": minReplicas,
+				"maxReplicaCount": int64(10),
+			},
+		},
+	}
+	scaledObject.SetAPIVersion("keda.sh/v1alpha1")
+	scaledObject.SetKind("ScaledObject")
+	scaledObject.SetName(baseTestStackOwned.Name)
+	scaledObject.SetNamespace(baseTestStackOwned.Namespace)
+	scaledObject.SetAnnotations(baseTestStackOwned.Annotations)
+	scaledObject.SetOwnerReferences(baseTestStackOwned.OwnerReferences)
+	return scaledObject
+}
+
+func TestReconcileStackScaledObject(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		existing *unstructured.Unstructured
+		updated  *unstructured.Unstructured
+		expected *unstructured.Unstructured
+	}{
+		{
+			name:     "ScaledObject is created if it doesn't exist",
+			updated:  testScaledObject(2),
+			expected: testScaledObject(2),
+		},
+		{
+			name:     "ScaledObject is removed if it's no longer needed",
+			existing: testScaledObject(2),
+			updated:  nil,
+			expected: nil,
+		},
+		{
+			name:     "ScaledObject is kept if it didn't change",
+			existing: testScaledObject(2),
+			updated:  testScaledObject(2),
+			expected: testScaledObject(2),
+		},
+		{
+			name:     "ScaledObject is updated if the replicas changed",
+			existing: testScaledObject(2),
+			updated:  testScaledObject(5),
+			expected: testScaledObject(5),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			if tc.existing != nil {
+				_, err := env.client.Dynamic().Resource(scaledObjectGVR).Namespace(tc.existing.GetNamespace()).Create(context.Background(), tc.existing, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			err := env.controller.ReconcileStackScaledObject(context.Background(), &baseTestStack, tc.existing, func() (*unstructured.Unstructured, error) {
+				return tc.updated, nil
+			})
+			require.NoError(t, err)
+
+			updated, err := env.client.Dynamic().Resource(scaledObjectGVR).Namespace(baseTestStack.Namespace).Get(context.Background(), baseTestStack.Name, metav1.GetOptions{})
+			if tc.expected != nil {
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, updated)
+			} else {
+				require.True(t, errors.IsNotFound(err))
+			}
+		})
+	}
+}
+
+func testVPA(objectMeta metav1.ObjectMeta, updateMode string) *unstructured.Unstructured {
+	vpa := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"updatePolicy": map[string]interface{}{
+					"updateMode": updateMode,
+				},
+			},
+		},
+	}
+	vpa.SetAPIVersion("autoscaling.k8s.io/v1")
+	vpa.SetKind("VerticalPodAutoscaler")
+	vpa.SetName(objectMeta.Name)
+	vpa.SetNamespace(objectMeta.Namespace)
+	vpa.SetAnnotations(objectMeta.Annotations)
+	vpa.SetOwnerReferences(objectMeta.OwnerReferences)
+	return vpa
+}
+
+func TestReconcileStackVPA(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		stack    zv1.Stack
+		existing *unstructured.Unstructured
+		updated  *unstructured.Unstructured
+		expected *unstructured.Unstructured
+	}{
+		{
+			name:     "VPA is created if it doesn't exist",
+			stack:    baseTestStack,
+			updated:  testVPA(baseTestStackOwned, "Off"),
+			expected: testVPA(baseTestStackOwned, "Off"),
+		},
+		{
+			name:     "VPA is removed if it's no longer needed",
+			stack:    baseTestStack,
+			existing: testVPA(baseTestStackOwned, "Off"),
+			updated:  nil,
+			expected: nil,
+		},
+		{
+			name:     "VPA is not updated if the stack didn't change",
+			stack:    baseTestStack,
+			existing: testVPA(baseTestStackOwned, "Off"),
+			updated:  testVPA(baseTestStackOwned, "Auto"),
+			expected: testVPA(baseTestStackOwned, "Off"),
+		},
+		{
+			name:     "VPA is updated if the stack changed",
+			stack:    updatedTestStack,
+			existing: testVPA(baseTestStackOwned, "Off"),
+			updated:  testVPA(updatedTestStackOwned, "Auto"),
+			expected: testVPA(updatedTestStackOwned, "Auto"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			if tc.existing != nil {
+				_, err := env.client.Dynamic().Resource(vpaGVR).Namespace(tc.existing.GetNamespace()).Create(context.Background(), tc.existing, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			err := env.controller.ReconcileStackVPA(context.Background(), &tc.stack, tc.existing, func() (*unstructured.Unstructured, error) {
+				return tc.updated, nil
+			})
+			require.NoError(t, err)
+
+			updated, err := env.client.Dynamic().Resource(vpaGVR).Namespace(tc.stack.Namespace).Get(context.Background(), tc.stack.Name, metav1.GetOptions{})
+			if tc.expected != nil {
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, updated)
+			} else {
+				require.True(t, errors.IsNotFound(err))
+			}
+		})
+	}
+}
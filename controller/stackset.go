@@ -24,10 +24,13 @@ import (
 	networking "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/cache"
 	kube_record "k8s.io/client-go/tools/record"
@@ -35,6 +38,7 @@ import (
 
 const (
 	PrescaleStacksAnnotationKey               = "alpha.stackset-controller.zalando.org/prescale-stacks"
+	ProportionalMinReplicasAnnotationKey      = "alpha.stackset-controller.zalando.org/traffic-proportional-min-replicas"
 	ResetHPAMinReplicasDelayAnnotationKey     = "alpha.stackset-controller.zalando.org/reset-hpa-min-replicas-delay"
 	StacksetControllerControllerAnnotationKey = "stackset-controller.zalando.org/controller"
 	ControllerLastUpdatedAnnotationKey        = "stackset-controller.zalando.org/updated-timestamp"
@@ -63,6 +67,11 @@ type StackSetController struct {
 	ingressSourceSwitchTTL      time.Duration
 	now                         func() string
 	reconcileWorkers            int
+	readinessChecker            *readinessChecker
+	// namespaces in which copies of ConfigMaps and Secrets were found in
+	// the last collection, they're listed until they're cleaned up
+	configMapNamespaces map[string]struct{}
+	secretNamespaces    map[string]struct{}
 	sync.Mutex
 }
 
@@ -107,6 +116,7 @@ func NewStackSetController(client clientset.Interface, controllerID string, para
 		ingressSourceSwitchTTL:      ingressSourceSwitchTTL,
 		now:                         now,
 		reconcileWorkers:            parallelWork,
+		readinessChecker:            newReadinessChecker(),
 	}, nil
 }
 
@@ -216,6 +226,11 @@ func (c *StackSetController) Run(ctx context.Context) {
 // collectResources collects resources for all stacksets at once and stores them per StackSet/Stack so that we don't
 // overload the API requests with unnecessary requests
 func (c *StackSetController) collectResources(ctx context.Context) (map[types.UID]*core.StackSetContainer, error) {
+	quotas, err := c.collectResourceQuotas(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	stacksets := make(map[types.UID]*core.StackSetContainer, len(c.stacksetStore))
 	for uid, stackset := range c.stacksetStore {
 		stackset := stackset
@@ -228,16 +243,31 @@ func (c *StackSetController) collectResources(ctx context.Context) (map[types.UI
 			if resetDelayValue, ok := getResetMinReplicasDelay(stackset.Annotations); ok {
 				resetDelay = resetDelayValue
 			}
-			reconciler = &core.PrescalingTrafficReconciler{
+			prescalingReconciler := &core.PrescalingTrafficReconciler{
 				ResetHPAMinReplicasTimeout: resetDelay,
+				ResourceQuotas:             quotas[stackset.Namespace],
 			}
+			if prescaling := stackset.Spec.Prescaling; prescaling != nil {
+				prescalingReconciler.OverscalePercent = prescaling.OverscalePercent
+				prescalingReconciler.MinReplicas = prescaling.MinReplicas
+				if prescaling.Estimator == zv1.PrescalingEstimatorHPAMetrics {
+					prescalingReconciler.Estimator = core.HPAMetricsEstimator{}
+				}
+			}
+			reconciler = prescalingReconciler
+		}
+
+		// derive the minimum replicas from the traffic if enabled with an
+		// annotation, this replaces the prescaling logic
+		if _, ok := stackset.Annotations[ProportionalMinReplicasAnnotationKey]; ok {
+			reconciler = &core.ProportionalTrafficReconciler{}
 		}
 
 		stacksetContainer := core.NewContainer(&stackset, reconciler, c.backendWeightsAnnotationKey, c.clusterDomains)
 		stacksets[uid] = stacksetContainer
 	}
 
-	err := c.collectStacks(ctx, stacksets)
+	err = c.collectStacks(ctx, stacksets)
 	if err != nil {
 		return nil, err
 	}
@@ -269,9 +299,84 @@ func (c *StackSetController) collectResources(ctx context.Context) (map[types.UI
 		return nil, err
 	}
 
+	err = c.collectPDBs(ctx, stacksets)
+	if err != nil {
+		return nil, err
+	}
+
+	if hooksEnabled(stacksets) {
+		err = c.collectJobs(ctx, stacksets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The monitors, ScaledObjects and VerticalPodAutoscalers are always
+	// collected, so they're cleaned up once they're removed from the stacks.
+	// The copies of ConfigMaps and Secrets are only collected in the
+	// namespaces which use them.
+	err = c.collectConfigMaps(ctx, stacksets)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.collectSecrets(ctx, stacksets)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.collectMonitors(ctx, stacksets)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.collectScaledObjects(ctx, stacksets)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.collectVPAs(ctx, stacksets)
+	if err != nil {
+		return nil, err
+	}
+
+	if autoscalerDefaultsEnabled(stacksets) {
+		err = c.collectAutoscalerDefaults(ctx, stacksets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the stacks of the external StackSets are shared before the
+	// StackSets are reconciled in parallel
+	core.LinkExternalStackSets(stacksets)
+
 	return stacksets, nil
 }
 
+// hooksEnabled returns true if any of the stacksets defines hooks. Jobs are
+// only collected in this case.
+func hooksEnabled(stacksets map[types.UID]*core.StackSetContainer) bool {
+	for _, ssc := range stacksets {
+		if ssc.StackSet.Spec.Hooks != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// autoscalerDefaultsEnabled returns true if any of the stack templates
+// defines an autoscaler. The autoscaler defaults of the namespaces are only
+// collected in this case.
+func autoscalerDefaultsEnabled(stacksets map[types.UID]*core.StackSetContainer) bool {
+	for _, ssc := range stacksets {
+		if ssc.StackSet.Spec.StackTemplate.Spec.Autoscaler != nil {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *StackSetController) collectIngresses(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
 	ingresses, err := c.client.NetworkingV1().Ingresses(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
 	if err != nil {
@@ -428,6 +533,263 @@ Items:
 	return nil
 }
 
+func (c *StackSetController) collectJobs(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
+	jobs, err := c.client.BatchV1().Jobs(v1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: core.HookLabelKey})
+	if err != nil {
+		return fmt.Errorf("failed to list Jobs: %v", err)
+	}
+
+	for _, j := range jobs.Items {
+		job := j
+		if uid, ok := getOwnerUID(job.ObjectMeta); ok {
+			for _, stackset := range stacksets {
+				if s, ok := stackset.StackContainers[uid]; ok {
+					switch job.Labels[core.HookLabelKey] {
+					case core.PreTrafficHook:
+						s.Resources.PreTrafficJob = &job
+					case core.PostTrafficHook:
+						s.Resources.PostTrafficJob = &job
+					}
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *StackSetController) collectPDBs(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
+	pdbs, err := c.client.PolicyV1().PodDisruptionBudgets(v1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: core.StacksetHeritageLabelKey})
+	if err != nil {
+		return fmt.Errorf("failed to list PodDisruptionBudgets: %v", err)
+	}
+
+	for _, p := range pdbs.Items {
+		pdb := p
+		if uid, ok := getOwnerUID(pdb.ObjectMeta); ok {
+			for _, stackset := range stacksets {
+				if s, ok := stackset.StackContainers[uid]; ok {
+					s.Resources.PDB = &pdb
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// collectResourceQuotas returns the ResourceQuotas per namespace. They're
+// only collected if any of the stacksets uses prescaling, which limits the
+// prescaling replicas to their headroom.
+func (c *StackSetController) collectResourceQuotas(ctx context.Context) (map[string][]v1.ResourceQuota, error) {
+	prescaling := false
+	for _, stackset := range c.stacksetStore {
+		if _, ok := stackset.Annotations[PrescaleStacksAnnotationKey]; ok {
+			prescaling = true
+			break
+		}
+	}
+	if !prescaling {
+		return nil, nil
+	}
+
+	quotas, err := c.client.CoreV1().ResourceQuotas(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ResourceQuotas: %v", err)
+	}
+
+	result := make(map[string][]v1.ResourceQuota)
+	for _, quota := range quotas.Items {
+		result[quota.Namespace] = append(result[quota.Namespace], quota)
+	}
+	return result, nil
+}
+
+// configNamespaces returns the namespaces in which copies of ConfigMaps or
+// Secrets are collected: those of the StackSets whose stack template or
+// stacks define them, and those in which copies were found before, so
+// they're cleaned up once they're removed from the last stack.
+func configNamespaces(stacksets map[types.UID]*core.StackSetContainer, defined func(spec *zv1.StackSpec) bool, previous map[string]struct{}) map[string]struct{} {
+	namespaces := make(map[string]struct{}, len(previous))
+	for namespace := range previous {
+		namespaces[namespace] = struct{}{}
+	}
+	for _, ssc := range stacksets {
+		if defined(&ssc.StackSet.Spec.StackTemplate.Spec.StackSpec) {
+			namespaces[ssc.StackSet.Namespace] = struct{}{}
+			continue
+		}
+		for _, sc := range ssc.StackContainers {
+			if defined(&sc.Stack.Spec) {
+				namespaces[ssc.StackSet.Namespace] = struct{}{}
+				break
+			}
+		}
+	}
+	return namespaces
+}
+
+func (c *StackSetController) collectConfigMaps(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
+	namespaces := configNamespaces(stacksets, func(spec *zv1.StackSpec) bool { return len(spec.ConfigMaps) > 0 }, c.configMapNamespaces)
+
+	found := make(map[string]struct{})
+	for namespace := range namespaces {
+		configMaps, err := c.client.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{LabelSelector: core.StacksetHeritageLabelKey})
+		if err != nil {
+			return fmt.Errorf("failed to list ConfigMaps: %v", err)
+		}
+
+		for _, cm := range configMaps.Items {
+			configMap := cm
+			if uid, ok := getOwnerUID(configMap.ObjectMeta); ok {
+				for _, stackset := range stacksets {
+					if s, ok := stackset.StackContainers[uid]; ok {
+						s.Resources.ConfigMaps = append(s.Resources.ConfigMaps, &configMap)
+						found[namespace] = struct{}{}
+						break
+					}
+				}
+			}
+		}
+	}
+	c.configMapNamespaces = found
+	return nil
+}
+
+func (c *StackSetController) collectSecrets(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
+	namespaces := configNamespaces(stacksets, func(spec *zv1.StackSpec) bool { return len(spec.Secrets) > 0 }, c.secretNamespaces)
+
+	found := make(map[string]struct{})
+	for namespace := range namespaces {
+		secrets, err := c.client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{LabelSelector: core.StacksetHeritageLabelKey})
+		if err != nil {
+			return fmt.Errorf("failed to list Secrets: %v", err)
+		}
+
+		for _, s := range secrets.Items {
+			secret := s
+			if uid, ok := getOwnerUID(secret.ObjectMeta); ok {
+				for _, stackset := range stacksets {
+					if s, ok := stackset.StackContainers[uid]; ok {
+						s.Resources.Secrets = append(s.Resources.Secrets, &secret)
+						found[namespace] = struct{}{}
+						break
+					}
+				}
+			}
+		}
+	}
+	c.secretNamespaces = found
+	return nil
+}
+
+// listOptionalResources lists the resources of a CRD which doesn't have to be
+// installed. If the CRD is missing, there are no resources to collect.
+func (c *StackSetController) listOptionalResources(ctx context.Context, gvr schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+	list, err := c.client.Dynamic().Resource(gvr).Namespace(v1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: core.StacksetHeritageLabelKey})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c *StackSetController) collectMonitors(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
+	for _, gvr := range []schema.GroupVersionResource{podMonitorGVR, serviceMonitorGVR} {
+		monitors, err := c.listOptionalResources(ctx, gvr)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %v", gvr.Resource, err)
+		}
+
+		for _, m := range monitors {
+			monitor := m
+			if uid, ok := getOwnerUID(metav1.ObjectMeta{OwnerReferences: monitor.GetOwnerReferences()}); ok {
+				for _, stackset := range stacksets {
+					if s, ok := stackset.StackContainers[uid]; ok {
+						s.Resources.Monitors = append(s.Resources.Monitors, &monitor)
+						break
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *StackSetController) collectScaledObjects(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
+	scaledObjects, err := c.listOptionalResources(ctx, scaledObjectGVR)
+	if err != nil {
+		return fmt.Errorf("failed to list ScaledObjects: %v", err)
+	}
+
+	for _, so := range scaledObjects {
+		scaledObject := so
+		if uid, ok := getOwnerUID(metav1.ObjectMeta{OwnerReferences: scaledObject.GetOwnerReferences()}); ok {
+			for _, stackset := range stacksets {
+				if s, ok := stackset.StackContainers[uid]; ok {
+					s.Resources.ScaledObject = &scaledObject
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *StackSetController) collectVPAs(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
+	vpas, err := c.listOptionalResources(ctx, vpaGVR)
+	if err != nil {
+		return fmt.Errorf("failed to list VerticalPodAutoscalers: %v", err)
+	}
+
+	for _, v := range vpas {
+		vpa := v
+		if uid, ok := getOwnerUID(metav1.ObjectMeta{OwnerReferences: vpa.GetOwnerReferences()}); ok {
+			for _, stackset := range stacksets {
+				if s, ok := stackset.StackContainers[uid]; ok {
+					s.Resources.VPA = &vpa
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// collectAutoscalerDefaults collects the autoscaler defaults of the
+// namespaces of the stacksets. Invalid defaults are logged and ignored, so
+// they don't block the stacksets in the namespace.
+func (c *StackSetController) collectAutoscalerDefaults(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
+	configMaps, err := c.client.CoreV1().ConfigMaps(v1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", core.AutoscalerDefaultsConfigMapName).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list ConfigMaps: %v", err)
+	}
+
+	for _, cm := range configMaps.Items {
+		configMap := cm
+		if configMap.Name != core.AutoscalerDefaultsConfigMapName {
+			continue
+		}
+
+		defaults, err := core.ParseAutoscalerDefaults(&configMap)
+		if err != nil {
+			c.logger.Errorf("Failed to parse autoscaler defaults: %v", err)
+			continue
+		}
+
+		for _, stackset := range stacksets {
+			if stackset.StackSet.Namespace == configMap.Namespace {
+				stackset.NamespaceAutoscalerDefaults = defaults
+			}
+		}
+	}
+	return nil
+}
+
 func getOwnerUID(objectMeta metav1.ObjectMeta) (types.UID, bool) {
 	if len(objectMeta.OwnerReferences) == 1 {
 		return objectMeta.OwnerReferences[0].UID, true
@@ -553,6 +915,13 @@ func (c *StackSetController) ReconcileStatuses(ctx context.Context, ssc *core.St
 	for _, sc := range ssc.StackContainers {
 		stack := sc.Stack.DeepCopy()
 		status := *sc.GenerateStackStatus()
+		if status.Pinned != stack.Status.Pinned {
+			reason, message := "StackPinned", "Stack %s is pinned and protected from garbage collection and scale-down"
+			if !status.Pinned {
+				reason, message = "StackUnpinned", "Stack %s is no longer pinned"
+			}
+			c.recorder.Eventf(sc.Stack, v1.EventTypeNormal, reason, message, sc.Name())
+		}
 		err := retryUpdate(func(retry bool) error {
 			if retry {
 				updated, err := c.client.ZalandoV1().Stacks(sc.Namespace()).Get(ctx, stack.Name, metav1.GetOptions{})
@@ -599,7 +968,28 @@ func (c *StackSetController) ReconcileStatuses(ctx context.Context, ssc *core.St
 
 // CreateCurrentStack creates a new Stack object for the current stack, if needed
 func (c *StackSetController) CreateCurrentStack(ctx context.Context, ssc *core.StackSetContainer) error {
-	newStack, newStackVersion := ssc.NewStack()
+	// A request to recreate a stack which can't be recreated is dropped,
+	// it would recreate the stack unexpectedly later on otherwise.
+	if err := ssc.CheckRecreateRequest(); err != nil {
+		c.recorder.Eventf(
+			ssc.StackSet,
+			v1.EventTypeWarning,
+			"IgnoredRecreateStack",
+			"Ignored request to recreate stack: %v",
+			err)
+
+		result, err := c.client.ZalandoV1().StackSets(ssc.StackSet.Namespace).Update(ctx, ssc.GenerateStackSetWithoutRecreateRequest(), metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		fixupStackSetTypeMeta(result)
+		ssc.StackSet = result
+	}
+
+	newStack, newStackVersion, err := ssc.NewStack()
+	if err != nil {
+		return err
+	}
 	if newStack == nil {
 		return nil
 	}
@@ -610,23 +1000,43 @@ func (c *StackSetController) CreateCurrentStack(ctx context.Context, ssc *core.S
 	}
 	fixupStackTypeMeta(created)
 
-	c.recorder.Eventf(
-		ssc.StackSet,
-		v1.EventTypeNormal,
-		"CreatedStack",
-		"Created stack %s",
-		newStack.Name())
+	// The stack of the observed version is only created again if this was
+	// requested explicitly.
+	if ssc.StackSet.Status.ObservedStackVersion == newStackVersion {
+		c.recorder.Eventf(
+			ssc.StackSet,
+			v1.EventTypeNormal,
+			"RecreatedStack",
+			"Recreated stack %s",
+			newStack.Name())
 
-	// Persist ObservedStackVersion in the status
-	updated := ssc.StackSet.DeepCopy()
-	updated.Status.ObservedStackVersion = newStackVersion
+		// Remove the annotation and restore the desired traffic
+		updated := ssc.GenerateRecreatedStackSet(newStack.Name())
+		result, err := c.client.ZalandoV1().StackSets(ssc.StackSet.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		fixupStackSetTypeMeta(result)
+		ssc.StackSet = result
+	} else {
+		c.recorder.Eventf(
+			ssc.StackSet,
+			v1.EventTypeNormal,
+			"CreatedStack",
+			"Created stack %s",
+			newStack.Name())
 
-	result, err := c.client.ZalandoV1().StackSets(ssc.StackSet.Namespace).UpdateStatus(ctx, updated, metav1.UpdateOptions{})
-	if err != nil {
-		return err
+		// Persist ObservedStackVersion in the status
+		updated := ssc.StackSet.DeepCopy()
+		updated.Status.ObservedStackVersion = newStackVersion
+
+		result, err := c.client.ZalandoV1().StackSets(ssc.StackSet.Namespace).UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		fixupStackSetTypeMeta(result)
+		ssc.StackSet = result
 	}
-	fixupStackSetTypeMeta(result)
-	ssc.StackSet = result
 
 	ssc.StackContainers[created.UID] = &core.StackContainer{
 		Stack:          created,
@@ -636,6 +1046,44 @@ func (c *StackSetController) CreateCurrentStack(ctx context.Context, ssc *core.S
 	return nil
 }
 
+// ReconcileTemplateDrift reports the drift between the stack template and
+// the current stack or, depending on the policy of the StackSet, updates the
+// current stack with the spec of the stack template.
+func (c *StackSetController) ReconcileTemplateDrift(ctx context.Context, ssc *core.StackSetContainer) error {
+	drift := ssc.TemplateDrift()
+	if drift == nil {
+		return nil
+	}
+
+	if ssc.StackSet.Spec.TemplateDriftPolicy != zv1.TemplateDriftPolicyApply {
+		if !meta.IsStatusConditionTrue(ssc.StackSet.Status.Conditions, zv1.TemplateDrift) {
+			c.recorder.Eventf(
+				ssc.StackSet,
+				v1.EventTypeWarning,
+				"TemplateDrift",
+				"The stack template changed without a new version: %s",
+				drift)
+		}
+		return nil
+	}
+
+	updated, err := c.client.ZalandoV1().Stacks(drift.Stack.Namespace()).Update(ctx, drift.UpdatedStack(), metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	fixupStackTypeMeta(updated)
+
+	c.recorder.Eventf(
+		ssc.StackSet,
+		v1.EventTypeNormal,
+		"AppliedTemplateDrift",
+		"Updated stack %s with the changed stack template: %s",
+		drift.Stack.Name(),
+		strings.Join(drift.Fields, ", "))
+	ssc.TemplateDriftApplied(updated)
+	return nil
+}
+
 // CleanupOldStacks deletes stacks that are no longer needed.
 func (c *StackSetController) CleanupOldStacks(ctx context.Context, ssc *core.StackSetContainer) error {
 	for _, sc := range ssc.StackContainers {
@@ -648,12 +1096,31 @@ func (c *StackSetController) CleanupOldStacks(ctx context.Context, ssc *core.Sta
 		if err != nil {
 			return c.errorEventf(ssc.StackSet, "FailedDeleteStack", err)
 		}
-		c.recorder.Eventf(
-			ssc.StackSet,
-			v1.EventTypeNormal,
-			"DeletedExcessStack",
-			"Deleted excess stack %s",
-			stack.Name)
+		switch sc.RemovalReason {
+		case core.RemovalReasonNoTraffic:
+			c.recorder.Eventf(
+				ssc.StackSet,
+				v1.EventTypeNormal,
+				"DeletedExpiredStack",
+				"Deleted stack %s without traffic for more than %s",
+				stack.Name,
+				time.Duration(*ssc.StackSet.Spec.StackLifecycle.DeleteAfterSecondsWithoutTraffic)*time.Second)
+		case core.RemovalReasonMaxAge:
+			c.recorder.Eventf(
+				ssc.StackSet,
+				v1.EventTypeNormal,
+				"DeletedExpiredStack",
+				"Deleted stack %s older than %s",
+				stack.Name,
+				time.Duration(*ssc.StackSet.Spec.StackLifecycle.MaxAgeSeconds)*time.Second)
+		default:
+			c.recorder.Eventf(
+				ssc.StackSet,
+				v1.EventTypeNormal,
+				"DeletedExcessStack",
+				"Deleted excess stack %s",
+				stack.Name)
+		}
 	}
 
 	return nil
@@ -943,15 +1410,17 @@ func (c *StackSetController) ReconcileStackSetResources(ctx context.Context, ssc
 	return nil
 }
 
-func (c *StackSetController) ReconcileStackSetDesiredTraffic(ctx context.Context, existing *zv1.StackSet, generateUpdated func() []*zv1.DesiredTraffic) error {
-	updatedTraffic := generateUpdated()
+func (c *StackSetController) ReconcileStackSetDesiredTraffic(ctx context.Context, existing *zv1.StackSet, generateUpdated func() *zv1.StackSet) error {
+	desired := generateUpdated()
 
-	if equality.Semantic.DeepEqual(existing.Spec.Traffic, updatedTraffic) {
+	if equality.Semantic.DeepEqual(existing.Spec.Traffic, desired.Spec.Traffic) &&
+		equality.Semantic.DeepEqual(existing.Annotations, desired.Annotations) {
 		return nil
 	}
 
 	updated := existing.DeepCopy()
-	updated.Spec.Traffic = updatedTraffic
+	updated.Spec.Traffic = desired.Spec.Traffic
+	updated.Annotations = desired.Annotations
 
 	_, err := c.client.ZalandoV1().StackSets(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
 	if err != nil {
@@ -967,7 +1436,18 @@ func (c *StackSetController) ReconcileStackSetDesiredTraffic(ctx context.Context
 }
 
 func (c *StackSetController) ReconcileStackResources(ctx context.Context, ssc *core.StackSetContainer, sc *core.StackContainer) error {
-	err := c.ReconcileStackDeployment(ctx, sc.Stack, sc.Resources.Deployment, sc.GenerateDeployment)
+	// ConfigMaps and Secrets have to exist before the pods are started
+	err := c.ReconcileStackConfigMaps(ctx, sc.Stack, sc.Resources.ConfigMaps, sc.GenerateConfigMaps)
+	if err != nil {
+		return c.errorEventf(sc.Stack, "FailedManageConfigMap", err)
+	}
+
+	err = c.ReconcileStackSecrets(ctx, sc.Stack, sc.Resources.Secrets, sc.GenerateSecrets)
+	if err != nil {
+		return c.errorEventf(sc.Stack, "FailedManageSecret", err)
+	}
+
+	err = c.ReconcileStackDeployment(ctx, sc.Stack, sc.Resources.Deployment, sc.GenerateDeployment)
 	if err != nil {
 		return c.errorEventf(sc.Stack, "FailedManageDeployment", err)
 	}
@@ -977,11 +1457,31 @@ func (c *StackSetController) ReconcileStackResources(ctx context.Context, ssc *c
 		return c.errorEventf(sc.Stack, "FailedManageHPA", err)
 	}
 
+	err = c.ReconcileStackScaledObject(ctx, sc.Stack, sc.Resources.ScaledObject, sc.GenerateScaledObject)
+	if err != nil {
+		return c.errorEventf(sc.Stack, "FailedManageScaledObject", err)
+	}
+
 	err = c.ReconcileStackService(ctx, sc.Stack, sc.Resources.Service, sc.GenerateService)
 	if err != nil {
 		return c.errorEventf(sc.Stack, "FailedManageService", err)
 	}
 
+	err = c.ReconcileStackPDB(ctx, sc.Stack, sc.Resources.PDB, sc.GeneratePDB)
+	if err != nil {
+		return c.errorEventf(sc.Stack, "FailedManagePDB", err)
+	}
+
+	err = c.ReconcileStackVPA(ctx, sc.Stack, sc.Resources.VPA, sc.GenerateVPA)
+	if err != nil {
+		return c.errorEventf(sc.Stack, "FailedManageVPA", err)
+	}
+
+	err = c.ReconcileStackMonitor(ctx, sc.Stack, sc.Resources.Monitors, sc.GenerateMonitor)
+	if err != nil {
+		return c.errorEventf(sc.Stack, "FailedManageMonitor", err)
+	}
+
 	err = c.ReconcileStackIngress(ctx, sc.Stack, sc.Resources.Ingress, sc.GenerateIngress)
 	if err != nil {
 		return c.errorEventf(sc.Stack, "FailedManageIngress", err)
@@ -994,6 +1494,28 @@ func (c *StackSetController) ReconcileStackResources(ctx context.Context, ssc *c
 		}
 	}
 
+	err = c.ReconcileStackJob(ctx, sc.Stack, sc.Resources.PreTrafficJob, sc.RetryHookJob(sc.Resources.PreTrafficJob), sc.GeneratePreTrafficJob)
+	if err != nil {
+		return c.errorEventf(sc.Stack, "FailedManageJob", err)
+	}
+
+	err = c.ReconcileStackJob(ctx, sc.Stack, sc.Resources.PostTrafficJob, sc.RetryHookJob(sc.Resources.PostTrafficJob), sc.GeneratePostTrafficJob)
+	if err != nil {
+		return c.errorEventf(sc.Stack, "FailedManageJob", err)
+	}
+
+	for _, hook := range []string{core.PreTrafficHook, core.PostTrafficHook} {
+		if sc.HookFailed(hook) {
+			c.recorder.Eventf(
+				sc.Stack,
+				v1.EventTypeWarning,
+				"HookFailed",
+				"The %s hook of stack %s failed",
+				hook,
+				sc.Name())
+		}
+	}
+
 	return nil
 }
 
@@ -1007,6 +1529,13 @@ func (c *StackSetController) ReconcileStackSet(ctx context.Context, container *c
 		}
 	}()
 
+	// Adopt existing resources as the initial stack, if requested. Proceed on errors.
+	err = c.AdoptResources(ctx, container)
+	if err != nil {
+		err = c.errorEventf(container.StackSet, "FailedAdoptResources", err)
+		c.stacksetLogger(container).Errorf("Unable to adopt resources: %v", err)
+	}
+
 	// Create current stack, if needed. Proceed on errors.
 	err = c.CreateCurrentStack(ctx, container)
 	if err != nil {
@@ -1020,6 +1549,16 @@ func (c *StackSetController) ReconcileStackSet(ctx context.Context, container *c
 		return err
 	}
 
+	// Report or apply changes of the stack template. Proceed on errors.
+	err = c.ReconcileTemplateDrift(ctx, container)
+	if err != nil {
+		err = c.errorEventf(container.StackSet, "FailedApplyTemplateDrift", err)
+		c.stacksetLogger(container).Errorf("Unable to apply stack template drift: %v", err)
+	}
+
+	// Check the stacks whose traffic should be increased.
+	c.reconcileReadinessChecks(ctx, container)
+
 	// Update the stacks with the currently selected traffic reconciler. Proceed on errors.
 	err = container.ManageTraffic(time.Now())
 	if err != nil {
@@ -1051,7 +1590,7 @@ func (c *StackSetController) ReconcileStackSet(ctx context.Context, container *c
 	}
 
 	// Reconcile desired traffic in the stackset. Proceed on errors.
-	err = c.ReconcileStackSetDesiredTraffic(ctx, container.StackSet, container.GenerateStackSetTraffic)
+	err = c.ReconcileStackSetDesiredTraffic(ctx, container.StackSet, container.GenerateStackSetDesiredTraffic)
 	if err != nil {
 		err = c.errorEventf(container.StackSet, reasonFailedManageStackSet, err)
 		c.stacksetLogger(container).Errorf("Unable to reconcile stackset traffic: %v", err)
@@ -16,6 +16,8 @@ import (
 	networking "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 )
 
@@ -56,6 +58,17 @@ func TestCollectResources(t *testing.T) {
 	testPrescalingCustomStackset := testStackset("foobaz", "namespace", "789")
 	testPrescalingCustomStackset.Annotations = map[string]string{PrescaleStacksAnnotationKey: "", ResetHPAMinReplicasDelayAnnotationKey: "30s"}
 
+	testPrescalingSpecStackset := testStackset("quux", "namespace", "654")
+	testPrescalingSpecStackset.Annotations = map[string]string{PrescaleStacksAnnotationKey: ""}
+	testPrescalingSpecStackset.Spec.Prescaling = &zv1.StackSetPrescaling{
+		OverscalePercent: 20,
+		MinReplicas:      3,
+		Estimator:        zv1.PrescalingEstimatorHPAMetrics,
+	}
+
+	testProportionalStackset := testStackset("qux", "namespace", "321")
+	testProportionalStackset.Annotations = map[string]string{PrescaleStacksAnnotationKey: "", ProportionalMinReplicasAnnotationKey: ""}
+
 	for _, tc := range []struct {
 		name        string
 		stacksets   []zv1.StackSet
@@ -73,6 +86,8 @@ func TestCollectResources(t *testing.T) {
 				testStacksetA,
 				testPrescalingStackset,
 				testPrescalingCustomStackset,
+				testPrescalingSpecStackset,
+				testProportionalStackset,
 			},
 			expected: map[types.UID]*core.StackSetContainer{
 				testStacksetA.UID: {
@@ -94,6 +109,21 @@ func TestCollectResources(t *testing.T) {
 						ResetHPAMinReplicasTimeout: 30 * time.Second,
 					},
 				},
+				testPrescalingSpecStackset.UID: {
+					StackSet:        &testPrescalingSpecStackset,
+					StackContainers: map[types.UID]*core.StackContainer{},
+					TrafficReconciler: &core.PrescalingTrafficReconciler{
+						ResetHPAMinReplicasTimeout: defaultResetMinReplicasDelay,
+						OverscalePercent:           20,
+						MinReplicas:                3,
+						Estimator:                  core.HPAMetricsEstimator{},
+					},
+				},
+				testProportionalStackset.UID: {
+					StackSet:          &testProportionalStackset,
+					StackContainers:   map[types.UID]*core.StackContainer{},
+					TrafficReconciler: &core.ProportionalTrafficReconciler{},
+				},
 			},
 		},
 		{
@@ -258,6 +288,182 @@ func TestCollectResources(t *testing.T) {
 	}
 }
 
+func TestCollectAutoscalerDefaults(t *testing.T) {
+	env := NewTestEnvironment()
+
+	withAutoscaler := testStackset("foo", "default", "123")
+	withAutoscaler.Spec.StackTemplate.Spec.Autoscaler = &zv1.Autoscaler{}
+	otherNamespace := testStackset("bar", "namespace", "456")
+	otherNamespace.Spec.StackTemplate.Spec.Autoscaler = &zv1.Autoscaler{}
+
+	err := env.CreateStacksets(context.Background(), []zv1.StackSet{withAutoscaler, otherNamespace})
+	require.NoError(t, err)
+
+	for _, configMap := range []v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: core.AutoscalerDefaultsConfigMapName, Namespace: "default"},
+			Data:       map[string]string{core.AutoscalerDefaultsConfigMapKey: "maxReplicas: 10"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: core.AutoscalerDefaultsConfigMapName, Namespace: "namespace"},
+			Data:       map[string]string{core.AutoscalerDefaultsConfigMapKey: "maxReplica: 10"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "default"},
+			Data:       map[string]string{core.AutoscalerDefaultsConfigMapKey: "maxReplicas: 20"},
+		},
+	} {
+		_, err := env.client.CoreV1().ConfigMaps(configMap.Namespace).Create(context.Background(), &configMap, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	resources, err := env.controller.collectResources(context.Background())
+	require.NoError(t, err)
+
+	maxReplicas := int32(10)
+	require.Equal(t, &zv1.AutoscalerDefaults{MaxReplicas: &maxReplicas}, resources[withAutoscaler.UID].NamespaceAutoscalerDefaults)
+	// Invalid defaults are ignored
+	require.Nil(t, resources[otherNamespace.UID].NamespaceAutoscalerDefaults)
+}
+
+func TestCollectOwnedResources(t *testing.T) {
+	env := NewTestEnvironment()
+
+	// Neither the StackSet nor the stack define any of the resources
+	// anymore, the remaining ones are still collected so they're deleted
+	stackset := testStackset("foo", "default", "123")
+	stack := testStack("foo-v1", stackset.Namespace, "abc1", stackset)
+
+	err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+	require.NoError(t, err)
+	err = env.CreateStacks(context.Background(), []zv1.Stack{stack})
+	require.NoError(t, err)
+
+	owned := stackOwned(stack)
+	owned.Labels = map[string]string{core.StacksetHeritageLabelKey: stackset.Name}
+
+	for _, gvr := range []schema.GroupVersionResource{podMonitorGVR, scaledObjectGVR, vpaGVR} {
+		resource := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		resource.SetName(owned.Name)
+		resource.SetNamespace(owned.Namespace)
+		resource.SetLabels(owned.Labels)
+		resource.SetOwnerReferences(owned.OwnerReferences)
+		_, err = env.client.Dynamic().Resource(gvr).Namespace(owned.Namespace).Create(context.Background(), resource, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	resources, err := env.controller.collectResources(context.Background())
+	require.NoError(t, err)
+
+	sc := resources[stackset.UID].StackContainers[stack.UID]
+	require.Len(t, sc.Resources.Monitors, 1)
+	require.NotNil(t, sc.Resources.ScaledObject)
+	require.NotNil(t, sc.Resources.VPA)
+}
+
+func TestCollectConfigResources(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		templateConfig  bool
+		stackConfig     bool
+		previouslyFound bool
+		expected        int
+	}{
+		{
+			name:     "not collected if neither the StackSet nor the stacks define them",
+			expected: 0,
+		},
+		{
+			name:           "collected if the stack template defines them",
+			templateConfig: true,
+			expected:       1,
+		},
+		{
+			name:        "collected if a stack defines them",
+			stackConfig: true,
+			expected:    1,
+		},
+		{
+			name:            "collected until the copies found before are cleaned up",
+			previouslyFound: true,
+			expected:        1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			stackset := testStackset("foo", "default", "123")
+			stack := testStack("foo-v1", stackset.Namespace, "abc1", stackset)
+			if tc.templateConfig {
+				stackset.Spec.StackTemplate.Spec.ConfigMaps = []zv1.StackConfigMap{{Name: "config"}}
+				stackset.Spec.StackTemplate.Spec.Secrets = []zv1.StackSecret{{Name: "credentials"}}
+			}
+			if tc.stackConfig {
+				stack.Spec.ConfigMaps = []zv1.StackConfigMap{{Name: "config"}}
+				stack.Spec.Secrets = []zv1.StackSecret{{Name: "credentials"}}
+			}
+			if tc.previouslyFound {
+				env.controller.configMapNamespaces = map[string]struct{}{stackset.Namespace: {}}
+				env.controller.secretNamespaces = map[string]struct{}{stackset.Namespace: {}}
+			}
+
+			err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+			require.NoError(t, err)
+			err = env.CreateStacks(context.Background(), []zv1.Stack{stack})
+			require.NoError(t, err)
+
+			owned := stackOwned(stack)
+			owned.Labels = map[string]string{core.StacksetHeritageLabelKey: stackset.Name}
+
+			configMap := v1.ConfigMap{ObjectMeta: *owned.DeepCopy()}
+			configMap.Name = "foo-v1-config"
+			_, err = env.client.CoreV1().ConfigMaps(configMap.Namespace).Create(context.Background(), &configMap, metav1.CreateOptions{})
+			require.NoError(t, err)
+
+			secret := v1.Secret{ObjectMeta: *owned.DeepCopy()}
+			secret.Name = "foo-v1-credentials"
+			_, err = env.client.CoreV1().Secrets(secret.Namespace).Create(context.Background(), &secret, metav1.CreateOptions{})
+			require.NoError(t, err)
+
+			resources, err := env.controller.collectResources(context.Background())
+			require.NoError(t, err)
+
+			sc := resources[stackset.UID].StackContainers[stack.UID]
+			require.Len(t, sc.Resources.ConfigMaps, tc.expected)
+			require.Len(t, sc.Resources.Secrets, tc.expected)
+
+			// The namespace stays tracked only while copies are found
+			_, configMapsTracked := env.controller.configMapNamespaces[stackset.Namespace]
+			_, secretsTracked := env.controller.secretNamespaces[stackset.Namespace]
+			require.Equal(t, tc.expected > 0, configMapsTracked)
+			require.Equal(t, tc.expected > 0, secretsTracked)
+		})
+	}
+}
+
+func TestCollectResourceQuotas(t *testing.T) {
+	env := NewTestEnvironment()
+
+	stackset := testStackset("foo", "default", "123")
+	stackset.Annotations = map[string]string{PrescaleStacksAnnotationKey: ""}
+
+	err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+	require.NoError(t, err)
+
+	quota := v1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "default"},
+	}
+	_, err = env.client.CoreV1().ResourceQuotas(quota.Namespace).Create(context.Background(), &quota, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	resources, err := env.controller.collectResources(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, &core.PrescalingTrafficReconciler{
+		ResetHPAMinReplicasTimeout: defaultResetMinReplicasDelay,
+		ResourceQuotas:             []v1.ResourceQuota{quota},
+	}, resources[stackset.UID].TrafficReconciler)
+}
+
 func TestCreateCurrentStack(t *testing.T) {
 	env := NewTestEnvironment()
 
@@ -322,6 +528,195 @@ func TestCreateCurrentStack(t *testing.T) {
 	require.True(t, errors.IsNotFound(err))
 }
 
+func TestRecreateCurrentStack(t *testing.T) {
+	env := NewTestEnvironment()
+
+	stackset := testStackset("foo", "default", "123")
+	stackset.Annotations = map[string]string{core.RecreateStackAnnotationKey: "v1"}
+	stackset.Spec.Ingress = &zv1.StackSetIngressSpec{}
+	stackset.Spec.StackTemplate.Spec.Version = "v1"
+	stackset.Status.ObservedStackVersion = "v1"
+
+	err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+	require.NoError(t, err)
+
+	container := &core.StackSetContainer{
+		StackSet:          &stackset,
+		StackContainers:   map[types.UID]*core.StackContainer{},
+		TrafficReconciler: &core.SimpleTrafficReconciler{},
+	}
+
+	err = env.controller.CreateCurrentStack(context.Background(), container)
+	require.NoError(t, err)
+
+	_, err = env.client.ZalandoV1().Stacks(stackset.Namespace).Get(context.Background(), "foo-v1", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	updated, err := env.client.ZalandoV1().StackSets(stackset.Namespace).Get(context.Background(), stackset.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotContains(t, updated.Annotations, core.RecreateStackAnnotationKey)
+	require.Equal(t, []*zv1.DesiredTraffic{{StackName: "foo-v1", Weight: 100}}, updated.Spec.Traffic)
+	require.Equal(t, "v1", updated.Status.ObservedStackVersion)
+	require.Len(t, container.StackContainers, 1)
+}
+
+func TestRecreateCurrentStackRestoresTraffic(t *testing.T) {
+	env := NewTestEnvironment()
+
+	stackset := testStackset("foo", "default", "123")
+	stackset.Annotations = map[string]string{
+		core.RecreateStackAnnotationKey:       "v1",
+		core.DeletedStackTrafficAnnotationKey: `{"foo-v1":80}`,
+	}
+	stackset.Spec.Ingress = &zv1.StackSetIngressSpec{}
+	stackset.Spec.StackTemplate.Spec.Version = "v1"
+	stackset.Spec.Traffic = []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 100}}
+	stackset.Status.ObservedStackVersion = "v1"
+
+	err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+	require.NoError(t, err)
+
+	oldStack := testStack("foo-v0", "default", "abc", stackset)
+	container := &core.StackSetContainer{
+		StackSet: &stackset,
+		StackContainers: map[types.UID]*core.StackContainer{
+			oldStack.UID: {Stack: &oldStack},
+		},
+		TrafficReconciler: &core.SimpleTrafficReconciler{},
+	}
+
+	err = env.controller.CreateCurrentStack(context.Background(), container)
+	require.NoError(t, err)
+
+	updated, err := env.client.ZalandoV1().StackSets(stackset.Namespace).Get(context.Background(), stackset.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Empty(t, updated.Annotations)
+	require.Equal(t, []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 20}, {StackName: "foo-v1", Weight: 80}}, updated.Spec.Traffic)
+}
+
+func TestCreateCurrentStackIgnoresStaleRecreateRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		recreate string
+		stacks   []string
+	}{
+		{
+			name:     "stack exists",
+			recreate: "v1",
+			stacks:   []string{"foo-v1"},
+		},
+		{
+			name:     "different version",
+			recreate: "v0",
+			stacks:   []string{"foo-v1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			stackset := testStackset("foo", "default", "123")
+			stackset.Annotations = map[string]string{core.RecreateStackAnnotationKey: tc.recreate}
+			stackset.Spec.StackTemplate.Spec.Version = "v1"
+			stackset.Status.ObservedStackVersion = "v1"
+
+			err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+			require.NoError(t, err)
+
+			container := &core.StackSetContainer{
+				StackSet:          &stackset,
+				StackContainers:   map[types.UID]*core.StackContainer{},
+				TrafficReconciler: &core.SimpleTrafficReconciler{},
+			}
+			for _, name := range tc.stacks {
+				stack := testStack(name, "default", types.UID(name), stackset)
+				container.StackContainers[stack.UID] = &core.StackContainer{Stack: &stack}
+			}
+
+			err = env.controller.CreateCurrentStack(context.Background(), container)
+			require.NoError(t, err)
+
+			updated, err := env.client.ZalandoV1().StackSets(stackset.Namespace).Get(context.Background(), stackset.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.NotContains(t, updated.Annotations, core.RecreateStackAnnotationKey)
+			require.NotContains(t, container.StackSet.Annotations, core.RecreateStackAnnotationKey)
+
+			stacks, err := env.client.ZalandoV1().Stacks(stackset.Namespace).List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			require.Empty(t, stacks.Items)
+		})
+	}
+}
+
+func TestReconcileTemplateDrift(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		policy        zv1.TemplateDriftPolicy
+		expectedImage string
+	}{
+		{
+			name:          "drift is only reported by default",
+			expectedImage: "ghcr.io/zalando/skipper:v1",
+		},
+		{
+			name:          "drift is reported",
+			policy:        zv1.TemplateDriftPolicyReport,
+			expectedImage: "ghcr.io/zalando/skipper:v1",
+		},
+		{
+			name:          "drift is applied to the current stack",
+			policy:        zv1.TemplateDriftPolicyApply,
+			expectedImage: "ghcr.io/zalando/skipper:v2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			podSpec := func(image string) zv1.PodTemplateSpec {
+				return zv1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{
+							{
+								Name:  "foo",
+								Image: image,
+							},
+						},
+					},
+				}
+			}
+
+			stackset := testStackset("foo", "default", "123")
+			stackset.Spec.TemplateDriftPolicy = tc.policy
+			stackset.Spec.StackTemplate.Spec = zv1.StackSpecTemplate{
+				Version: "v1",
+				StackSpec: zv1.StackSpec{
+					PodTemplate: podSpec("ghcr.io/zalando/skipper:v2"),
+				},
+			}
+			stack := testStack("foo-v1", stackset.Namespace, "abc1", stackset)
+			stack.Spec.PodTemplate = podSpec("ghcr.io/zalando/skipper:v1")
+
+			err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+			require.NoError(t, err)
+
+			err = env.CreateStacks(context.Background(), []zv1.Stack{stack})
+			require.NoError(t, err)
+
+			container := core.NewContainer(&stackset, &core.SimpleTrafficReconciler{}, "", nil)
+			container.StackContainers[stack.UID] = &core.StackContainer{Stack: &stack}
+			require.NoError(t, container.UpdateFromResources())
+			require.NotNil(t, container.TemplateDrift())
+
+			err = env.controller.ReconcileTemplateDrift(context.Background(), container)
+			require.NoError(t, err)
+
+			updated, err := env.client.ZalandoV1().Stacks(stackset.Namespace).Get(context.Background(), "foo-v1", metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedImage, updated.Spec.PodTemplate.Spec.Containers[0].Image)
+			require.Equal(t, tc.policy != zv1.TemplateDriftPolicyApply, container.TemplateDrift() != nil)
+		})
+	}
+}
+
 func TestCleanupOldStacks(t *testing.T) {
 	env := NewTestEnvironment()
 
@@ -437,8 +832,10 @@ func TestReconcileStackSetDesiredTraffic(t *testing.T) {
 		err := env.CreateStacksets(context.Background(), []zv1.StackSet{tc.existing})
 		require.NoError(t, err)
 
-		err = env.controller.ReconcileStackSetDesiredTraffic(context.Background(), &tc.existing, func() []*zv1.DesiredTraffic {
-			return tc.updated
+		err = env.controller.ReconcileStackSetDesiredTraffic(context.Background(), &tc.existing, func() *zv1.StackSet {
+			updated := tc.existing.DeepCopy()
+			updated.Spec.Traffic = tc.updated
+			return updated
 		})
 		require.NoError(t, err)
 
@@ -16,10 +16,15 @@ import (
 	ssunified "github.com/zalando-incubator/stackset-controller/pkg/clientset"
 	apps "k8s.io/api/apps/v1"
 	autoscaling "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 )
@@ -33,8 +38,9 @@ var (
 
 type testClient struct {
 	kubernetes.Interface
-	ssClient ssinterface.Interface
-	rgClient rginterface.Interface
+	ssClient  ssinterface.Interface
+	rgClient  rginterface.Interface
+	dynClient dynamic.Interface
 }
 
 func (c *testClient) ZalandoV1() zi.ZalandoV1Interface {
@@ -45,6 +51,10 @@ func (c *testClient) RouteGroupV1() rgi.ZalandoV1Interface {
 	return c.rgClient.ZalandoV1()
 }
 
+func (c *testClient) Dynamic() dynamic.Interface {
+	return c.dynClient
+}
+
 type testEnvironment struct {
 	client     ssunified.Interface
 	controller *StackSetController
@@ -55,6 +65,15 @@ func NewTestEnvironment() *testEnvironment {
 		Interface: fake.NewSimpleClientset(),
 		ssClient:  ssfake.NewSimpleClientset(),
 		rgClient:  rgfake.NewSimpleClientset(),
+		dynClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+			runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{
+				podMonitorGVR:     "PodMonitorList",
+				serviceMonitorGVR: "ServiceMonitorList",
+				scaledObjectGVR:   "ScaledObjectList",
+				vpaGVR:            "VerticalPodAutoscalerList",
+			},
+		),
 	}
 
 	controller, err := NewStackSetController(client, "", 10, "", nil, prometheus.NewPedanticRegistry(), time.Minute, true, time.Minute)
@@ -145,6 +164,16 @@ func (f *testEnvironment) CreateHPAs(ctx context.Context, hpas []autoscaling.Hor
 	return nil
 }
 
+func (f *testEnvironment) CreateJobs(ctx context.Context, jobs []batchv1.Job) error {
+	for _, job := range jobs {
+		_, err := f.client.BatchV1().Jobs(job.Namespace).Create(ctx, &job, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func testStackset(name, namespace string, uid types.UID) zv1.StackSet {
 	return zv1.StackSet{
 		ObjectMeta: metav1.ObjectMeta{
@@ -64,6 +64,218 @@ type StackSetSpec struct {
 	// minReadyPercent sets the minimum percentage of Pods expected
 	// to be Ready to consider a Stack for traffic switch
 	MinReadyPercent int `json:"minReadyPercent,omitempty"`
+	// Hooks defines Jobs which are run against a Stack before it gets
+	// traffic and after it gets all the traffic.
+	// +optional
+	Hooks *StackSetHooks `json:"hooks,omitempty"`
+	// ReadinessCheck defines an HTTP check which has to succeed before
+	// the traffic of a Stack is increased.
+	// +optional
+	ReadinessCheck *ReadinessCheck `json:"readinessCheck,omitempty"`
+	// TemplateDriftPolicy defines how changes of the stack template which
+	// don't result in a new Stack version are handled. With Report, the
+	// drift is only reported via the TemplateDrift condition and events.
+	// With Apply, the current Stack is updated in place. Defaults to
+	// Report.
+	// +kubebuilder:validation:Enum=Report;Apply
+	// +optional
+	TemplateDriftPolicy TemplateDriftPolicy `json:"templateDriftPolicy,omitempty"`
+	// Monitor defines a Prometheus Operator PodMonitor or ServiceMonitor
+	// which is created for every Stack.
+	// +optional
+	Monitor *StackSetMonitor `json:"monitor,omitempty"`
+	// AutoscalerDefaults are merged into the autoscaler of every new
+	// Stack. Fields set in the stack template take precedence.
+	// +optional
+	AutoscalerDefaults *AutoscalerDefaults `json:"autoscalerDefaults,omitempty"`
+	// ExternalStackSets are the names of other StackSets in the same
+	// namespace whose Stacks can get traffic from the Ingress or
+	// RouteGroup of this StackSet, e.g. to move traffic gradually to a
+	// differently named StackSet on the same host. Their Stacks are
+	// referenced by name in Traffic and only get traffic once they're
+	// ready.
+	// +optional
+	ExternalStackSets []string `json:"externalStackSets,omitempty"`
+	// TrafficPrecision is the granularity of the traffic weights. With
+	// PerMille or BasisPoint, weights below 1% can be used, e.g. 0.1%
+	// for a canary. The weights of the ingress and the RouteGroup are then
+	// set in per-mille or basis points, adding up to 1000 or 10000.
+	// Defaults to Percent.
+	// +kubebuilder:validation:Enum=Percent;PerMille;BasisPoint
+	// +optional
+	TrafficPrecision TrafficPrecision `json:"trafficPrecision,omitempty"`
+	// Prescaling configures the replicas of Stacks prescaled before their
+	// traffic is increased. It's only used if prescaling is enabled with
+	// the alpha.stackset-controller.zalando.org/prescale-stacks
+	// annotation.
+	// +optional
+	Prescaling *StackSetPrescaling `json:"prescaling,omitempty"`
+}
+
+// TrafficPrecision is the granularity of the traffic weights.
+type TrafficPrecision string
+
+const (
+	TrafficPrecisionPercent    TrafficPrecision = "Percent"
+	TrafficPrecisionPerMille   TrafficPrecision = "PerMille"
+	TrafficPrecisionBasisPoint TrafficPrecision = "BasisPoint"
+)
+
+// StackSetPrescaling configures how many replicas a Stack is prescaled to.
+// +k8s:deepcopy-gen=true
+type StackSetPrescaling struct {
+	// OverscalePercent is added on top of the replicas required for the
+	// desired traffic of the Stack, e.g. 20 prescales a Stack to 120% of
+	// the replicas. Use it to give new versions headroom for cold caches
+	// or JIT warmup.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	OverscalePercent int32 `json:"overscalePercent,omitempty"`
+	// MinReplicas is the minimum number of replicas a Stack is prescaled
+	// to. The replicas are still limited to the maximum replicas of the
+	// autoscaler.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+	// Estimator is used to estimate the replicas needed for the desired
+	// traffic of a Stack. ReplicaRatio assumes that the replicas of the
+	// Stacks scale linearly with their traffic. HPAMetrics uses the
+	// current metric values and targets of the HPAs of the Stacks getting
+	// traffic instead. Defaults to ReplicaRatio.
+	// +kubebuilder:validation:Enum=ReplicaRatio;HPAMetrics
+	// +optional
+	Estimator PrescalingEstimator `json:"estimator,omitempty"`
+}
+
+// PrescalingEstimator is the estimator of the replicas a Stack is prescaled
+// to.
+type PrescalingEstimator string
+
+const (
+	PrescalingEstimatorReplicaRatio PrescalingEstimator = "ReplicaRatio"
+	PrescalingEstimatorHPAMetrics   PrescalingEstimator = "HPAMetrics"
+)
+
+// MonitorKind is the kind of the Prometheus Operator monitor created for a
+// Stack.
+type MonitorKind string
+
+const (
+	MonitorKindPodMonitor     MonitorKind = "PodMonitor"
+	MonitorKindServiceMonitor MonitorKind = "ServiceMonitor"
+)
+
+// StackSetMonitor describes the Prometheus Operator monitor created for
+// every Stack. The monitor selects the pods or the Service of the Stack and
+// adds the stackset and stack-version labels to the scraped metrics.
+// +k8s:deepcopy-gen=true
+type StackSetMonitor struct {
+	// Kind of the monitor, either PodMonitor or ServiceMonitor.
+	// +kubebuilder:validation:Enum=PodMonitor;ServiceMonitor
+	Kind MonitorKind `json:"kind"`
+	// Labels are added to the monitor, e.g. to match the monitor selector
+	// of the Prometheus instance.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Endpoints are the endpoints scraped for every pod or Service.
+	Endpoints []MonitorEndpoint `json:"endpoints"`
+}
+
+// MonitorEndpoint describes an endpoint scraped by a monitor.
+// +k8s:deepcopy-gen=true
+type MonitorEndpoint struct {
+	// Port is the name of the container port (PodMonitor) or Service port
+	// (ServiceMonitor) which is scraped.
+	Port string `json:"port"`
+	// Path is the HTTP path of the metrics. Defaults to /metrics.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Interval at which metrics are scraped, e.g. 30s.
+	// +optional
+	Interval string `json:"interval,omitempty"`
+	// Scheme used for scraping, http or https.
+	// +optional
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// TemplateDriftPolicy defines how the drift between the stack template and
+// the current Stack is handled.
+type TemplateDriftPolicy string
+
+const (
+	TemplateDriftPolicyReport TemplateDriftPolicy = "Report"
+	TemplateDriftPolicyApply  TemplateDriftPolicy = "Apply"
+)
+
+// ReadinessCheckTarget is the endpoint called by the readiness check.
+type ReadinessCheckTarget string
+
+const (
+	// ReadinessCheckTargetService calls the Service of the Stack.
+	ReadinessCheckTargetService ReadinessCheckTarget = "service"
+	// ReadinessCheckTargetHostname calls the per-stack hostname of the
+	// Stack.
+	ReadinessCheckTargetHostname ReadinessCheckTarget = "hostname"
+)
+
+// ReadinessCheck describes an HTTP request made by the controller against a
+// Stack in addition to the readiness of its pods.
+// +k8s:deepcopy-gen=true
+type ReadinessCheck struct {
+	// Path is the HTTP path requested.
+	Path string `json:"path"`
+	// Target defines whether the Service of the Stack or its per-stack
+	// hostname is called. Defaults to service.
+	// +kubebuilder:validation:Enum=service;hostname
+	// +optional
+	Target ReadinessCheckTarget `json:"target,omitempty"`
+	// Port of the Service which is called. Defaults to the backendPort.
+	// Ignored for the hostname target.
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+	// ExpectedStatusCode is the HTTP status code expected in the response.
+	// Defaults to 200.
+	// +optional
+	ExpectedStatusCode *int32 `json:"expectedStatusCode,omitempty"`
+	// TimeoutSeconds is the timeout of the request. Defaults to 5.
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+	// PeriodSeconds defines how long the result of a check is cached
+	// before the Stack is checked again. Defaults to 30.
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+}
+
+// StackSetHooks defines the Jobs run by the controller at specific points
+// of a traffic switch.
+// +k8s:deepcopy-gen=true
+type StackSetHooks struct {
+	// PreTraffic is run against a Stack before it gets any traffic.
+	// Traffic is only switched to the Stack once the Job completed
+	// successfully.
+	// +optional
+	PreTraffic *StackHook `json:"preTraffic,omitempty"`
+	// PostTraffic is run against a Stack once it gets 100% of the
+	// traffic.
+	// +optional
+	PostTraffic *StackHook `json:"postTraffic,omitempty"`
+}
+
+// StackHook describes the Job created for a hook. The pods of the Job get
+// the stack name, the stack service and the per-stack hostnames passed as
+// environment variables.
+// +k8s:deepcopy-gen=true
+type StackHook struct {
+	// Specifies the number of retries before marking the hook as failed.
+	// Defaults to 6.
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// Specifies the duration in seconds relative to the startTime that the
+	// Job may be active before the hook is marked as failed.
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// PodTemplate describes the pods that will be created for the hook.
+	PodTemplate PodTemplateSpec `json:"podTemplate"`
 }
 
 // EmbeddedObjectMetaWithAnnotations defines the metadata which can be attached
@@ -188,6 +400,65 @@ type StackLifecycle struct {
 	// not getting traffic are deleted.
 	// +kubebuilder:validation:Minimum=1
 	Limit *int32 `json:"limit,omitempty"`
+	// DeleteAfterSecondsWithoutTraffic defines after how many seconds
+	// without traffic a Stack is deleted, regardless of the Limit. Stacks
+	// are never deleted before they are scaled down.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	DeleteAfterSecondsWithoutTraffic *int64 `json:"deleteAfterSecondsWithoutTraffic,omitempty"`
+	// MaxAgeSeconds defines after how many seconds since its creation a
+	// Stack is deleted, regardless of the Limit. Stacks are only deleted
+	// once they don't get traffic and are scaled down.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxAgeSeconds *int64 `json:"maxAgeSeconds,omitempty"`
+	// WarmStandby keeps the Stack which most recently got traffic scaled
+	// up after it's no longer getting traffic, so traffic can be switched
+	// back to it instantly.
+	// +optional
+	WarmStandby *WarmStandby `json:"warmStandby,omitempty"`
+	// GradualScaledown reduces the replicas of a Stack step by step after
+	// it lost its traffic, before it's scaled down to 0 replicas after
+	// ScaledownTTLSeconds.
+	// +optional
+	GradualScaledown *GradualScaledown `json:"gradualScaledown,omitempty"`
+}
+
+// GradualScaledown defines the steps in which the replicas of a Stack are
+// reduced after it lost its traffic.
+// +k8s:deepcopy-gen=true
+type GradualScaledown struct {
+	// IntervalSeconds is the time between two scale-down steps.
+	// +kubebuilder:validation:Minimum=1
+	IntervalSeconds int64 `json:"intervalSeconds"`
+	// Percentage of the replicas which is kept in each step. Defaults to
+	// 50.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=99
+	// +optional
+	Percentage *int32 `json:"percentage,omitempty"`
+	// MinReplicas is the number of replicas kept until the Stack is scaled
+	// down to 0. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+}
+
+// WarmStandby defines the number of replicas the previous Stack is kept at
+// after it stopped getting traffic. Either Replicas or Percentage must be
+// set.
+// +k8s:deepcopy-gen=true
+type WarmStandby struct {
+	// Replicas is the fixed number of replicas of the previous Stack.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Percentage of the replicas of the Stacks getting traffic the
+	// previous Stack is kept at.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	Percentage *int32 `json:"percentage,omitempty"`
 }
 
 // StackTemplate defines the template used for the Stack created from a
@@ -214,6 +485,29 @@ type MetricsEndpoint struct {
 type MetricsQueue struct {
 	Name   string `json:"name"`
 	Region string `json:"region"`
+	// AuthenticationRef is the name of the TriggerAuthentication used to
+	// access the queue. Only used by the keda engine.
+	// +optional
+	AuthenticationRef string `json:"authenticationRef,omitempty"`
+}
+
+// MetricsKafka specifies the Kafka topic and consumer group whose consumer
+// lag should be used for scaling.
+// +k8s:deepcopy-gen=true
+type MetricsKafka struct {
+	Topic         string `json:"topic"`
+	ConsumerGroup string `json:"consumerGroup"`
+}
+
+// MetricsRabbitMQ specifies the RabbitMQ queue whose length should be used
+// for scaling.
+// +k8s:deepcopy-gen=true
+type MetricsRabbitMQ struct {
+	Queue string `json:"queue"`
+	// VHost is the virtual host of the queue. Defaults to the vhost
+	// configured for the metrics adapter.
+	// +optional
+	VHost string `json:"vhost,omitempty"`
 }
 
 // ZMONMetricAggregatorType is the type of aggregator used in a ZMON based
@@ -266,8 +560,54 @@ type MetricsClusterScalingSchedule struct {
 	Name string `json:"name"`
 }
 
+// MetricsCron specifies a time window in which the stack is scaled to a
+// fixed number of replicas. Only supported by the keda engine.
+// +k8s:deepcopy-gen=true
+type MetricsCron struct {
+	// Timezone is the IANA name of the timezone of start and end, e.g.
+	// Europe/Berlin.
+	Timezone string `json:"timezone"`
+	// Start is the cron expression of the start of the window.
+	Start string `json:"start"`
+	// End is the cron expression of the end of the window.
+	End string `json:"end"`
+	// DesiredReplicas is the number of replicas during the window.
+	DesiredReplicas int32 `json:"desiredReplicas"`
+}
+
+// MetricsKEDA specifies a KEDA trigger which is passed to the ScaledObject
+// as is. Only supported by the keda engine.
+// +k8s:deepcopy-gen=true
+type MetricsKEDA struct {
+	// Type is the type of the KEDA scaler, e.g. kafka or prometheus.
+	Type string `json:"type"`
+	// Metadata is the configuration of the scaler.
+	Metadata map[string]string `json:"metadata"`
+	// AuthenticationRef is the name of the TriggerAuthentication used
+	// by the scaler.
+	// +optional
+	AuthenticationRef string `json:"authenticationRef,omitempty"`
+}
+
+// MetricsPrometheus specifies a PromQL query whose result is used for
+// scaling.
+// +k8s:deepcopy-gen=true
+type MetricsPrometheus struct {
+	// Name of the metric. It has to be unique within the autoscaler.
+	// +kubebuilder:validation:Pattern:=^[a-z0-9]([-a-z0-9]*[a-z0-9])?$
+	Name string `json:"name"`
+	// Query is the PromQL query, which has to return a scalar. The
+	// variables $(STACK_NAME) and $(STACKSET_NAME) are replaced with the
+	// names of the stack and the StackSet.
+	Query string `json:"query"`
+	// Server is the URL of the Prometheus server. Defaults to the server
+	// configured for kube-metrics-adapter. Required for the keda engine.
+	// +optional
+	Server string `json:"server,omitempty"`
+}
+
 // AutoscalerMetricType is the type of the metric used for scaling.
-// +kubebuilder:validation:Enum=CPU;Memory;AmazonSQS;PodJSON;Ingress;RouteGroup;ZMON;ScalingSchedule;ClusterScalingSchedule
+// +kubebuilder:validation:Enum=CPU;Memory;AmazonSQS;PodJSON;Ingress;RouteGroup;ZMON;ScalingSchedule;ClusterScalingSchedule;Cron;KEDA;Prometheus;MetricSpec;KafkaConsumerLag;RabbitMQQueueLength
 type AutoscalerMetricType string
 
 const (
@@ -280,6 +620,12 @@ const (
 	ZMONAutoscalerMetric         AutoscalerMetricType = "ZMON"
 	ClusterScalingScheduleMetric AutoscalerMetricType = "ClusterScalingSchedule"
 	ScalingScheduleMetric        AutoscalerMetricType = "ScalingSchedule"
+	CronAutoscalerMetric         AutoscalerMetricType = "Cron"
+	KEDAAutoscalerMetric         AutoscalerMetricType = "KEDA"
+	PrometheusAutoscalerMetric   AutoscalerMetricType = "Prometheus"
+	MetricSpecAutoscalerMetric   AutoscalerMetricType = "MetricSpec"
+	KafkaAutoscalerMetric        AutoscalerMetricType = "KafkaConsumerLag"
+	RabbitMQAutoscalerMetric     AutoscalerMetricType = "RabbitMQQueueLength"
 )
 
 // AutoscalerMetrics is the type of metric to be be used for autoscaling.
@@ -290,9 +636,20 @@ type AutoscalerMetrics struct {
 	Endpoint               *MetricsEndpoint               `json:"endpoint,omitempty"`
 	AverageUtilization     *int32                         `json:"averageUtilization,omitempty"`
 	Queue                  *MetricsQueue                  `json:"queue,omitempty"`
+	Kafka                  *MetricsKafka                  `json:"kafka,omitempty"`
+	RabbitMQ               *MetricsRabbitMQ               `json:"rabbitmq,omitempty"`
 	ZMON                   *MetricsZMON                   `json:"zmon,omitempty"`
 	ScalingSchedule        *MetricsScalingSchedule        `json:"scalingSchedule,omitempty"`
 	ClusterScalingSchedule *MetricsClusterScalingSchedule `json:"clusterScalingSchedule,omitempty"`
+	Cron                   *MetricsCron                   `json:"cron,omitempty"`
+	KEDA                   *MetricsKEDA                   `json:"keda,omitempty"`
+	Prometheus             *MetricsPrometheus             `json:"prometheus,omitempty"`
+	// MetricSpec is passed to the HPA as is, for metrics not covered by
+	// the other types. The variables $(STACK_NAME) and $(STACKSET_NAME)
+	// are replaced in the values of the metric selectors. Only supported
+	// by the hpa engine.
+	// +optional
+	MetricSpec *autoscalingv2.MetricSpec `json:"metricSpec,omitempty"`
 	// optional container name that can be used to scale based on CPU or
 	// Memory metrics of a specific container as opposed to an average of
 	// all containers in a pod.
@@ -308,10 +665,20 @@ type Autoscaler struct {
 	// +optional
 	MinReplicas *int32 `json:"minReplicas,omitempty"`
 	// maxReplicas is the upper limit for the number of replicas to which the autoscaler can scale up.
-	// It cannot be less that minReplicas.
-	MaxReplicas int32 `json:"maxReplicas"`
+	// It cannot be less that minReplicas. It may only be omitted if it's
+	// set in the autoscaler defaults.
+	// +optional
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+
+	// +optional
+	Metrics []AutoscalerMetrics `json:"metrics,omitempty"`
 
-	Metrics []AutoscalerMetrics `json:"metrics"`
+	// Engine is the autoscaler used for the stack. With hpa, a
+	// HorizontalPodAutoscaler is created; with keda, a KEDA ScaledObject.
+	// Defaults to hpa.
+	// +kubebuilder:validation:Enum=hpa;keda
+	// +optional
+	Engine AutoscalerEngine `json:"engine,omitempty"`
 
 	// behavior configures the scaling behavior of the target
 	// in both Up and Down directions (scaleUp and scaleDown fields respectively).
@@ -320,8 +687,38 @@ type Autoscaler struct {
 	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty" protobuf:"bytes,5,opt,name=behavior"`
 }
 
+// AutoscalerDefaults are the defaults of the autoscaler of a Stack, defined
+// on the StackSet or for the namespace. Each field is only used if it's not
+// set in the autoscaler of the stack template; the metrics are used as a
+// whole.
+// +k8s:deepcopy-gen=true
+type AutoscalerDefaults struct {
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// +optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+	// +optional
+	Metrics []AutoscalerMetrics `json:"metrics,omitempty"`
+	// +kubebuilder:validation:Enum=hpa;keda
+	// +optional
+	Engine AutoscalerEngine `json:"engine,omitempty"`
+	// Behavior is merged separately for scaling up and down.
+	// +optional
+	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+}
+
+// AutoscalerEngine is the autoscaler which scales a stack.
+type AutoscalerEngine string
+
+const (
+	AutoscalerEngineHPA  AutoscalerEngine = "hpa"
+	AutoscalerEngineKEDA AutoscalerEngine = "keda"
+)
+
 // HorizontalPodAutoscaler is the Autoscaling configuration of a Stack. If
 // defined an HPA will be created for the Stack.
+//
+// Deprecated: use Autoscaler with metrics of type MetricSpec instead.
 // +k8s:deepcopy-gen=true
 type HorizontalPodAutoscaler struct {
 	// minReplicas is the lower limit for the number of replicas to which the autoscaler can scale down.
@@ -370,8 +767,19 @@ type StackSetStatus struct {
 	// Traffic is the actual traffic setting on services for this stackset
 	// +optional
 	Traffic []*ActualTraffic `json:"traffic,omitempty"`
+	// Conditions describe the current state of the stackset.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+const (
+	// TemplateDrift is the condition indicating whether the spec of the
+	// current stack differs from the stack template.
+	TemplateDrift = "TemplateDrift"
+)
+
 // Traffic is the actual traffic setting on services for this
 // stackset, controllers interested in current traffic decision should
 // read this.
@@ -420,6 +828,7 @@ type StackSetList struct {
 // +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`,description="Number of ready replicas"
 // +kubebuilder:printcolumn:name="Traffic",type=number,JSONPath=`.status.actualTrafficWeight`,description="Current traffic weight for the stack"
 // +kubebuilder:printcolumn:name="No-Traffic-Since",type=date,JSONPath=`.status.noTrafficSince`,description="Time since the stack didn't get any traffic"
+// +kubebuilder:printcolumn:name="Pinned",type=boolean,JSONPath=`.status.pinned`,description="Whether the stack is protected from garbage collection",priority=1
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`,description="Age of the stack"
 // +kubebuilder:subresource:status
 // +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.labelSelector
@@ -456,7 +865,11 @@ type StackSpec struct {
 	// without any of its container crashing, for it to be considered available.
 	// Defaults to 0 (pod will be considered available as soon as it is ready)
 	// +optional
-	MinReadySeconds         int32                    `json:"minReadySeconds,omitempty"`
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+	// HorizontalPodAutoscaler configures an HPA with autoscaling/v2beta1
+	// metrics. Must not be set together with Autoscaler.
+	// Deprecated: use Autoscaler with metrics of type MetricSpec instead.
+	// +optional
 	HorizontalPodAutoscaler *HorizontalPodAutoscaler `json:"horizontalPodAutoscaler,omitempty"`
 	// Service can be used to configure a custom service, if not
 	// set stackset-controller will generate a service based on
@@ -475,6 +888,121 @@ type StackSpec struct {
 
 	// Strategy describe the rollout strategy for the underlying deployment
 	Strategy *appsv1.DeploymentStrategy `json:"strategy,omitempty"`
+
+	// ConfigMaps are copied for every stack and named <stack>-<name>.
+	// References to them in the pod template are rewritten to the copies.
+	// +optional
+	ConfigMaps []StackConfigMap `json:"configMaps,omitempty"`
+
+	// Secrets are copied for every stack and named <stack>-<name>.
+	// References to them in the pod template are rewritten to the copies.
+	// +optional
+	Secrets []StackSecret `json:"secrets,omitempty"`
+
+	// PodDisruptionBudget configures a PodDisruptionBudget for the pods of
+	// the stack. It's not created for stacks scaled down to zero.
+	// +optional
+	PodDisruptionBudget *PodDisruptionBudget `json:"podDisruptionBudget,omitempty"`
+
+	// VerticalPodAutoscaler configures a VerticalPodAutoscaler for the
+	// pods of the stack.
+	// +optional
+	VerticalPodAutoscaler *VerticalPodAutoscaler `json:"verticalPodAutoscaler,omitempty"`
+}
+
+// VPAUpdateMode defines whether the VerticalPodAutoscaler of a stack only
+// recommends resources or also applies them to the pods.
+type VPAUpdateMode string
+
+const (
+	VPAUpdateModeOff  VPAUpdateMode = "Off"
+	VPAUpdateModeAuto VPAUpdateMode = "Auto"
+)
+
+// VPASeed defines how the recommendation of the previous stack is used for
+// a new stack.
+type VPASeed string
+
+const (
+	// VPASeedRequests sets the resource requests of the containers to the
+	// recommendation of the previous stack.
+	VPASeedRequests VPASeed = "Requests"
+)
+
+// VerticalPodAutoscaler defines the VerticalPodAutoscaler of a stack.
+// +k8s:deepcopy-gen=true
+type VerticalPodAutoscaler struct {
+	// UpdateMode is Off to only get recommendations or Auto to apply them
+	// to the pods. Defaults to Off.
+	// +kubebuilder:validation:Enum=Off;Auto
+	// +optional
+	UpdateMode VPAUpdateMode `json:"updateMode,omitempty"`
+
+	// MinAllowed are the minimum resources recommended for each
+	// container.
+	// +optional
+	MinAllowed v1.ResourceList `json:"minAllowed,omitempty"`
+
+	// MaxAllowed are the maximum resources recommended for each
+	// container.
+	// +optional
+	MaxAllowed v1.ResourceList `json:"maxAllowed,omitempty"`
+
+	// Seed defines how the recommendation of the previous stack is used
+	// when a new stack is created. With Requests, it's used as the
+	// resource requests of its containers.
+	// +kubebuilder:validation:Enum=Requests
+	// +optional
+	Seed VPASeed `json:"seed,omitempty"`
+}
+
+// PodDisruptionBudget defines the PodDisruptionBudget of a stack. Only one
+// of MinAvailable and MaxUnavailable can be specified. Defaults to a
+// MaxUnavailable of 1.
+// +k8s:deepcopy-gen=true
+type PodDisruptionBudget struct {
+	// MinAvailable is the number or percentage of pods which must be
+	// available after an eviction.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number or percentage of pods which can be
+	// unavailable after an eviction.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// StackConfigMap is the template of a ConfigMap copied for every stack.
+// +k8s:deepcopy-gen=true
+type StackConfigMap struct {
+	EmbeddedObjectMeta `json:"metadata,omitempty"`
+
+	// Name of the ConfigMap as referenced in the pod template.
+	Name string `json:"name"`
+
+	// Data contains the configuration data.
+	// +optional
+	Data map[string]string `json:"data,omitempty"`
+
+	// BinaryData contains the binary configuration data.
+	// +optional
+	BinaryData map[string][]byte `json:"binaryData,omitempty"`
+}
+
+// StackSecret references an existing Secret copied for every stack. The copy
+// is taken when the stack is created, later changes of the Secret only apply
+// to new stacks.
+// +k8s:deepcopy-gen=true
+type StackSecret struct {
+	EmbeddedObjectMeta `json:"metadata,omitempty"`
+
+	// Name of the Secret as referenced in the pod template.
+	Name string `json:"name"`
+
+	// SecretName is the name of the existing Secret which is copied.
+	// Defaults to Name.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
 }
 
 // StackServiceSpec makes it possible to customize the service generated for
@@ -494,8 +1022,26 @@ type StackServiceSpec struct {
 // +k8s:deepcopy-gen=true
 type StackSpecTemplate struct {
 	StackSpec `json:",inline"`
-	// +kubebuilder:validation:Pattern="^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$"
-	Version string `json:"version"`
+	// Version of the Stack. It can be omitted if HashVersion is specified.
+	// +kubebuilder:validation:Pattern="^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*)?$"
+	// +optional
+	Version string `json:"version,omitempty"`
+	// HashVersion derives the Version from a hash of the template if no
+	// Version is specified, so every change of the template results in
+	// a new Stack.
+	// +optional
+	HashVersion *HashVersion `json:"hashVersion,omitempty"`
+}
+
+// HashVersion configures the Version derived from the hash of the Stack
+// template. Fields which don't affect the workload, like the replicas and
+// the autoscaler, are not part of the hash.
+// +k8s:deepcopy-gen=true
+type HashVersion struct {
+	// Prefix is prepended to the hash, separated by a dash.
+	// +kubebuilder:validation:Pattern="^[a-z0-9]([-a-z0-9]*[a-z0-9])?$"
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
 }
 
 // StackStatus is the status part of the Stack.
@@ -535,11 +1081,45 @@ type StackStatus struct {
 	// NoTrafficSince is the timestamp defining the last time the stack was
 	// observed getting traffic.
 	NoTrafficSince *metav1.Time `json:"noTrafficSince,omitempty"`
+	// LastTrafficReplicas is the number of replicas the stack had when it
+	// lost its traffic. It's used as the base of the gradual scale-down.
+	// +optional
+	LastTrafficReplicas int32 `json:"lastTrafficReplicas,omitempty"`
+	// TrafficSwitchReplicas is the number of replicas the stack had when
+	// the current traffic switch started. It's used as the base of the
+	// traffic-proportional minimum replicas.
+	// +optional
+	TrafficSwitchReplicas int32 `json:"trafficSwitchReplicas,omitempty"`
+	// Pinned is true if the stack is protected from garbage collection
+	// and scale-down by the stackset-controller.zalando.org/pinned
+	// annotation.
+	// +optional
+	Pinned bool `json:"pinned,omitempty"`
 	// LabelSelector is the label selector used to find all pods managed by
 	// a stack.
 	LabelSelector string `json:"labelSelector,omitempty"`
+	// Conditions describe the current state of the stack.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+const (
+	// PreTrafficHookSucceeded is the condition indicating whether the
+	// pre-traffic hook of the stack completed successfully.
+	PreTrafficHookSucceeded = "PreTrafficHookSucceeded"
+	// PostTrafficHookSucceeded is the condition indicating whether the
+	// post-traffic hook of the stack completed successfully.
+	PostTrafficHookSucceeded = "PostTrafficHookSucceeded"
+	// ReadinessCheckSucceeded is the condition indicating whether the
+	// last HTTP readiness check of the stack succeeded.
+	ReadinessCheckSucceeded = "ReadinessCheckSucceeded"
+	// PrescalingLimited is the condition indicating whether the prescaling
+	// replicas of the stack were limited by a ResourceQuota.
+	PrescalingLimited = "PrescalingLimited"
+)
+
 // Prescaling hold prescaling information
 // +k8s:deepcopy-gen=true
 type PrescalingStatus struct {
@@ -549,6 +1129,10 @@ type PrescalingStatus struct {
 	// Replicas is the number of replicas required for prescaling
 	// +optional
 	Replicas int32 `json:"replicas,omitempty"`
+	// OverscalePercent is the overscale percentage which was used to
+	// compute the replicas
+	// +optional
+	OverscalePercent int32 `json:"overscalePercent,omitempty"`
 	// DesiredTrafficWeight is the desired traffic weight that the stack was prescaled for
 	// +optional
 	// +kubebuilder:validation:Format=float
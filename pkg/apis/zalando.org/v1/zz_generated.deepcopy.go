@@ -27,7 +27,9 @@ import (
 	v2 "k8s.io/api/autoscaling/v2"
 	v2beta1 "k8s.io/api/autoscaling/v2beta1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -63,6 +65,44 @@ func (in *Autoscaler) DeepCopy() *Autoscaler {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoscalerDefaults) DeepCopyInto(out *AutoscalerDefaults) {
+	*out = *in
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = make([]AutoscalerMetrics, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Behavior != nil {
+		in, out := &in.Behavior, &out.Behavior
+		*out = new(v2.HorizontalPodAutoscalerBehavior)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalerDefaults.
+func (in *AutoscalerDefaults) DeepCopy() *AutoscalerDefaults {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalerDefaults)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AutoscalerMetrics) DeepCopyInto(out *AutoscalerMetrics) {
 	*out = *in
@@ -86,6 +126,16 @@ func (in *AutoscalerMetrics) DeepCopyInto(out *AutoscalerMetrics) {
 		*out = new(MetricsQueue)
 		**out = **in
 	}
+	if in.Kafka != nil {
+		in, out := &in.Kafka, &out.Kafka
+		*out = new(MetricsKafka)
+		**out = **in
+	}
+	if in.RabbitMQ != nil {
+		in, out := &in.RabbitMQ, &out.RabbitMQ
+		*out = new(MetricsRabbitMQ)
+		**out = **in
+	}
 	if in.ZMON != nil {
 		in, out := &in.ZMON, &out.ZMON
 		*out = new(MetricsZMON)
@@ -101,6 +151,26 @@ func (in *AutoscalerMetrics) DeepCopyInto(out *AutoscalerMetrics) {
 		*out = new(MetricsClusterScalingSchedule)
 		**out = **in
 	}
+	if in.Cron != nil {
+		in, out := &in.Cron, &out.Cron
+		*out = new(MetricsCron)
+		**out = **in
+	}
+	if in.KEDA != nil {
+		in, out := &in.KEDA, &out.KEDA
+		*out = new(MetricsKEDA)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Prometheus != nil {
+		in, out := &in.Prometheus, &out.Prometheus
+		*out = new(MetricsPrometheus)
+		**out = **in
+	}
+	if in.MetricSpec != nil {
+		in, out := &in.MetricSpec, &out.MetricSpec
+		*out = new(v2.MetricSpec)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -167,6 +237,48 @@ func (in *EmbeddedObjectMetaWithAnnotations) DeepCopy() *EmbeddedObjectMetaWithA
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GradualScaledown) DeepCopyInto(out *GradualScaledown) {
+	*out = *in
+	if in.Percentage != nil {
+		in, out := &in.Percentage, &out.Percentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GradualScaledown.
+func (in *GradualScaledown) DeepCopy() *GradualScaledown {
+	if in == nil {
+		return nil
+	}
+	out := new(GradualScaledown)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HashVersion) DeepCopyInto(out *HashVersion) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashVersion.
+func (in *HashVersion) DeepCopy() *HashVersion {
+	if in == nil {
+		return nil
+	}
+	out := new(HashVersion)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HorizontalPodAutoscaler) DeepCopyInto(out *HorizontalPodAutoscaler) {
 	*out = *in
@@ -216,6 +328,22 @@ func (in *MetricsClusterScalingSchedule) DeepCopy() *MetricsClusterScalingSchedu
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricsCron) DeepCopyInto(out *MetricsCron) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsCron.
+func (in *MetricsCron) DeepCopy() *MetricsCron {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricsCron)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetricsEndpoint) DeepCopyInto(out *MetricsEndpoint) {
 	*out = *in
@@ -232,6 +360,61 @@ func (in *MetricsEndpoint) DeepCopy() *MetricsEndpoint {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricsKEDA) DeepCopyInto(out *MetricsKEDA) {
+	*out = *in
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsKEDA.
+func (in *MetricsKEDA) DeepCopy() *MetricsKEDA {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricsKEDA)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricsKafka) DeepCopyInto(out *MetricsKafka) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsKafka.
+func (in *MetricsKafka) DeepCopy() *MetricsKafka {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricsKafka)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricsPrometheus) DeepCopyInto(out *MetricsPrometheus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsPrometheus.
+func (in *MetricsPrometheus) DeepCopy() *MetricsPrometheus {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricsPrometheus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetricsQueue) DeepCopyInto(out *MetricsQueue) {
 	*out = *in
@@ -248,6 +431,22 @@ func (in *MetricsQueue) DeepCopy() *MetricsQueue {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricsRabbitMQ) DeepCopyInto(out *MetricsRabbitMQ) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsRabbitMQ.
+func (in *MetricsRabbitMQ) DeepCopy() *MetricsRabbitMQ {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricsRabbitMQ)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetricsScalingSchedule) DeepCopyInto(out *MetricsScalingSchedule) {
 	*out = *in
@@ -292,6 +491,48 @@ func (in *MetricsZMON) DeepCopy() *MetricsZMON {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MonitorEndpoint) DeepCopyInto(out *MonitorEndpoint) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MonitorEndpoint.
+func (in *MonitorEndpoint) DeepCopy() *MonitorEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(MonitorEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodDisruptionBudget) DeepCopyInto(out *PodDisruptionBudget) {
+	*out = *in
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodDisruptionBudget.
+func (in *PodDisruptionBudget) DeepCopy() *PodDisruptionBudget {
+	if in == nil {
+		return nil
+	}
+	out := new(PodDisruptionBudget)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodTemplateSpec) DeepCopyInto(out *PodTemplateSpec) {
 	*out = *in
@@ -330,6 +571,42 @@ func (in *PrescalingStatus) DeepCopy() *PrescalingStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReadinessCheck) DeepCopyInto(out *ReadinessCheck) {
+	*out = *in
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ExpectedStatusCode != nil {
+		in, out := &in.ExpectedStatusCode, &out.ExpectedStatusCode
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PeriodSeconds != nil {
+		in, out := &in.PeriodSeconds, &out.PeriodSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReadinessCheck.
+func (in *ReadinessCheck) DeepCopy() *ReadinessCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(ReadinessCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RouteGroupSpec) DeepCopyInto(out *RouteGroupSpec) {
 	*out = *in
@@ -394,6 +671,72 @@ func (in *Stack) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackConfigMap) DeepCopyInto(out *StackConfigMap) {
+	*out = *in
+	in.EmbeddedObjectMeta.DeepCopyInto(&out.EmbeddedObjectMeta)
+	if in.Data != nil {
+		in, out := &in.Data, &out.Data
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.BinaryData != nil {
+		in, out := &in.BinaryData, &out.BinaryData
+		*out = make(map[string][]byte, len(*in))
+		for key, val := range *in {
+			var outVal []byte
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make([]byte, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackConfigMap.
+func (in *StackConfigMap) DeepCopy() *StackConfigMap {
+	if in == nil {
+		return nil
+	}
+	out := new(StackConfigMap)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackHook) DeepCopyInto(out *StackHook) {
+	*out = *in
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	in.PodTemplate.DeepCopyInto(&out.PodTemplate)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackHook.
+func (in *StackHook) DeepCopy() *StackHook {
+	if in == nil {
+		return nil
+	}
+	out := new(StackHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackIngressRouteGroupOverrides) DeepCopyInto(out *StackIngressRouteGroupOverrides) {
 	*out = *in
@@ -434,6 +777,26 @@ func (in *StackLifecycle) DeepCopyInto(out *StackLifecycle) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.DeleteAfterSecondsWithoutTraffic != nil {
+		in, out := &in.DeleteAfterSecondsWithoutTraffic, &out.DeleteAfterSecondsWithoutTraffic
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxAgeSeconds != nil {
+		in, out := &in.MaxAgeSeconds, &out.MaxAgeSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.WarmStandby != nil {
+		in, out := &in.WarmStandby, &out.WarmStandby
+		*out = new(WarmStandby)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GradualScaledown != nil {
+		in, out := &in.GradualScaledown, &out.GradualScaledown
+		*out = new(GradualScaledown)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -480,6 +843,23 @@ func (in *StackList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackSecret) DeepCopyInto(out *StackSecret) {
+	*out = *in
+	in.EmbeddedObjectMeta.DeepCopyInto(&out.EmbeddedObjectMeta)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackSecret.
+func (in *StackSecret) DeepCopy() *StackSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(StackSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackServiceSpec) DeepCopyInto(out *StackServiceSpec) {
 	*out = *in
@@ -532,6 +912,32 @@ func (in *StackSet) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackSetHooks) DeepCopyInto(out *StackSetHooks) {
+	*out = *in
+	if in.PreTraffic != nil {
+		in, out := &in.PreTraffic, &out.PreTraffic
+		*out = new(StackHook)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PostTraffic != nil {
+		in, out := &in.PostTraffic, &out.PostTraffic
+		*out = new(StackHook)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackSetHooks.
+func (in *StackSetHooks) DeepCopy() *StackSetHooks {
+	if in == nil {
+		return nil
+	}
+	out := new(StackSetHooks)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackSetIngressSpec) DeepCopyInto(out *StackSetIngressSpec) {
 	*out = *in
@@ -588,6 +994,50 @@ func (in *StackSetList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackSetMonitor) DeepCopyInto(out *StackSetMonitor) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]MonitorEndpoint, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackSetMonitor.
+func (in *StackSetMonitor) DeepCopy() *StackSetMonitor {
+	if in == nil {
+		return nil
+	}
+	out := new(StackSetMonitor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackSetPrescaling) DeepCopyInto(out *StackSetPrescaling) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackSetPrescaling.
+func (in *StackSetPrescaling) DeepCopy() *StackSetPrescaling {
+	if in == nil {
+		return nil
+	}
+	out := new(StackSetPrescaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackSetSpec) DeepCopyInto(out *StackSetSpec) {
 	*out = *in
@@ -619,6 +1069,36 @@ func (in *StackSetSpec) DeepCopyInto(out *StackSetSpec) {
 			}
 		}
 	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = new(StackSetHooks)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReadinessCheck != nil {
+		in, out := &in.ReadinessCheck, &out.ReadinessCheck
+		*out = new(ReadinessCheck)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Monitor != nil {
+		in, out := &in.Monitor, &out.Monitor
+		*out = new(StackSetMonitor)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AutoscalerDefaults != nil {
+		in, out := &in.AutoscalerDefaults, &out.AutoscalerDefaults
+		*out = new(AutoscalerDefaults)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExternalStackSets != nil {
+		in, out := &in.ExternalStackSets, &out.ExternalStackSets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Prescaling != nil {
+		in, out := &in.Prescaling, &out.Prescaling
+		*out = new(StackSetPrescaling)
+		**out = **in
+	}
 	return
 }
 
@@ -646,6 +1126,13 @@ func (in *StackSetStatus) DeepCopyInto(out *StackSetStatus) {
 			}
 		}
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -698,6 +1185,30 @@ func (in *StackSpec) DeepCopyInto(out *StackSpec) {
 		*out = new(appsv1.DeploymentStrategy)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ConfigMaps != nil {
+		in, out := &in.ConfigMaps, &out.ConfigMaps
+		*out = make([]StackConfigMap, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Secrets != nil {
+		in, out := &in.Secrets, &out.Secrets
+		*out = make([]StackSecret, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PodDisruptionBudget != nil {
+		in, out := &in.PodDisruptionBudget, &out.PodDisruptionBudget
+		*out = new(PodDisruptionBudget)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VerticalPodAutoscaler != nil {
+		in, out := &in.VerticalPodAutoscaler, &out.VerticalPodAutoscaler
+		*out = new(VerticalPodAutoscaler)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -715,6 +1226,11 @@ func (in *StackSpec) DeepCopy() *StackSpec {
 func (in *StackSpecTemplate) DeepCopyInto(out *StackSpecTemplate) {
 	*out = *in
 	in.StackSpec.DeepCopyInto(&out.StackSpec)
+	if in.HashVersion != nil {
+		in, out := &in.HashVersion, &out.HashVersion
+		*out = new(HashVersion)
+		**out = **in
+	}
 	return
 }
 
@@ -736,6 +1252,13 @@ func (in *StackStatus) DeepCopyInto(out *StackStatus) {
 		in, out := &in.NoTrafficSince, &out.NoTrafficSince
 		*out = (*in).DeepCopy()
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -766,3 +1289,59 @@ func (in *StackTemplate) DeepCopy() *StackTemplate {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VerticalPodAutoscaler) DeepCopyInto(out *VerticalPodAutoscaler) {
+	*out = *in
+	if in.MinAllowed != nil {
+		in, out := &in.MinAllowed, &out.MinAllowed
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.MaxAllowed != nil {
+		in, out := &in.MaxAllowed, &out.MaxAllowed
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VerticalPodAutoscaler.
+func (in *VerticalPodAutoscaler) DeepCopy() *VerticalPodAutoscaler {
+	if in == nil {
+		return nil
+	}
+	out := new(VerticalPodAutoscaler)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WarmStandby) DeepCopyInto(out *WarmStandby) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Percentage != nil {
+		in, out := &in.Percentage, &out.Percentage
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WarmStandby.
+func (in *WarmStandby) DeepCopy() *WarmStandby {
+	if in == nil {
+		return nil
+	}
+	out := new(WarmStandby)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -5,6 +5,7 @@ import (
 	rgv1 "github.com/szuecs/routegroup-client/client/clientset/versioned/typed/zalando.org/v1"
 	stackset "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned"
 	zalandov1 "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/zalando.org/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	rest "k8s.io/client-go/rest"
 )
@@ -13,19 +14,22 @@ type Interface interface {
 	kubernetes.Interface
 	ZalandoV1() zalandov1.ZalandoV1Interface
 	RouteGroupV1() rgv1.ZalandoV1Interface
+	Dynamic() dynamic.Interface
 }
 
 type Clientset struct {
 	kubernetes.Interface
 	stackset   stackset.Interface
 	routegroup rg.Interface
+	dynamic    dynamic.Interface
 }
 
-func NewClientset(kubernetes kubernetes.Interface, stackset stackset.Interface, routegroup rg.Interface) *Clientset {
+func NewClientset(kubernetes kubernetes.Interface, stackset stackset.Interface, routegroup rg.Interface, dynamic dynamic.Interface) *Clientset {
 	return &Clientset{
 		kubernetes,
 		stackset,
 		routegroup,
+		dynamic,
 	}
 }
 
@@ -45,7 +49,12 @@ func NewForConfig(kubeconfig *rest.Config) (*Clientset, error) {
 		return nil, err
 	}
 
-	return NewClientset(kubeClient, stacksetClient, rgClient), nil
+	dynamicClient, err := dynamic.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClientset(kubeClient, stacksetClient, rgClient, dynamicClient), nil
 }
 
 func (c *Clientset) ZalandoV1() zalandov1.ZalandoV1Interface {
@@ -55,3 +64,7 @@ func (c *Clientset) ZalandoV1() zalandov1.ZalandoV1Interface {
 func (c *Clientset) RouteGroupV1() rgv1.ZalandoV1Interface {
 	return c.routegroup.ZalandoV1()
 }
+
+func (c *Clientset) Dynamic() dynamic.Interface {
+	return c.dynamic
+}
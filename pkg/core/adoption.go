@@ -0,0 +1,182 @@
+package core
+
+import (
+	"fmt"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// AdoptStackAnnotationKey is the annotation used to request that an
+	// existing Deployment and Service are adopted as the initial stack of
+	// the given version of a StackSet.
+	AdoptStackAnnotationKey = "stackset-controller.zalando.org/adopt-stack"
+
+	// AdoptDeploymentAnnotationKey is the annotation used to specify the
+	// name of the adopted Deployment. It defaults to the name of the stack.
+	AdoptDeploymentAnnotationKey = "stackset-controller.zalando.org/adopt-deployment"
+
+	// AdoptServiceAnnotationKey is the annotation used to specify the name
+	// of the adopted Service. It defaults to the name of the stack.
+	AdoptServiceAnnotationKey = "stackset-controller.zalando.org/adopt-service"
+
+	// AdoptDryRunAnnotationKey is the annotation used to only report the
+	// changes the adoption would make.
+	AdoptDryRunAnnotationKey = "stackset-controller.zalando.org/adopt-dry-run"
+)
+
+// AdoptionVersion returns the version of the stack which should adopt an
+// existing Deployment and Service.
+func (ssc *StackSetContainer) AdoptionVersion() (string, bool) {
+	version, ok := ssc.StackSet.Annotations[AdoptStackAnnotationKey]
+	return version, ok && version != ""
+}
+
+// AdoptionDryRun returns true if the adoption should only be reported.
+func (ssc *StackSetContainer) AdoptionDryRun() bool {
+	return ssc.StackSet.Annotations[AdoptDryRunAnnotationKey] == "true"
+}
+
+// AdoptedStackName returns the name of the stack adopting the Deployment
+// and Service.
+func (ssc *StackSetContainer) AdoptedStackName(version string) string {
+	return generateStackName(ssc.StackSet, version)
+}
+
+// AdoptedResourceNames returns the names of the Deployment and the Service
+// adopted by the stack of the given version.
+func (ssc *StackSetContainer) AdoptedResourceNames(version string) (string, string) {
+	deployment := ssc.StackSet.Annotations[AdoptDeploymentAnnotationKey]
+	if deployment == "" {
+		deployment = ssc.AdoptedStackName(version)
+	}
+	service := ssc.StackSet.Annotations[AdoptServiceAnnotationKey]
+	if service == "" {
+		service = ssc.AdoptedStackName(version)
+	}
+	return deployment, service
+}
+
+// adoptionPending returns true if the resources should be adopted and the
+// StackSet has no stacks other than the one created by a previous, partially
+// completed adoption.
+func (ssc *StackSetContainer) adoptionPending() bool {
+	version, ok := ssc.AdoptionVersion()
+	if !ok {
+		return false
+	}
+	return len(ssc.StackContainers) == 0 || ssc.stackByName(ssc.AdoptedStackName(version)) != nil
+}
+
+// checkAdoptable returns an error if the resource is owned by anything other
+// than the given stack.
+func checkAdoptable(kind string, objectMeta metav1.ObjectMeta, stack *zv1.Stack) error {
+	for _, owner := range objectMeta.OwnerReferences {
+		if stack == nil || owner.UID != stack.UID {
+			return fmt.Errorf("unable to adopt %s %s: already owned by %s %s", kind, objectMeta.Name, owner.Kind, owner.Name)
+		}
+	}
+	return nil
+}
+
+// ResumeAdoption returns the stack of the given version if it was already
+// created by a previous adoption which failed before it was completed, so
+// the adoption can be resumed. It returns nil if there's no such stack.
+func (ssc *StackSetContainer) ResumeAdoption(version string, deployment *appsv1.Deployment, service *v1.Service) (*StackContainer, error) {
+	sc := ssc.stackByName(ssc.AdoptedStackName(version))
+	if sc == nil {
+		return nil, nil
+	}
+
+	if err := checkAdoptable("Deployment", deployment.ObjectMeta, sc.Stack); err != nil {
+		return nil, err
+	}
+	if service != nil {
+		if err := checkAdoptable("Service", service.ObjectMeta, sc.Stack); err != nil {
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// NewAdoptedStack returns the stack of the given version which adopts the
+// Deployment and the optional Service. The spec of the stack is derived from
+// the adopted resources.
+func (ssc *StackSetContainer) NewAdoptedStack(version string, deployment *appsv1.Deployment, service *v1.Service) (*StackContainer, error) {
+	if len(ssc.StackContainers) > 0 {
+		return nil, fmt.Errorf("unable to adopt resources of version %s: StackSet already has stacks", version)
+	}
+
+	if err := checkAdoptable("Deployment", deployment.ObjectMeta, nil); err != nil {
+		return nil, err
+	}
+
+	spec := zv1.StackSpec{
+		Replicas:        deployment.Spec.Replicas,
+		MinReadySeconds: deployment.Spec.MinReadySeconds,
+		PodTemplate: zv1.PodTemplateSpec{
+			EmbeddedObjectMeta: zv1.EmbeddedObjectMeta{
+				Labels:      deployment.Spec.Template.Labels,
+				Annotations: deployment.Spec.Template.Annotations,
+			},
+			Spec: deployment.Spec.Template.Spec,
+		},
+		Strategy: &deployment.Spec.Strategy,
+	}
+
+	if service != nil {
+		if err := checkAdoptable("Service", service.ObjectMeta, nil); err != nil {
+			return nil, err
+		}
+		spec.Service = sanitizeServicePorts(&zv1.StackServiceSpec{
+			Ports: service.Spec.Ports,
+		})
+	}
+
+	return &StackContainer{
+		Stack: ssc.newStackObject(version, nil, *spec.DeepCopy()),
+	}, nil
+}
+
+// OwnsAdoptedService returns true if the stack takes over the adopted
+// Service. Only a Service named like the stack is taken over, otherwise the
+// stack gets its own Service and the existing one is left in place.
+func (sc *StackContainer) OwnsAdoptedService(service *v1.Service) bool {
+	return service != nil && service.Name == sc.Name()
+}
+
+// AdoptObjectMeta updates the metadata of a resource adopted by the stack.
+// The selector labels of the stack are added so the resource is selected by
+// the stack Service and, if owned is set, the stack becomes its owner.
+func (sc *StackContainer) AdoptObjectMeta(objectMeta *metav1.ObjectMeta, owned bool) {
+	objectMeta.Labels = mergeLabels(objectMeta.Labels, sc.selector())
+	if owned {
+		objectMeta.OwnerReferences = sc.resourceMeta().OwnerReferences
+	}
+}
+
+// GenerateAdoptedStackSet returns the StackSet after the stack with the
+// given name adopted the existing resources. The adoption annotations are
+// removed and, if traffic is managed, all traffic is sent to the adopted
+// stack.
+func (ssc *StackSetContainer) GenerateAdoptedStackSet(stackName string) *zv1.StackSet {
+	result := ssc.StackSet.DeepCopy()
+	delete(result.Annotations, AdoptStackAnnotationKey)
+	delete(result.Annotations, AdoptDryRunAnnotationKey)
+	delete(result.Annotations, AdoptDeploymentAnnotationKey)
+	delete(result.Annotations, AdoptServiceAnnotationKey)
+
+	spec := result.Spec
+	if spec.Ingress != nil || spec.RouteGroup != nil || spec.ExternalIngress != nil {
+		result.Spec.Traffic = []*zv1.DesiredTraffic{
+			{
+				StackName: stackName,
+				Weight:    100,
+			},
+		}
+	}
+	return result
+}
@@ -0,0 +1,372 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func adoptionDeployment() *appsv1.Deployment {
+	replicas := int32(3)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo-v1",
+			Namespace: "bar",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas:        &replicas,
+			MinReadySeconds: 5,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"application": "foo"},
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"application": "foo"},
+				},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Name:  "foo",
+							Image: "foo:v1",
+						},
+					},
+				},
+			},
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			},
+		},
+	}
+}
+
+func TestNewAdoptedStack(t *testing.T) {
+	ownerReferences := []metav1.OwnerReference{{Kind: "Foo", Name: "foo"}}
+
+	for _, tc := range []struct {
+		name          string
+		stacks        map[types.UID]*StackContainer
+		deployment    *appsv1.Deployment
+		service       *v1.Service
+		expectedError string
+	}{
+		{
+			name:       "deployment without service",
+			deployment: adoptionDeployment(),
+		},
+		{
+			name:       "deployment and service",
+			deployment: adoptionDeployment(),
+			service: &v1.Service{
+				Spec: v1.ServiceSpec{
+					Ports: []v1.ServicePort{{Name: "http", Port: 80}},
+				},
+			},
+		},
+		{
+			name: "stackset with stacks",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v0": testStack("foo-v0").stack(),
+			},
+			deployment:    adoptionDeployment(),
+			expectedError: "unable to adopt resources of version v1: StackSet already has stacks",
+		},
+		{
+			name: "owned deployment",
+			deployment: func() *appsv1.Deployment {
+				deployment := adoptionDeployment()
+				deployment.OwnerReferences = ownerReferences
+				return deployment
+			}(),
+			expectedError: "unable to adopt Deployment foo-v1: already owned by Foo foo",
+		},
+		{
+			name:       "owned service",
+			deployment: adoptionDeployment(),
+			service: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "foo-v1",
+					OwnerReferences: ownerReferences,
+				},
+			},
+			expectedError: "unable to adopt Service foo-v1: already owned by Foo foo",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ssc := &StackSetContainer{
+				StackSet: &zv1.StackSet{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "bar",
+						UID:       "123",
+					},
+				},
+				StackContainers: tc.stacks,
+			}
+
+			stack, err := ssc.NewAdoptedStack("v1", tc.deployment, tc.service)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+
+			require.Equal(t, "foo-v1", stack.Name())
+			require.Equal(t, "bar", stack.Namespace())
+			require.Equal(t, map[string]string{StacksetHeritageLabelKey: "foo", StackVersionLabelKey: "v1"}, stack.Stack.Labels)
+			require.Equal(t, types.UID("123"), stack.Stack.OwnerReferences[0].UID)
+
+			spec := stack.Stack.Spec
+			require.Equal(t, tc.deployment.Spec.Replicas, spec.Replicas)
+			require.Equal(t, int32(5), spec.MinReadySeconds)
+			require.Equal(t, tc.deployment.Spec.Template.Labels, spec.PodTemplate.Labels)
+			require.Equal(t, tc.deployment.Spec.Template.Spec, spec.PodTemplate.Spec)
+			require.Equal(t, appsv1.RecreateDeploymentStrategyType, spec.Strategy.Type)
+			if tc.service == nil {
+				require.Nil(t, spec.Service)
+			} else {
+				require.Equal(t, []v1.ServicePort{{Name: "http", Port: 80, Protocol: v1.ProtocolTCP}}, spec.Service.Ports)
+			}
+		})
+	}
+}
+
+func TestAdoptedResourceNames(t *testing.T) {
+	ssc := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "foo",
+				Annotations: map[string]string{
+					AdoptStackAnnotationKey: "v1",
+				},
+			},
+		},
+	}
+
+	deployment, service := ssc.AdoptedResourceNames("v1")
+	require.Equal(t, "foo-v1", deployment)
+	require.Equal(t, "foo-v1", service)
+
+	ssc.StackSet.Annotations[AdoptDeploymentAnnotationKey] = "legacy-app"
+	ssc.StackSet.Annotations[AdoptServiceAnnotationKey] = "legacy-svc"
+	deployment, service = ssc.AdoptedResourceNames("v1")
+	require.Equal(t, "legacy-app", deployment)
+	require.Equal(t, "legacy-svc", service)
+}
+
+func TestResumeAdoption(t *testing.T) {
+	adoptedStack := testStack("foo-v1").stack()
+	adoptedStack.Stack.UID = "456"
+	ownedByStack := []metav1.OwnerReference{{Kind: KindStack, Name: "foo-v1", UID: "456"}}
+
+	for _, tc := range []struct {
+		name          string
+		stacks        map[types.UID]*StackContainer
+		deployment    *appsv1.Deployment
+		service       *v1.Service
+		expectedStack *StackContainer
+		expectedError string
+	}{
+		{
+			name:       "no stack created before",
+			stacks:     map[types.UID]*StackContainer{},
+			deployment: adoptionDeployment(),
+		},
+		{
+			name: "other stacks are not resumed",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v0": testStack("foo-v0").stack(),
+			},
+			deployment: adoptionDeployment(),
+		},
+		{
+			name: "stack created before",
+			stacks: map[types.UID]*StackContainer{
+				"456": adoptedStack,
+			},
+			deployment:    adoptionDeployment(),
+			expectedStack: adoptedStack,
+		},
+		{
+			name: "deployment already owned by the stack",
+			stacks: map[types.UID]*StackContainer{
+				"456": adoptedStack,
+			},
+			deployment: func() *appsv1.Deployment {
+				deployment := adoptionDeployment()
+				deployment.OwnerReferences = ownedByStack
+				return deployment
+			}(),
+			service: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "foo-v1",
+					OwnerReferences: ownedByStack,
+				},
+			},
+			expectedStack: adoptedStack,
+		},
+		{
+			name: "deployment owned by something else",
+			stacks: map[types.UID]*StackContainer{
+				"456": adoptedStack,
+			},
+			deployment: func() *appsv1.Deployment {
+				deployment := adoptionDeployment()
+				deployment.OwnerReferences = []metav1.OwnerReference{{Kind: "Foo", Name: "foo", UID: "789"}}
+				return deployment
+			}(),
+			expectedError: "unable to adopt Deployment foo-v1: already owned by Foo foo",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ssc := &StackSetContainer{
+				StackSet: &zv1.StackSet{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "bar",
+					},
+				},
+				StackContainers: tc.stacks,
+			}
+
+			stack, err := ssc.ResumeAdoption("v1", tc.deployment, tc.service)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedStack, stack)
+		})
+	}
+}
+
+func TestOwnsAdoptedService(t *testing.T) {
+	stack := testStack("foo-v1").stack()
+	require.False(t, stack.OwnsAdoptedService(nil))
+	require.True(t, stack.OwnsAdoptedService(&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo-v1"}}))
+	require.False(t, stack.OwnsAdoptedService(&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "legacy-app"}}))
+}
+
+func TestAdoptObjectMeta(t *testing.T) {
+	stack := testStack("foo-v1").stack()
+	stack.Stack.UID = "456"
+	stack.Stack.Labels = map[string]string{
+		StacksetHeritageLabelKey: "foo",
+		StackVersionLabelKey:     "v1",
+		"custom":                 "label",
+	}
+
+	pod := metav1.ObjectMeta{
+		Labels: map[string]string{"application": "foo"},
+	}
+	stack.AdoptObjectMeta(&pod, false)
+	require.Equal(t, map[string]string{
+		"application":            "foo",
+		StacksetHeritageLabelKey: "foo",
+		StackVersionLabelKey:     "v1",
+	}, pod.Labels)
+	require.Empty(t, pod.OwnerReferences)
+
+	deployment := metav1.ObjectMeta{}
+	stack.AdoptObjectMeta(&deployment, true)
+	require.Equal(t, []metav1.OwnerReference{
+		{
+			APIVersion: APIVersion,
+			Kind:       KindStack,
+			Name:       "foo-v1",
+			UID:        "456",
+		},
+	}, deployment.OwnerReferences)
+}
+
+func TestGenerateAdoptedStackSet(t *testing.T) {
+	stackset := &zv1.StackSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+			Annotations: map[string]string{
+				AdoptStackAnnotationKey:      "v1",
+				AdoptDryRunAnnotationKey:     "false",
+				AdoptDeploymentAnnotationKey: "legacy-app",
+				"custom":                     "annotation",
+			},
+		},
+	}
+	ssc := &StackSetContainer{StackSet: stackset}
+
+	result := ssc.GenerateAdoptedStackSet("foo-v1")
+	require.Equal(t, map[string]string{"custom": "annotation"}, result.Annotations)
+	require.Nil(t, result.Spec.Traffic)
+
+	stackset.Spec.Ingress = &zv1.StackSetIngressSpec{}
+	result = ssc.GenerateAdoptedStackSet("foo-v1")
+	require.Equal(t, []*zv1.DesiredTraffic{{StackName: "foo-v1", Weight: 100}}, result.Spec.Traffic)
+}
+
+func TestAdoptedDeploymentScaleTargets(t *testing.T) {
+	utilization := int32(80)
+	metrics := []zv1.AutoscalerMetrics{
+		{
+			Type:               zv1.CPUAutoscalerMetric,
+			AverageUtilization: &utilization,
+		},
+	}
+
+	for _, tc := range []struct {
+		name       string
+		deployment *appsv1.Deployment
+		expected   string
+	}{
+		{
+			name:     "deployment not created yet",
+			expected: "foo-v1",
+		},
+		{
+			name:       "deployment named like the stack",
+			deployment: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "foo-v1"}},
+			expected:   "foo-v1",
+		},
+		{
+			name:       "adopted deployment with another name",
+			deployment: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "legacy"}},
+			expected:   "legacy",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			container := &StackContainer{
+				Stack: &zv1.Stack{
+					ObjectMeta: testStackMeta,
+					Spec: zv1.StackSpec{
+						Autoscaler: &zv1.Autoscaler{
+							MaxReplicas: 10,
+							Metrics:     metrics,
+						},
+						VerticalPodAutoscaler: &zv1.VerticalPodAutoscaler{},
+					},
+				},
+				Resources: StackResources{Deployment: tc.deployment},
+			}
+
+			hpa, err := container.GenerateHPA()
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, hpa.Spec.ScaleTargetRef.Name)
+
+			vpa, err := container.GenerateVPA()
+			require.NoError(t, err)
+			name, _, err := unstructured.NestedString(vpa.Object, "spec", "targetRef", "name")
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, name)
+
+			container.Stack.Spec.Autoscaler.Engine = zv1.AutoscalerEngineKEDA
+			scaledObject, err := container.GenerateScaledObject()
+			require.NoError(t, err)
+			name, _, err = unstructured.NestedString(scaledObject.Object, "spec", "scaleTargetRef", "name")
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, name)
+		})
+	}
+}
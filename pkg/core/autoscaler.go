@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -31,7 +32,17 @@ const (
 	zmonCheckTagAnnotationPrefix = "metric-config.external.zmon-check.zmon/tag-"
 	sqsQueueNameTag              = "queue-name"
 	sqsQueueRegionTag            = "region"
+	kafkaConsumerLagName         = "kafka-consumer-lag"
+	kafkaConsumerLagQuery        = "sum(kafka_consumergroup_lag{topic=%s,consumergroup=%s})"
+	rabbitMQQueueLengthName      = "rabbitmq-queue-length"
+	rabbitMQQueueLengthQuery     = "sum(rabbitmq_queue_messages_ready{%s})"
 	scalingScheduleAPIVersion    = "zalando.org/v1"
+	prometheusQueryAnnotation    = "metric-config.external.%s.prometheus/query"
+	prometheusServerAnnotation   = "metric-config.external.%s.prometheus/prometheus-server"
+	prometheusMetricTypeTag      = "type"
+	prometheusMetricType         = "prometheus"
+	stackNameVar                 = "STACK_NAME"
+	stacksetNameVar              = "STACKSET_NAME"
 )
 
 var (
@@ -40,6 +51,10 @@ var (
 	errMissingClusterScalingScheduleDefinition = errors.New("missing ClusterScalingSchedule metric definition")
 	errMissingScalingScheduleName              = errors.New("missing ScalingSchedule metric object name")
 	errMissingClusterScalingScheduleName       = errors.New("missing ClusterScalingSchedule metric object name")
+	errMissingPrometheusDefinition             = errors.New("missing Prometheus metric definition")
+	errMissingMetricSpecDefinition             = errors.New("missing MetricSpec metric definition")
+
+	stackVarRegexp = regexp.MustCompile(`\$\(([^)]*)\)`)
 )
 
 type MetricsList []autoscaling.MetricSpec
@@ -71,6 +86,10 @@ func convertCustomMetrics(stacksetName, stackName, namespace string, metrics []z
 		switch m.Type {
 		case zv1.AmazonSQSAutoscalerMetric:
 			generated, err = sqsMetric(m)
+		case zv1.KafkaAutoscalerMetric:
+			generated, annotations, err = kafkaMetric(m)
+		case zv1.RabbitMQAutoscalerMetric:
+			generated, annotations, err = rabbitMQMetric(m)
 		case zv1.PodJSONAutoscalerMetric:
 			generated, annotations, err = podJsonMetric(m)
 		case zv1.IngressAutoscalerMetric:
@@ -87,6 +106,10 @@ func convertCustomMetrics(stacksetName, stackName, namespace string, metrics []z
 			generated, err = cpuMetric(m)
 		case zv1.MemoryAutoscalerMetric:
 			generated, err = memoryMetric(m)
+		case zv1.PrometheusAutoscalerMetric:
+			generated, annotations, err = prometheusMetric(m, stacksetName, stackName)
+		case zv1.MetricSpecAutoscalerMetric:
+			generated, err = metricSpecMetric(m, stacksetName, stackName)
 		default:
 			err = fmt.Errorf("metric type %s not supported", m.Type)
 		}
@@ -191,6 +214,48 @@ func sqsMetric(metrics zv1.AutoscalerMetrics) (*autoscaling.MetricSpec, error) {
 	return generated, nil
 }
 
+// kafkaMetric scales on the consumer lag of a topic as exported by
+// kafka_exporter (https://github.com/danielqsj/kafka_exporter), which is
+// queried through the Prometheus collector of kube-metrics-adapter.
+func kafkaMetric(metrics zv1.AutoscalerMetrics) (*autoscaling.MetricSpec, map[string]string, error) {
+	if metrics.Average == nil {
+		return nil, nil, fmt.Errorf("average not specified")
+	}
+	if metrics.Kafka == nil || metrics.Kafka.Topic == "" || metrics.Kafka.ConsumerGroup == "" {
+		return nil, nil, fmt.Errorf("kafka topic not specified correctly")
+	}
+	hash, err := metricHash(metrics.Kafka.Topic, metrics.Kafka.ConsumerGroup)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not hash metric name")
+	}
+	query := fmt.Sprintf(kafkaConsumerLagQuery, strconv.Quote(metrics.Kafka.Topic), strconv.Quote(metrics.Kafka.ConsumerGroup))
+	generated, annotations := prometheusExternalMetric(kafkaConsumerLagName+"-"+hash, query, "", metrics.Average)
+	return generated, annotations, nil
+}
+
+// rabbitMQMetric scales on the number of ready messages of a queue as exported
+// by rabbitmq_exporter (https://github.com/kbudde/rabbitmq_exporter), which
+// is queried through the Prometheus collector of kube-metrics-adapter.
+func rabbitMQMetric(metrics zv1.AutoscalerMetrics) (*autoscaling.MetricSpec, map[string]string, error) {
+	if metrics.Average == nil {
+		return nil, nil, fmt.Errorf("average not specified")
+	}
+	if metrics.RabbitMQ == nil || metrics.RabbitMQ.Queue == "" {
+		return nil, nil, fmt.Errorf("rabbitmq queue not specified correctly")
+	}
+	hash, err := metricHash(metrics.RabbitMQ.VHost, metrics.RabbitMQ.Queue)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not hash metric name")
+	}
+	selector := fmt.Sprintf("queue=%s", strconv.Quote(metrics.RabbitMQ.Queue))
+	if metrics.RabbitMQ.VHost != "" {
+		selector += fmt.Sprintf(",vhost=%s", strconv.Quote(metrics.RabbitMQ.VHost))
+	}
+	query := fmt.Sprintf(rabbitMQQueueLengthQuery, selector)
+	generated, annotations := prometheusExternalMetric(rabbitMQQueueLengthName+"-"+hash, query, "", metrics.Average)
+	return generated, annotations, nil
+}
+
 func podJsonMetric(metrics zv1.AutoscalerMetrics) (*autoscaling.MetricSpec, map[string]string, error) {
 	if metrics.Average == nil {
 		return nil, nil, fmt.Errorf("average is not specified for metric")
@@ -341,6 +406,133 @@ func zmonMetric(metrics zv1.AutoscalerMetrics, stackName, namespace string) (*au
 	return generated, annotations, nil
 }
 
+// expandStackVariables replaces the $(STACK_NAME) and $(STACKSET_NAME)
+// variables in the value with the names of the stack and the StackSet.
+func expandStackVariables(value, stacksetName, stackName string) (string, error) {
+	var err error
+	result := stackVarRegexp.ReplaceAllStringFunc(value, func(variable string) string {
+		switch stackVarRegexp.FindStringSubmatch(variable)[1] {
+		case stackNameVar:
+			return stackName
+		case stacksetNameVar:
+			return stacksetName
+		default:
+			err = fmt.Errorf("unknown variable %s", variable)
+			return variable
+		}
+	})
+	return result, err
+}
+
+// prometheusQuery returns the query of the Prometheus metric with the
+// $(STACK_NAME) and $(STACKSET_NAME) variables replaced.
+func prometheusQuery(metrics *zv1.MetricsPrometheus, stacksetName, stackName string) (string, error) {
+	query, err := expandStackVariables(metrics.Query, stacksetName, stackName)
+	if err != nil {
+		return "", fmt.Errorf("invalid query of metric %s: %w", metrics.Name, err)
+	}
+	return query, nil
+}
+
+func prometheusMetric(metrics zv1.AutoscalerMetrics, stacksetName, stackName string) (*autoscaling.MetricSpec, map[string]string, error) {
+	if metrics.Average == nil {
+		return nil, nil, fmt.Errorf("average not specified")
+	}
+
+	if metrics.Prometheus == nil {
+		return nil, nil, errMissingPrometheusDefinition
+	}
+	if metrics.Prometheus.Name == "" || metrics.Prometheus.Query == "" {
+		return nil, nil, fmt.Errorf("the Prometheus metric is not specified correctly")
+	}
+
+	query, err := prometheusQuery(metrics.Prometheus, stacksetName, stackName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	generated, annotations := prometheusExternalMetric(metrics.Prometheus.Name, query, metrics.Prometheus.Server, metrics.Average)
+	return generated, annotations, nil
+}
+
+// prometheusExternalMetric returns the External metric and the
+// kube-metrics-adapter annotations to scale on the result of a PromQL query.
+func prometheusExternalMetric(name, query, server string, target *resource.Quantity) (*autoscaling.MetricSpec, map[string]string) {
+	average := target.DeepCopy()
+	generated := &autoscaling.MetricSpec{
+		Type: autoscaling.ExternalMetricSourceType,
+		External: &autoscaling.ExternalMetricSource{
+			Metric: autoscaling.MetricIdentifier{
+				Name: name,
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{prometheusMetricTypeTag: prometheusMetricType},
+				},
+			},
+			Target: autoscaling.MetricTarget{
+				Type:         autoscaling.AverageValueMetricType,
+				AverageValue: &average,
+			},
+		},
+	}
+
+	annotations := map[string]string{
+		fmt.Sprintf(prometheusQueryAnnotation, name): query,
+	}
+	if server != "" {
+		annotations[fmt.Sprintf(prometheusServerAnnotation, name)] = server
+	}
+	return generated, annotations
+}
+
+// metricSpecMetric returns a copy of the MetricSpec of the metric with the
+// stack variables replaced in the values of its selectors.
+func metricSpecMetric(metrics zv1.AutoscalerMetrics, stacksetName, stackName string) (*autoscaling.MetricSpec, error) {
+	if metrics.MetricSpec == nil {
+		return nil, errMissingMetricSpecDefinition
+	}
+	generated := metrics.MetricSpec.DeepCopy()
+
+	var selector *metav1.LabelSelector
+	switch generated.Type {
+	case autoscaling.ExternalMetricSourceType:
+		if generated.External == nil {
+			return nil, fmt.Errorf("the External metric is not specified correctly")
+		}
+		selector = generated.External.Metric.Selector
+	case autoscaling.ObjectMetricSourceType:
+		if generated.Object == nil {
+			return nil, fmt.Errorf("the Object metric is not specified correctly")
+		}
+		selector = generated.Object.Metric.Selector
+	case autoscaling.PodsMetricSourceType:
+		if generated.Pods == nil {
+			return nil, fmt.Errorf("the Pods metric is not specified correctly")
+		}
+		selector = generated.Pods.Metric.Selector
+	}
+
+	if selector != nil {
+		for k, v := range selector.MatchLabels {
+			value, err := expandStackVariables(v, stacksetName, stackName)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of selector label %s: %w", k, err)
+			}
+			selector.MatchLabels[k] = value
+		}
+		for i := range selector.MatchExpressions {
+			requirement := &selector.MatchExpressions[i]
+			for j, v := range requirement.Values {
+				value, err := expandStackVariables(v, stacksetName, stackName)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value of selector label %s: %w", requirement.Key, err)
+				}
+				requirement.Values[j] = value
+			}
+		}
+	}
+	return generated, nil
+}
+
 func scalingScheduleMetric(metrics zv1.AutoscalerMetrics, stackName, namespace string) (*autoscaling.MetricSpec, error) {
 	if metrics.Average == nil {
 		return nil, fmt.Errorf("average not specified")
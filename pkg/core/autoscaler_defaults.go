@@ -0,0 +1,86 @@
+package core
+
+import (
+	"fmt"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	autoscaling "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// AutoscalerDefaultsConfigMapName is the name of the ConfigMap
+	// defining the autoscaler defaults of a namespace.
+	AutoscalerDefaultsConfigMapName = "stackset-autoscaler-defaults"
+	// AutoscalerDefaultsConfigMapKey is the key of the autoscaler
+	// defaults in the ConfigMap.
+	AutoscalerDefaultsConfigMapKey = "autoscaler"
+)
+
+// ParseAutoscalerDefaults returns the autoscaler defaults of a namespace
+// defined in the ConfigMap.
+func ParseAutoscalerDefaults(configMap *corev1.ConfigMap) (*zv1.AutoscalerDefaults, error) {
+	data, ok := configMap.Data[AutoscalerDefaultsConfigMapKey]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in ConfigMap %s/%s", AutoscalerDefaultsConfigMapKey, configMap.Namespace, configMap.Name)
+	}
+
+	var defaults zv1.AutoscalerDefaults
+	err := yaml.UnmarshalStrict([]byte(data), &defaults)
+	if err != nil {
+		return nil, fmt.Errorf("invalid autoscaler defaults in ConfigMap %s/%s: %v", configMap.Namespace, configMap.Name, err)
+	}
+	return &defaults, nil
+}
+
+// mergeAutoscalerDefaults returns a copy of the autoscaler with the fields
+// which aren't set taken from the defaults. The defaults are ordered by
+// precedence, the first one which sets a field wins. Metrics are only taken
+// as a whole and the behavior is merged separately for scaling up and down.
+func mergeAutoscalerDefaults(autoscaler *zv1.Autoscaler, defaults ...*zv1.AutoscalerDefaults) *zv1.Autoscaler {
+	result := autoscaler.DeepCopy()
+	for _, d := range defaults {
+		if d == nil {
+			continue
+		}
+		if result.MinReplicas == nil && d.MinReplicas != nil {
+			minReplicas := *d.MinReplicas
+			result.MinReplicas = &minReplicas
+		}
+		if result.MaxReplicas == 0 && d.MaxReplicas != nil {
+			result.MaxReplicas = *d.MaxReplicas
+		}
+		if len(result.Metrics) == 0 && len(d.Metrics) > 0 {
+			result.Metrics = make([]zv1.AutoscalerMetrics, 0, len(d.Metrics))
+			for _, m := range d.Metrics {
+				result.Metrics = append(result.Metrics, *m.DeepCopy())
+			}
+		}
+		if result.Engine == "" {
+			result.Engine = d.Engine
+		}
+		if d.Behavior != nil {
+			if result.Behavior == nil {
+				result.Behavior = &autoscaling.HorizontalPodAutoscalerBehavior{}
+			}
+			if result.Behavior.ScaleUp == nil {
+				result.Behavior.ScaleUp = d.Behavior.ScaleUp.DeepCopy()
+			}
+			if result.Behavior.ScaleDown == nil {
+				result.Behavior.ScaleDown = d.Behavior.ScaleDown.DeepCopy()
+			}
+		}
+	}
+	return result
+}
+
+// applyAutoscalerDefaults merges the autoscaler defaults of the StackSet and
+// the namespace into the autoscaler of the stack spec. Stacks without an
+// autoscaler are left as they are.
+func (ssc *StackSetContainer) applyAutoscalerDefaults(spec *zv1.StackSpec) {
+	if spec.Autoscaler == nil {
+		return
+	}
+	spec.Autoscaler = mergeAutoscalerDefaults(spec.Autoscaler, ssc.StackSet.Spec.AutoscalerDefaults, ssc.NamespaceAutoscalerDefaults)
+}
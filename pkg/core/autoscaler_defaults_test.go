@@ -0,0 +1,210 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	autoscaling "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMergeAutoscalerDefaults(t *testing.T) {
+	cpuMetrics := []zv1.AutoscalerMetrics{
+		{Type: zv1.CPUAutoscalerMetric, AverageUtilization: pint32(80)},
+	}
+	ingressMetrics := []zv1.AutoscalerMetrics{
+		{Type: zv1.IngressAutoscalerMetric},
+	}
+	scaleUp := &autoscaling.HPAScalingRules{StabilizationWindowSeconds: pint32(0)}
+	scaleDown := &autoscaling.HPAScalingRules{StabilizationWindowSeconds: pint32(300)}
+	templateScaleDown := &autoscaling.HPAScalingRules{StabilizationWindowSeconds: pint32(60)}
+
+	for _, tc := range []struct {
+		name       string
+		autoscaler *zv1.Autoscaler
+		defaults   []*zv1.AutoscalerDefaults
+		expected   *zv1.Autoscaler
+	}{
+		{
+			name:       "no defaults",
+			autoscaler: &zv1.Autoscaler{MaxReplicas: 10, Metrics: cpuMetrics},
+			defaults:   []*zv1.AutoscalerDefaults{nil, nil},
+			expected:   &zv1.Autoscaler{MaxReplicas: 10, Metrics: cpuMetrics},
+		},
+		{
+			name:       "empty autoscaler takes all defaults",
+			autoscaler: &zv1.Autoscaler{},
+			defaults: []*zv1.AutoscalerDefaults{
+				{
+					MinReplicas: pint32(2),
+					MaxReplicas: pint32(10),
+					Metrics:     cpuMetrics,
+					Engine:      zv1.AutoscalerEngineKEDA,
+					Behavior:    &autoscaling.HorizontalPodAutoscalerBehavior{ScaleDown: scaleDown},
+				},
+			},
+			expected: &zv1.Autoscaler{
+				MinReplicas: pint32(2),
+				MaxReplicas: 10,
+				Metrics:     cpuMetrics,
+				Engine:      zv1.AutoscalerEngineKEDA,
+				Behavior:    &autoscaling.HorizontalPodAutoscalerBehavior{ScaleDown: scaleDown},
+			},
+		},
+		{
+			name: "template fields take precedence",
+			autoscaler: &zv1.Autoscaler{
+				MinReplicas: pint32(3),
+				Metrics:     ingressMetrics,
+				Behavior:    &autoscaling.HorizontalPodAutoscalerBehavior{ScaleDown: templateScaleDown},
+			},
+			defaults: []*zv1.AutoscalerDefaults{
+				{
+					MinReplicas: pint32(2),
+					MaxReplicas: pint32(10),
+					Metrics:     cpuMetrics,
+					Behavior:    &autoscaling.HorizontalPodAutoscalerBehavior{ScaleUp: scaleUp, ScaleDown: scaleDown},
+				},
+			},
+			expected: &zv1.Autoscaler{
+				MinReplicas: pint32(3),
+				MaxReplicas: 10,
+				Metrics:     ingressMetrics,
+				Behavior:    &autoscaling.HorizontalPodAutoscalerBehavior{ScaleUp: scaleUp, ScaleDown: templateScaleDown},
+			},
+		},
+		{
+			name:       "the first defaults take precedence",
+			autoscaler: &zv1.Autoscaler{},
+			defaults: []*zv1.AutoscalerDefaults{
+				nil,
+				{MaxReplicas: pint32(20)},
+				{MinReplicas: pint32(2), MaxReplicas: pint32(10), Metrics: cpuMetrics},
+			},
+			expected: &zv1.Autoscaler{
+				MinReplicas: pint32(2),
+				MaxReplicas: 20,
+				Metrics:     cpuMetrics,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			original := tc.autoscaler.DeepCopy()
+			result := mergeAutoscalerDefaults(tc.autoscaler, tc.defaults...)
+			require.Equal(t, tc.expected, result)
+			require.Equal(t, original, tc.autoscaler)
+		})
+	}
+}
+
+func TestParseAutoscalerDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		data          map[string]string
+		expected      *zv1.AutoscalerDefaults
+		expectedError bool
+	}{
+		{
+			name: "valid defaults",
+			data: map[string]string{
+				AutoscalerDefaultsConfigMapKey: "minReplicas: 2\nmaxReplicas: 10\nmetrics:\n- type: CPU\n  averageUtilization: 80\n",
+			},
+			expected: &zv1.AutoscalerDefaults{
+				MinReplicas: pint32(2),
+				MaxReplicas: pint32(10),
+				Metrics: []zv1.AutoscalerMetrics{
+					{Type: zv1.CPUAutoscalerMetric, AverageUtilization: pint32(80)},
+				},
+			},
+		},
+		{
+			name:          "missing key",
+			data:          map[string]string{},
+			expectedError: true,
+		},
+		{
+			name: "unknown field",
+			data: map[string]string{
+				AutoscalerDefaultsConfigMapKey: "maxReplica: 10\n",
+			},
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defaults, err := ParseAutoscalerDefaults(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: AutoscalerDefaultsConfigMapName, Namespace: "default"},
+				Data:       tc.data,
+			})
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, defaults)
+		})
+	}
+}
+
+func TestNewStackAutoscalerDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		autoscaler         *zv1.Autoscaler
+		stacksetDefaults   *zv1.AutoscalerDefaults
+		namespaceDefaults  *zv1.AutoscalerDefaults
+		expectedAutoscaler *zv1.Autoscaler
+		expectedError      bool
+	}{
+		{
+			name:              "stacks without an autoscaler don't get one",
+			stacksetDefaults:  &zv1.AutoscalerDefaults{MaxReplicas: pint32(10)},
+			namespaceDefaults: &zv1.AutoscalerDefaults{MaxReplicas: pint32(20)},
+		},
+		{
+			name:               "stackset defaults take precedence over the namespace defaults",
+			autoscaler:         &zv1.Autoscaler{},
+			stacksetDefaults:   &zv1.AutoscalerDefaults{MaxReplicas: pint32(10)},
+			namespaceDefaults:  &zv1.AutoscalerDefaults{MinReplicas: pint32(2), MaxReplicas: pint32(20)},
+			expectedAutoscaler: &zv1.Autoscaler{MinReplicas: pint32(2), MaxReplicas: 10},
+		},
+		{
+			name:          "missing maxReplicas",
+			autoscaler:    &zv1.Autoscaler{},
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stackset := &zv1.StackSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+				Spec: zv1.StackSetSpec{
+					AutoscalerDefaults: tc.stacksetDefaults,
+					StackTemplate: zv1.StackTemplate{
+						Spec: zv1.StackSpecTemplate{
+							StackSpec: zv1.StackSpec{
+								Autoscaler: tc.autoscaler,
+							},
+							Version: "v1",
+						},
+					},
+				},
+			}
+			ssc := NewContainer(stackset, SimpleTrafficReconciler{}, "", nil)
+			ssc.NamespaceAutoscalerDefaults = tc.namespaceDefaults
+
+			sc, _, err := ssc.NewStack()
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, sc)
+			require.Equal(t, tc.expectedAutoscaler, sc.Stack.Spec.Autoscaler)
+
+			// The defaults don't cause a drift of the new stack
+			ssc.StackContainers[sc.Stack.UID] = sc
+			require.NoError(t, ssc.updateTemplateDrift())
+			require.Nil(t, ssc.TemplateDrift())
+		})
+	}
+}
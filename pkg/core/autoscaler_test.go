@@ -1,6 +1,8 @@
 package core
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -65,6 +67,34 @@ func generateAutoscalerSQS(minReplicas, maxReplicas, utilization int32, queueNam
 	)
 	return container
 }
+func generateAutoscalerKafka(minReplicas, maxReplicas, average int32, topic, consumerGroup string) StackContainer {
+	container := generateAutoscalerStub(minReplicas, maxReplicas)
+	container.Stack.Spec.Autoscaler.Metrics = append(
+		container.Stack.Spec.Autoscaler.Metrics, zv1.AutoscalerMetrics{
+			Type: zv1.KafkaAutoscalerMetric,
+			Kafka: &zv1.MetricsKafka{
+				Topic:         topic,
+				ConsumerGroup: consumerGroup,
+			},
+			Average: resource.NewQuantity(int64(average), resource.DecimalSI),
+		},
+	)
+	return container
+}
+func generateAutoscalerRabbitMQ(minReplicas, maxReplicas, average int32, queue, vhost string) StackContainer {
+	container := generateAutoscalerStub(minReplicas, maxReplicas)
+	container.Stack.Spec.Autoscaler.Metrics = append(
+		container.Stack.Spec.Autoscaler.Metrics, zv1.AutoscalerMetrics{
+			Type: zv1.RabbitMQAutoscalerMetric,
+			RabbitMQ: &zv1.MetricsRabbitMQ{
+				Queue: queue,
+				VHost: vhost,
+			},
+			Average: resource.NewQuantity(int64(average), resource.DecimalSI),
+		},
+	)
+	return container
+}
 func generateAutoscalerZMON(minReplicas, maxReplicas, utilization int32, checkID, key, application, duration string, aggregators []zv1.ZMONMetricAggregatorType) StackContainer {
 	container := generateAutoscalerStub(minReplicas, maxReplicas)
 	container.Stack.Spec.Autoscaler.Metrics = append(
@@ -113,6 +143,22 @@ func generateAutoscalerClusterScalingSchedule(minReplicas, maxReplicas, average
 	return container
 }
 
+func generateAutoscalerPrometheus(minReplicas, maxReplicas, average int32, name, query, server string) StackContainer {
+	container := generateAutoscalerStub(minReplicas, maxReplicas)
+	container.Stack.Spec.Autoscaler.Metrics = append(
+		container.Stack.Spec.Autoscaler.Metrics, zv1.AutoscalerMetrics{
+			Type: zv1.PrometheusAutoscalerMetric,
+			Prometheus: &zv1.MetricsPrometheus{
+				Name:   name,
+				Query:  query,
+				Server: server,
+			},
+			Average: resource.NewQuantity(int64(average), resource.DecimalSI),
+		},
+	)
+	return container
+}
+
 func generateAutoscalerPodJson(minReplicas, maxReplicas, utilization, port int32, name, path, key string) StackContainer {
 	container := generateAutoscalerStub(minReplicas, maxReplicas)
 	container.Stack.Spec.Autoscaler.Metrics = append(
@@ -221,6 +267,66 @@ func TestStackSetController_ReconcileAutoscalersSQS(t *testing.T) {
 	require.Equal(t, externalMetric.External.Target.AverageValue.Value(), int64(80))
 }
 
+func TestStackSetController_ReconcileAutoscalersKafka(t *testing.T) {
+	ssc := generateAutoscalerKafka(1, 10, 100, "events", "my-app")
+	hpa, err := ssc.GenerateHPA()
+	require.NoError(t, err, "failed to create an HPA")
+	require.NotNil(t, hpa, "hpa not generated")
+	require.Len(t, hpa.Spec.Metrics, 1, "expected HPA to have 1 metric. instead got %d", len(hpa.Spec.Metrics))
+	externalMetric := hpa.Spec.Metrics[0]
+	require.Equal(t, autoscaling.ExternalMetricSourceType, externalMetric.Type)
+	require.True(t, strings.HasPrefix(externalMetric.External.Metric.Name, "kafka-consumer-lag-"))
+	require.Equal(t, map[string]string{"type": "prometheus"}, externalMetric.External.Metric.Selector.MatchLabels)
+	require.Equal(t, int64(100), externalMetric.External.Target.AverageValue.Value())
+	queryAnnotation := fmt.Sprintf("metric-config.external.%s.prometheus/query", externalMetric.External.Metric.Name)
+	require.Equal(t, `sum(kafka_consumergroup_lag{topic="events",consumergroup="my-app"})`, hpa.Annotations[queryAnnotation])
+}
+
+func TestStackSetController_ReconcileAutoscalersRabbitMQ(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		vhost         string
+		expectedQuery string
+	}{
+		{
+			name:          "default vhost",
+			expectedQuery: `sum(rabbitmq_queue_messages_ready{queue="tasks"})`,
+		},
+		{
+			name:          "custom vhost",
+			vhost:         "/orders",
+			expectedQuery: `sum(rabbitmq_queue_messages_ready{queue="tasks",vhost="/orders"})`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ssc := generateAutoscalerRabbitMQ(1, 10, 30, "tasks", tc.vhost)
+			hpa, err := ssc.GenerateHPA()
+			require.NoError(t, err, "failed to create an HPA")
+			require.NotNil(t, hpa, "hpa not generated")
+			require.Len(t, hpa.Spec.Metrics, 1, "expected HPA to have 1 metric. instead got %d", len(hpa.Spec.Metrics))
+			externalMetric := hpa.Spec.Metrics[0]
+			require.Equal(t, autoscaling.ExternalMetricSourceType, externalMetric.Type)
+			require.True(t, strings.HasPrefix(externalMetric.External.Metric.Name, "rabbitmq-queue-length-"))
+			require.Equal(t, map[string]string{"type": "prometheus"}, externalMetric.External.Metric.Selector.MatchLabels)
+			require.Equal(t, int64(30), externalMetric.External.Target.AverageValue.Value())
+			queryAnnotation := fmt.Sprintf("metric-config.external.%s.prometheus/query", externalMetric.External.Metric.Name)
+			require.Equal(t, tc.expectedQuery, hpa.Annotations[queryAnnotation])
+		})
+	}
+}
+
+func TestQueueMetricsDistinctNames(t *testing.T) {
+	average := resource.MustParse("10")
+	metrics, annotations, err := convertCustomMetrics("stackset", "stack-name", "default", []zv1.AutoscalerMetrics{
+		{Type: zv1.KafkaAutoscalerMetric, Average: &average, Kafka: &zv1.MetricsKafka{Topic: "events", ConsumerGroup: "my-app"}},
+		{Type: zv1.KafkaAutoscalerMetric, Average: &average, Kafka: &zv1.MetricsKafka{Topic: "orders", ConsumerGroup: "my-app"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	require.NotEqual(t, metrics[0].External.Metric.Name, metrics[1].External.Metric.Name)
+	require.Len(t, annotations, 2)
+}
+
 func TestStackSetController_ReconcileAutoscalersPodJson(t *testing.T) {
 	ssc := generateAutoscalerPodJson(1, 10, 80, 8080, "current-load", "/metrics", "$.current-load.counter")
 	hpa, err := ssc.GenerateHPA()
@@ -287,6 +393,162 @@ func TestStackSetController_ReconcileAutoscalersZMON(t *testing.T) {
 	require.Equal(t, externalMetric.External.Target.AverageValue.Value(), int64(80))
 }
 
+func TestStackSetController_ReconcileAutoscalersPrometheus(t *testing.T) {
+	ssc := generateAutoscalerPrometheus(1, 10, 80, "requests", `scalar(sum(rate(requests{stackset="$(STACKSET_NAME)",stack="$(STACK_NAME)"}[1m])))`, "http://prometheus:9090")
+	hpa, err := ssc.GenerateHPA()
+	require.NoError(t, err, "failed to create an HPA")
+	require.NotNil(t, hpa, "hpa not generated")
+	require.Len(t, hpa.Spec.Metrics, 1, "expected HPA to have 1 metric. instead got %d", len(hpa.Spec.Metrics))
+	externalMetric := hpa.Spec.Metrics[0]
+	require.Equal(t, autoscaling.ExternalMetricSourceType, externalMetric.Type)
+	require.Equal(t, "requests", externalMetric.External.Metric.Name)
+	require.Equal(t, map[string]string{"type": "prometheus"}, externalMetric.External.Metric.Selector.MatchLabels)
+	require.Equal(t, int64(80), externalMetric.External.Target.AverageValue.Value())
+	require.Equal(t, `scalar(sum(rate(requests{stackset="stackset",stack="stackset-v1"}[1m])))`, hpa.Annotations["metric-config.external.requests.prometheus/query"])
+	require.Equal(t, "http://prometheus:9090", hpa.Annotations["metric-config.external.requests.prometheus/prometheus-server"])
+}
+
+func TestPrometheusMetricInvalid(t *testing.T) {
+	onemilli := resource.MustParse("1m")
+	for _, tc := range []struct {
+		name    string
+		metrics zv1.AutoscalerMetrics
+	}{
+		{
+			name:    "missing average",
+			metrics: zv1.AutoscalerMetrics{Type: zv1.PrometheusAutoscalerMetric, Prometheus: &zv1.MetricsPrometheus{Name: "foo", Query: "scalar(up)"}},
+		},
+		{
+			name:    "missing prometheus definition",
+			metrics: zv1.AutoscalerMetrics{Type: zv1.PrometheusAutoscalerMetric, Average: &onemilli},
+		},
+		{
+			name:    "missing query",
+			metrics: zv1.AutoscalerMetrics{Type: zv1.PrometheusAutoscalerMetric, Average: &onemilli, Prometheus: &zv1.MetricsPrometheus{Name: "foo"}},
+		},
+		{
+			name:    "unknown variable",
+			metrics: zv1.AutoscalerMetrics{Type: zv1.PrometheusAutoscalerMetric, Average: &onemilli, Prometheus: &zv1.MetricsPrometheus{Name: "foo", Query: "scalar(up{app=\"$(APP_NAME)\"})"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := prometheusMetric(tc.metrics, "stackset", "stack-name")
+			require.Errorf(t, err, "created metric with invalid configuration")
+		})
+	}
+}
+
+func TestStackSetController_ReconcileAutoscalersMetricSpec(t *testing.T) {
+	ssc := generateAutoscalerStub(1, 10)
+	ssc.Stack.Spec.Autoscaler.Metrics = []zv1.AutoscalerMetrics{
+		{
+			Type: zv1.MetricSpecAutoscalerMetric,
+			MetricSpec: &autoscaling.MetricSpec{
+				Type: autoscaling.ExternalMetricSourceType,
+				External: &autoscaling.ExternalMetricSource{
+					Metric: autoscaling.MetricIdentifier{
+						Name: "queue-depth",
+						Selector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{"stack": "$(STACK_NAME)"},
+							MatchExpressions: []metav1.LabelSelectorRequirement{
+								{
+									Key:      "stackset",
+									Operator: metav1.LabelSelectorOpIn,
+									Values:   []string{"$(STACKSET_NAME)"},
+								},
+							},
+						},
+					},
+					Target: autoscaling.MetricTarget{
+						Type:         autoscaling.AverageValueMetricType,
+						AverageValue: resource.NewQuantity(10, resource.DecimalSI),
+					},
+				},
+			},
+		},
+		{
+			Type: zv1.MetricSpecAutoscalerMetric,
+			MetricSpec: &autoscaling.MetricSpec{
+				Type: autoscaling.ObjectMetricSourceType,
+				Object: &autoscaling.ObjectMetricSource{
+					DescribedObject: autoscaling.CrossVersionObjectReference{
+						APIVersion: "v1",
+						Kind:       "Service",
+						Name:       "gateway",
+					},
+					Metric: autoscaling.MetricIdentifier{
+						Name: "connections",
+					},
+					Target: autoscaling.MetricTarget{
+						Type:  autoscaling.ValueMetricType,
+						Value: resource.NewQuantity(100, resource.DecimalSI),
+					},
+				},
+			},
+		},
+	}
+
+	hpa, err := ssc.GenerateHPA()
+	require.NoError(t, err, "failed to create an HPA")
+	require.NotNil(t, hpa, "hpa not generated")
+	require.Len(t, hpa.Spec.Metrics, 2, "expected HPA to have 2 metrics. instead got %d", len(hpa.Spec.Metrics))
+
+	externalMetric := hpa.Spec.Metrics[0]
+	require.Equal(t, autoscaling.ExternalMetricSourceType, externalMetric.Type)
+	require.Equal(t, "queue-depth", externalMetric.External.Metric.Name)
+	require.Equal(t, map[string]string{"stack": "stackset-v1"}, externalMetric.External.Metric.Selector.MatchLabels)
+	require.Equal(t, []string{"stackset"}, externalMetric.External.Metric.Selector.MatchExpressions[0].Values)
+
+	objectMetric := hpa.Spec.Metrics[1]
+	require.Equal(t, autoscaling.ObjectMetricSourceType, objectMetric.Type)
+	require.Equal(t, "gateway", objectMetric.Object.DescribedObject.Name)
+	require.Nil(t, objectMetric.Object.Metric.Selector)
+
+	// The spec of the stack isn't modified
+	require.Equal(t, "$(STACK_NAME)", ssc.Stack.Spec.Autoscaler.Metrics[0].MetricSpec.External.Metric.Selector.MatchLabels["stack"])
+}
+
+func TestMetricSpecMetricInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		metrics zv1.AutoscalerMetrics
+	}{
+		{
+			name:    "missing metric spec",
+			metrics: zv1.AutoscalerMetrics{Type: zv1.MetricSpecAutoscalerMetric},
+		},
+		{
+			name: "missing external metric",
+			metrics: zv1.AutoscalerMetrics{
+				Type:       zv1.MetricSpecAutoscalerMetric,
+				MetricSpec: &autoscaling.MetricSpec{Type: autoscaling.ExternalMetricSourceType},
+			},
+		},
+		{
+			name: "unknown variable",
+			metrics: zv1.AutoscalerMetrics{
+				Type: zv1.MetricSpecAutoscalerMetric,
+				MetricSpec: &autoscaling.MetricSpec{
+					Type: autoscaling.PodsMetricSourceType,
+					Pods: &autoscaling.PodsMetricSource{
+						Metric: autoscaling.MetricIdentifier{
+							Name: "foo",
+							Selector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{"app": "$(APP_NAME)"},
+							},
+						},
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := metricSpecMetric(tc.metrics, "stackset", "stack-name")
+			require.Errorf(t, err, "created metric with invalid configuration")
+		})
+	}
+}
+
 func TestStackSetController_ReconcileAutoscalersScalingSchedule(t *testing.T) {
 	average := 80
 	name := "scaling-schedule-name"
@@ -376,6 +638,44 @@ func TestPodJsonMetricInvalid(t *testing.T) {
 	}
 }
 
+func TestQueueMetricsInvalid(t *testing.T) {
+	onemilli := resource.MustParse("1m")
+	for _, tc := range []struct {
+		name    string
+		metrics zv1.AutoscalerMetrics
+	}{
+		{
+			name:    "kafka missing average",
+			metrics: zv1.AutoscalerMetrics{Type: zv1.KafkaAutoscalerMetric, Kafka: &zv1.MetricsKafka{Topic: "events", ConsumerGroup: "my-app"}},
+		},
+		{
+			name:    "kafka missing definition",
+			metrics: zv1.AutoscalerMetrics{Type: zv1.KafkaAutoscalerMetric, Average: &onemilli},
+		},
+		{
+			name:    "kafka missing consumer group",
+			metrics: zv1.AutoscalerMetrics{Type: zv1.KafkaAutoscalerMetric, Average: &onemilli, Kafka: &zv1.MetricsKafka{Topic: "events"}},
+		},
+		{
+			name:    "rabbitmq missing average",
+			metrics: zv1.AutoscalerMetrics{Type: zv1.RabbitMQAutoscalerMetric, RabbitMQ: &zv1.MetricsRabbitMQ{Queue: "tasks"}},
+		},
+		{
+			name:    "rabbitmq missing definition",
+			metrics: zv1.AutoscalerMetrics{Type: zv1.RabbitMQAutoscalerMetric, Average: &onemilli},
+		},
+		{
+			name:    "rabbitmq missing queue",
+			metrics: zv1.AutoscalerMetrics{Type: zv1.RabbitMQAutoscalerMetric, Average: &onemilli, RabbitMQ: &zv1.MetricsRabbitMQ{VHost: "orders"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := convertCustomMetrics("stackset", "stack-name", "default", []zv1.AutoscalerMetrics{tc.metrics})
+			require.Errorf(t, err, "created metric with invalid configuration")
+		})
+	}
+}
+
 func TestZMONMetricInvalid(t *testing.T) {
 	onemilli := resource.MustParse("1m")
 	for _, tc := range []struct {
@@ -0,0 +1,148 @@
+package core
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// SecretSourceAnnotationKey is the annotation of a stack's copy of a
+	// Secret containing the name of the Secret it's copied from.
+	SecretSourceAnnotationKey = "stackset-controller.zalando.org/secret-source"
+)
+
+// configResourceName returns the name of the stack's copy of a ConfigMap or
+// Secret.
+func (sc *StackContainer) configResourceName(name string) string {
+	return sc.Name() + "-" + name
+}
+
+// GenerateConfigMaps returns the stack's copies of the ConfigMaps defined in
+// the stack spec.
+func (sc *StackContainer) GenerateConfigMaps() []*v1.ConfigMap {
+	var result []*v1.ConfigMap
+	for _, template := range sc.Stack.Spec.ConfigMaps {
+		template := template.DeepCopy()
+
+		objectMeta := sc.resourceMeta()
+		objectMeta.Name = sc.configResourceName(template.Name)
+		objectMeta.Labels = mergeLabels(template.Labels, objectMeta.Labels)
+		objectMeta.Annotations = mergeLabels(template.Annotations, objectMeta.Annotations)
+
+		result = append(result, &v1.ConfigMap{
+			ObjectMeta: objectMeta,
+			Data:       template.Data,
+			BinaryData: template.BinaryData,
+		})
+	}
+	return result
+}
+
+// GenerateSecrets returns the stack's copies of the Secrets referenced in
+// the stack spec without their data. The name of the copied Secret is stored
+// in the SecretSourceAnnotationKey annotation, its data is only copied once
+// the copy is created, so later changes don't affect existing stacks.
+func (sc *StackContainer) GenerateSecrets() []*v1.Secret {
+	var result []*v1.Secret
+	for _, template := range sc.Stack.Spec.Secrets {
+		template := template.DeepCopy()
+
+		source := template.SecretName
+		if source == "" {
+			source = template.Name
+		}
+
+		objectMeta := sc.resourceMeta()
+		objectMeta.Name = sc.configResourceName(template.Name)
+		objectMeta.Labels = mergeLabels(template.Labels, objectMeta.Labels)
+		objectMeta.Annotations = mergeLabels(template.Annotations, objectMeta.Annotations)
+		objectMeta.Annotations[SecretSourceAnnotationKey] = source
+
+		result = append(result, &v1.Secret{
+			ObjectMeta: objectMeta,
+		})
+	}
+	return result
+}
+
+// CopySecretData copies the type and the data of the source Secret to the
+// stack's copy.
+func CopySecretData(secret, source *v1.Secret) {
+	secret.Type = source.Type
+	secret.Data = make(map[string][]byte, len(source.Data))
+	for key, value := range source.Data {
+		secret.Data[key] = append([]byte(nil), value...)
+	}
+}
+
+// rewriteConfigReferences rewrites the references to the ConfigMaps and
+// Secrets defined in the stack spec to the stack's copies.
+func (sc *StackContainer) rewriteConfigReferences(podSpec *v1.PodSpec) {
+	if len(sc.Stack.Spec.ConfigMaps) == 0 && len(sc.Stack.Spec.Secrets) == 0 {
+		return
+	}
+
+	configMaps := make(map[string]string, len(sc.Stack.Spec.ConfigMaps))
+	for _, configMap := range sc.Stack.Spec.ConfigMaps {
+		configMaps[configMap.Name] = sc.configResourceName(configMap.Name)
+	}
+	secrets := make(map[string]string, len(sc.Stack.Spec.Secrets))
+	for _, secret := range sc.Stack.Spec.Secrets {
+		secrets[secret.Name] = sc.configResourceName(secret.Name)
+	}
+
+	rewrite := func(name *string, names map[string]string) {
+		if updated, ok := names[*name]; ok {
+			*name = updated
+		}
+	}
+
+	for i := range podSpec.Volumes {
+		volume := &podSpec.Volumes[i]
+		if volume.ConfigMap != nil {
+			rewrite(&volume.ConfigMap.Name, configMaps)
+		}
+		if volume.Secret != nil {
+			rewrite(&volume.Secret.SecretName, secrets)
+		}
+		if volume.Projected != nil {
+			for j := range volume.Projected.Sources {
+				source := &volume.Projected.Sources[j]
+				if source.ConfigMap != nil {
+					rewrite(&source.ConfigMap.Name, configMaps)
+				}
+				if source.Secret != nil {
+					rewrite(&source.Secret.Name, secrets)
+				}
+			}
+		}
+	}
+
+	rewriteContainers := func(containers []v1.Container) {
+		for i := range containers {
+			container := &containers[i]
+			for j := range container.EnvFrom {
+				envFrom := &container.EnvFrom[j]
+				if envFrom.ConfigMapRef != nil {
+					rewrite(&envFrom.ConfigMapRef.Name, configMaps)
+				}
+				if envFrom.SecretRef != nil {
+					rewrite(&envFrom.SecretRef.Name, secrets)
+				}
+			}
+			for j := range container.Env {
+				valueFrom := container.Env[j].ValueFrom
+				if valueFrom == nil {
+					continue
+				}
+				if valueFrom.ConfigMapKeyRef != nil {
+					rewrite(&valueFrom.ConfigMapKeyRef.Name, configMaps)
+				}
+				if valueFrom.SecretKeyRef != nil {
+					rewrite(&valueFrom.SecretKeyRef.Name, secrets)
+				}
+			}
+		}
+	}
+	rewriteContainers(podSpec.InitContainers)
+	rewriteContainers(podSpec.Containers)
+}
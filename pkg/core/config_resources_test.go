@@ -0,0 +1,148 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func configResourcesStack() *StackContainer {
+	stack := testStack("foo-v1").stack()
+	stack.Stack.Namespace = "bar"
+	stack.Stack.UID = "456"
+	stack.Stack.Generation = 2
+	stack.Stack.Labels = map[string]string{
+		StacksetHeritageLabelKey: "foo",
+		StackVersionLabelKey:     "v1",
+	}
+	stack.Stack.Spec.ConfigMaps = []zv1.StackConfigMap{
+		{
+			EmbeddedObjectMeta: zv1.EmbeddedObjectMeta{
+				Labels: map[string]string{"config": "label"},
+			},
+			Name: "config",
+			Data: map[string]string{"key": "value"},
+		},
+	}
+	stack.Stack.Spec.Secrets = []zv1.StackSecret{
+		{
+			Name:       "credentials",
+			SecretName: "shared-credentials",
+		},
+	}
+	return stack
+}
+
+func TestGenerateConfigResources(t *testing.T) {
+	stack := configResourcesStack()
+
+	expectedMeta := func(name string) metav1.ObjectMeta {
+		objectMeta := stack.resourceMeta()
+		objectMeta.Name = name
+		return objectMeta
+	}
+
+	configMapMeta := expectedMeta("foo-v1-config")
+	configMapMeta.Labels["config"] = "label"
+	require.Equal(t, []*v1.ConfigMap{
+		{
+			ObjectMeta: configMapMeta,
+			Data:       map[string]string{"key": "value"},
+		},
+	}, stack.GenerateConfigMaps())
+
+	secretMeta := expectedMeta("foo-v1-credentials")
+	secretMeta.Annotations[SecretSourceAnnotationKey] = "shared-credentials"
+	require.Equal(t, []*v1.Secret{
+		{
+			ObjectMeta: secretMeta,
+		},
+	}, stack.GenerateSecrets())
+
+	// The Secret defaults to the name used in the pod template
+	stack.Stack.Spec.Secrets[0].SecretName = ""
+	require.Equal(t, "credentials", stack.GenerateSecrets()[0].Annotations[SecretSourceAnnotationKey])
+
+	stack.Stack.Spec.ConfigMaps = nil
+	stack.Stack.Spec.Secrets = nil
+	require.Empty(t, stack.GenerateConfigMaps())
+	require.Empty(t, stack.GenerateSecrets())
+}
+
+func TestCopySecretData(t *testing.T) {
+	source := &v1.Secret{
+		Type: v1.SecretTypeTLS,
+		Data: map[string][]byte{"tls.key": []byte("key")},
+	}
+	secret := &v1.Secret{}
+	CopySecretData(secret, source)
+	require.Equal(t, v1.SecretTypeTLS, secret.Type)
+	require.Equal(t, map[string][]byte{"tls.key": []byte("key")}, secret.Data)
+
+	// The copy doesn't change with the source
+	source.Data["tls.key"][0] = 'x'
+	require.Equal(t, []byte("key"), secret.Data["tls.key"])
+}
+
+func TestRewriteConfigReferences(t *testing.T) {
+	podSpec := func(configMap, secret string) v1.PodSpec {
+		container := v1.Container{
+			Name: "foo",
+			EnvFrom: []v1.EnvFromSource{
+				{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: configMap}}},
+				{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: secret}}},
+				{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "shared"}}},
+			},
+			Env: []v1.EnvVar{
+				{Name: "PLAIN", Value: "value"},
+				{
+					Name: "KEY",
+					ValueFrom: &v1.EnvVarSource{
+						ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: configMap}, Key: "key"},
+					},
+				},
+				{
+					Name: "PASSWORD",
+					ValueFrom: &v1.EnvVarSource{
+						SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: secret}, Key: "password"},
+					},
+				},
+			},
+		}
+		return v1.PodSpec{
+			InitContainers: []v1.Container{container},
+			Containers:     []v1.Container{container},
+			Volumes: []v1.Volume{
+				{
+					Name:         "config",
+					VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: configMap}}},
+				},
+				{
+					Name:         "credentials",
+					VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: secret}},
+				},
+				{
+					Name: "projected",
+					VolumeSource: v1.VolumeSource{
+						Projected: &v1.ProjectedVolumeSource{
+							Sources: []v1.VolumeProjection{
+								{ConfigMap: &v1.ConfigMapProjection{LocalObjectReference: v1.LocalObjectReference{Name: configMap}}},
+								{Secret: &v1.SecretProjection{LocalObjectReference: v1.LocalObjectReference{Name: secret}}},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	stack := configResourcesStack()
+	stack.Stack.Spec.PodTemplate.Spec = podSpec("config", "credentials")
+
+	deployment := stack.GenerateDeployment()
+	require.Equal(t, podSpec("foo-v1-config", "foo-v1-credentials"), deployment.Spec.Template.Spec)
+	require.Equal(t, podSpec("config", "credentials"), stack.Stack.Spec.PodTemplate.Spec)
+}
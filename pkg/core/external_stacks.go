@@ -0,0 +1,82 @@
+package core
+
+import (
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newExternalStackContainer returns a container for a stack of another
+// StackSet which can get traffic from the StackSet. The stack isn't managed
+// by the StackSet, its replicas are taken from the status written by its own
+// StackSet.
+func newExternalStackContainer(source *StackContainer) *StackContainer {
+	stack := source.Stack.DeepCopy()
+	return &StackContainer{
+		Stack:              stack,
+		external:           true,
+		stackReplicas:      effectiveReplicas(stack.Spec.Replicas),
+		deploymentReplicas: stack.Status.DesiredReplicas,
+		createdReplicas:    stack.Status.Replicas,
+		readyReplicas:      stack.Status.ReadyReplicas,
+		updatedReplicas:    stack.Status.UpdatedReplicas,
+		resourcesUpdated:   true,
+	}
+}
+
+// LinkExternalStackSets adds the stacks of the external StackSets of each
+// StackSet to its ExternalStackContainers. Stacks getting traffic from
+// another StackSet are marked, so that they're not scaled down or deleted
+// by their own StackSet.
+func LinkExternalStackSets(stacksets map[types.UID]*StackSetContainer) {
+	byName := make(map[types.NamespacedName]*StackSetContainer, len(stacksets))
+	for _, ssc := range stacksets {
+		byName[types.NamespacedName{Namespace: ssc.StackSet.Namespace, Name: ssc.StackSet.Name}] = ssc
+	}
+
+	for _, ssc := range stacksets {
+		if len(ssc.StackSet.Spec.ExternalStackSets) == 0 {
+			continue
+		}
+
+		trafficStacks := make(map[string]struct{})
+		for _, desired := range ssc.StackSet.Spec.Traffic {
+			if desired.Weight > 0 {
+				trafficStacks[desired.StackName] = struct{}{}
+			}
+		}
+		for _, actual := range ssc.StackSet.Status.Traffic {
+			if actual.Weight > 0 {
+				trafficStacks[actual.ServiceName] = struct{}{}
+			}
+		}
+
+		for _, name := range ssc.StackSet.Spec.ExternalStackSets {
+			external, ok := byName[types.NamespacedName{Namespace: ssc.StackSet.Namespace, Name: name}]
+			if !ok || external == ssc {
+				continue
+			}
+
+			if ssc.ExternalStackContainers == nil {
+				ssc.ExternalStackContainers = make(map[types.UID]*StackContainer, len(external.StackContainers))
+			}
+			for uid, sc := range external.StackContainers {
+				ssc.ExternalStackContainers[uid] = newExternalStackContainer(sc)
+				if _, ok := trafficStacks[sc.Name()]; ok {
+					sc.externalTraffic = true
+				}
+			}
+		}
+	}
+}
+
+// trafficStackContainers returns the stacks of the StackSet together with
+// the stacks of the external StackSets, which share its traffic.
+func (ssc *StackSetContainer) trafficStackContainers() []*StackContainer {
+	result := make([]*StackContainer, 0, len(ssc.StackContainers)+len(ssc.ExternalStackContainers))
+	for _, sc := range ssc.StackContainers {
+		result = append(result, sc)
+	}
+	for _, sc := range ssc.ExternalStackContainers {
+		result = append(result, sc)
+	}
+	return result
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func testExternalStack(name string, desiredReplicas, readyReplicas int32) *StackContainer {
+	return &StackContainer{
+		Stack: &zv1.Stack{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "bar",
+			},
+			Status: zv1.StackStatus{
+				DesiredReplicas: desiredReplicas,
+				Replicas:        desiredReplicas,
+				UpdatedReplicas: readyReplicas,
+				ReadyReplicas:   readyReplicas,
+			},
+		},
+	}
+}
+
+func testExternalStackSets(readyReplicas int32) (*StackSetContainer, *StackSetContainer) {
+	stackset := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "bar",
+			},
+			Spec: zv1.StackSetSpec{
+				RouteGroup: &zv1.RouteGroupSpec{
+					Hosts:       []string{"example.org"},
+					BackendPort: int(testPort),
+				},
+				ExternalStackSets: []string{"baz", "missing"},
+				Traffic: []*zv1.DesiredTraffic{
+					{StackName: "foo-v1", Weight: 50},
+					{StackName: "baz-v1", Weight: 50},
+				},
+			},
+			Status: zv1.StackSetStatus{
+				Traffic: []*zv1.ActualTraffic{
+					{ServiceName: "foo-v1", Weight: 100},
+				},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"foo-v1": testStack("foo-v1").ready(3).stack(),
+		},
+	}
+	external := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "baz",
+				Namespace: "bar",
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"baz-v1": testExternalStack("baz-v1", 3, readyReplicas),
+			"baz-v2": testExternalStack("baz-v2", 3, 3),
+		},
+	}
+	return stackset, external
+}
+
+func TestLinkExternalStackSets(t *testing.T) {
+	stackset, external := testExternalStackSets(3)
+	otherNamespace := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "qux",
+				Namespace: "other",
+			},
+			Spec: zv1.StackSetSpec{
+				ExternalStackSets: []string{"baz"},
+			},
+		},
+	}
+
+	LinkExternalStackSets(map[types.UID]*StackSetContainer{
+		"foo": stackset,
+		"baz": external,
+		"qux": otherNamespace,
+	})
+
+	require.Len(t, stackset.ExternalStackContainers, 2)
+	linked := stackset.ExternalStackContainers["baz-v1"]
+	require.True(t, linked.external)
+	require.EqualValues(t, 3, linked.deploymentReplicas)
+	require.EqualValues(t, 3, linked.readyReplicas)
+	require.NotSame(t, external.StackContainers["baz-v1"].Stack, linked.Stack)
+
+	// Only the stacks getting traffic from the other StackSet are kept
+	// from being scaled down
+	require.True(t, external.StackContainers["baz-v1"].HasTraffic())
+	require.False(t, external.StackContainers["baz-v2"].HasTraffic())
+
+	require.Empty(t, otherNamespace.ExternalStackContainers)
+	require.Empty(t, external.ExternalStackContainers)
+}
+
+func TestExternalStackSetTrafficSwitch(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		readyReplicas   int32
+		expectedError   string
+		expectedWeights map[string]float64
+	}{
+		{
+			name:          "traffic is not switched to a stack which is not ready",
+			readyReplicas: 1,
+			expectedError: "stacks not ready: baz-v1",
+			expectedWeights: map[string]float64{
+				"foo-v1": 100,
+				"baz-v1": 0,
+			},
+		},
+		{
+			name:          "traffic is switched to a ready stack",
+			readyReplicas: 3,
+			expectedWeights: map[string]float64{
+				"foo-v1": 50,
+				"baz-v1": 50,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stackset, external := testExternalStackSets(tc.readyReplicas)
+			stackset.TrafficReconciler = SimpleTrafficReconciler{}
+			LinkExternalStackSets(map[types.UID]*StackSetContainer{
+				"foo": stackset,
+				"baz": external,
+			})
+
+			err := stackset.UpdateFromResources()
+			require.NoError(t, err)
+
+			err = stackset.ManageTraffic(time.Now())
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+
+			weights := make(map[string]float64)
+			for _, sc := range stackset.trafficStackContainers() {
+				if _, ok := tc.expectedWeights[sc.Name()]; ok {
+					weights[sc.Name()] = sc.actualTrafficWeight
+				}
+			}
+			require.Equal(t, tc.expectedWeights, weights)
+
+			routegroup, err := stackset.GenerateRouteGroup()
+			require.NoError(t, err)
+			var defaultBackends []rgv1.RouteGroupBackendReference
+			for name, weight := range tc.expectedWeights {
+				if weight > 0 {
+					defaultBackends = append(defaultBackends, rgv1.RouteGroupBackendReference{
+						BackendName: name,
+						Weight:      int(weight),
+					})
+				}
+			}
+			require.ElementsMatch(t, defaultBackends, routegroup.Spec.DefaultBackends)
+			require.Len(t, routegroup.Spec.Backends, 3)
+
+			// The stacks of the external StackSet are part of the
+			// traffic, but not of the stacks of the StackSet
+			status := stackset.GenerateStackSetStatus()
+			require.EqualValues(t, 1, status.Stacks)
+			require.Len(t, status.Traffic, 3)
+			require.Len(t, stackset.GenerateStackSetTraffic(), 2)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"fmt"
+	"hash/fnv"
 	"strconv"
 	"time"
 
@@ -16,6 +18,24 @@ const (
 	stackGenerationAnnotationKey = "stackset-controller.zalando.org/stack-generation"
 )
 
+// maxResourceNameLength is the maximum length of the names of generated
+// resources whose name is also used as a label value, e.g. by Jobs.
+const maxResourceNameLength = 63
+
+// truncatedResourceName returns the name if it's short enough to be used as
+// a label value, otherwise it's truncated and suffixed with a hash of the
+// full name to keep it unique.
+func truncatedResourceName(name string) string {
+	if len(name) <= maxResourceNameLength {
+		return name
+	}
+
+	hasher := fnv.New32a()
+	_, _ = hasher.Write([]byte(name))
+	suffix := fmt.Sprintf("-%08x", hasher.Sum32())
+	return name[:maxResourceNameLength-len(suffix)] + suffix
+}
+
 func mergeLabels(labelMaps ...map[string]string) map[string]string {
 	labels := make(map[string]string)
 	for _, labelMap := range labelMaps {
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// HookLabelKey is the label used to identify the hook a Job was
+	// created for.
+	HookLabelKey = "stackset-controller.zalando.org/hook"
+	// HookRetryAnnotationKey is the annotation of a stack which retries its
+	// failed hooks whenever its value is changed.
+	HookRetryAnnotationKey = "stackset-controller.zalando.org/hook-retry"
+
+	PreTrafficHook  = "pre-traffic"
+	PostTrafficHook = "post-traffic"
+
+	hookReasonSucceeded = "JobSucceeded"
+	hookReasonFailed    = "JobFailed"
+	hookReasonRunning   = "JobRunning"
+
+	hookEnvStackName        = "STACK_NAME"
+	hookEnvStackSetName     = "STACKSET_NAME"
+	hookEnvStackServiceName = "STACK_SERVICE_NAME"
+	hookEnvStackHostnames   = "STACK_HOSTNAMES"
+)
+
+// hookJobStatus returns the state of a hook Job expressed as condition
+// status, reason and message.
+func hookJobStatus(job *batchv1.Job) (metav1.ConditionStatus, string, string) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return metav1.ConditionTrue, hookReasonSucceeded, fmt.Sprintf("Job %s completed", job.Name)
+		case batchv1.JobFailed:
+			// the UID identifies the Job of a retry which failed again
+			return metav1.ConditionFalse, hookReasonFailed, fmt.Sprintf("Job %s (%s) failed: %s", job.Name, job.UID, condition.Message)
+		}
+	}
+	return metav1.ConditionUnknown, hookReasonRunning, fmt.Sprintf("Job %s is running", job.Name)
+}
+
+// perStackHostnames returns the hostnames of the per-stack ingress and
+// routegroup.
+func (sc *StackContainer) perStackHostnames() ([]string, error) {
+	result := sets.NewString()
+
+	if sc.HasBackendPort() && sc.ingressSpec != nil && sc.Stack.Spec.IngressOverrides.IsEnabled() {
+		hostnames, err := sc.stackHostnames(sc.ingressSpec, sc.Stack.Spec.IngressOverrides)
+		if err != nil {
+			return nil, err
+		}
+		result.Insert(hostnames...)
+	}
+
+	if sc.HasBackendPort() && sc.routeGroupSpec != nil && sc.Stack.Spec.RouteGroupOverrides.IsEnabled() {
+		hostnames, err := sc.stackHostnames(sc.routeGroupSpec, sc.Stack.Spec.RouteGroupOverrides)
+		if err != nil {
+			return nil, err
+		}
+		result.Insert(hostnames...)
+	}
+
+	return result.List(), nil
+}
+
+// GeneratePreTrafficJob returns the Job for the pre-traffic hook. The Job
+// is only generated once traffic should be switched to a ready stack which
+// doesn't get any traffic yet.
+func (sc *StackContainer) GeneratePreTrafficJob() (*batchv1.Job, error) {
+	if sc.hooks == nil || sc.hooks.PreTraffic == nil {
+		return nil, nil
+	}
+
+	if sc.actualTrafficWeight > 0 || sc.desiredTrafficWeight == 0 || !sc.IsReady() {
+		return nil, nil
+	}
+
+	return sc.generateHookJob(PreTrafficHook, sc.hooks.PreTraffic)
+}
+
+// GeneratePostTrafficJob returns the Job for the post-traffic hook. The Job
+// is only generated once the stack gets all the traffic.
+func (sc *StackContainer) GeneratePostTrafficJob() (*batchv1.Job, error) {
+	if sc.hooks == nil || sc.hooks.PostTraffic == nil {
+		return nil, nil
+	}
+
+	if sc.actualTrafficWeight < 100 || !sc.IsReady() {
+		return nil, nil
+	}
+
+	return sc.generateHookJob(PostTrafficHook, sc.hooks.PostTraffic)
+}
+
+func (sc *StackContainer) generateHookJob(hookName string, hook *zv1.StackHook) (*batchv1.Job, error) {
+	hostnames, err := sc.perStackHostnames()
+	if err != nil {
+		return nil, err
+	}
+
+	env := []v1.EnvVar{
+		{Name: hookEnvStackName, Value: sc.Name()},
+		{Name: hookEnvStackSetName, Value: sc.stacksetName},
+		{Name: hookEnvStackServiceName, Value: sc.Name()},
+		{Name: hookEnvStackHostnames, Value: strings.Join(hostnames, ",")},
+	}
+
+	podSpec := hook.PodTemplate.Spec.DeepCopy()
+	if podSpec.RestartPolicy == "" {
+		podSpec.RestartPolicy = v1.RestartPolicyNever
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].Env = injectEnv(podSpec.Containers[i].Env, env)
+	}
+
+	// The stack labels are not injected into the pods as they would be
+	// matched by the selector of the stack Service.
+	embeddedCopy := hook.PodTemplate.EmbeddedObjectMeta.DeepCopy()
+	templateObjectMeta := metav1.ObjectMeta{
+		Annotations: embeddedCopy.Annotations,
+		Labels:      embeddedCopy.Labels,
+	}
+
+	objectMeta := sc.resourceMeta()
+	objectMeta.Name = truncatedResourceName(fmt.Sprintf("%s-%s", sc.Name(), hookName))
+	objectMeta.Labels[HookLabelKey] = hookName
+	if retry, ok := sc.Stack.Annotations[HookRetryAnnotationKey]; ok {
+		objectMeta.Annotations[HookRetryAnnotationKey] = retry
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: objectMeta,
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          hook.BackoffLimit,
+			ActiveDeadlineSeconds: hook.ActiveDeadlineSeconds,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: objectMetaInjectLabels(templateObjectMeta, map[string]string{HookLabelKey: hookName}),
+				Spec:       *podSpec,
+			},
+		},
+	}, nil
+}
+
+// injectEnv adds the environment variables to the list unless they're
+// already defined.
+func injectEnv(env []v1.EnvVar, inject []v1.EnvVar) []v1.EnvVar {
+	defined := make(map[string]struct{}, len(env))
+	for _, e := range env {
+		defined[e.Name] = struct{}{}
+	}
+	for _, e := range inject {
+		if _, ok := defined[e.Name]; !ok {
+			env = append(env, e)
+		}
+	}
+	return env
+}
+
+// updateHookConditions updates the conditions of the stack based on the
+// state of the hook Jobs.
+func (sc *StackContainer) updateHookConditions() {
+	var preTraffic, postTraffic *zv1.StackHook
+	if sc.hooks != nil {
+		preTraffic = sc.hooks.PreTraffic
+		postTraffic = sc.hooks.PostTraffic
+	}
+	sc.updateHookCondition(zv1.PreTrafficHookSucceeded, preTraffic, sc.Resources.PreTrafficJob)
+	sc.updateHookCondition(zv1.PostTrafficHookSucceeded, postTraffic, sc.Resources.PostTrafficJob)
+}
+
+func (sc *StackContainer) updateHookCondition(conditionType string, hook *zv1.StackHook, job *batchv1.Job) {
+	if hook == nil || job == nil {
+		meta.RemoveStatusCondition(&sc.conditions, conditionType)
+		return
+	}
+
+	status, reason, message := hookJobStatus(job)
+	meta.SetStatusCondition(&sc.conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: sc.Stack.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// HookFailed returns true if the Job of the named hook failed since the
+// status of the stack was last updated, i.e. only once per failed Job. The
+// Job of a retry which fails again is reported as well, as the condition
+// then identifies the Job which failed before.
+func (sc *StackContainer) HookFailed(hookName string) bool {
+	var job *batchv1.Job
+	var conditionType string
+	switch hookName {
+	case PreTrafficHook:
+		job = sc.Resources.PreTrafficJob
+		conditionType = zv1.PreTrafficHookSucceeded
+	case PostTrafficHook:
+		job = sc.Resources.PostTrafficJob
+		conditionType = zv1.PostTrafficHookSucceeded
+	}
+	if job == nil {
+		return false
+	}
+	status, _, message := hookJobStatus(job)
+	if status != metav1.ConditionFalse {
+		return false
+	}
+	condition := meta.FindStatusCondition(sc.Stack.Status.Conditions, conditionType)
+	return condition == nil || condition.Status != metav1.ConditionFalse || condition.Message != message
+}
+
+// RetryHookJob returns true if the Job of a hook failed and should be
+// deleted to run the hook again, because the value of the
+// HookRetryAnnotationKey annotation of the stack changed since the Job was
+// created.
+func (sc *StackContainer) RetryHookJob(job *batchv1.Job) bool {
+	if job == nil {
+		return false
+	}
+	status, _, _ := hookJobStatus(job)
+	return status == metav1.ConditionFalse && job.Annotations[HookRetryAnnotationKey] != sc.Stack.Annotations[HookRetryAnnotationKey]
+}
+
+// checkPreTrafficHooks returns an error if traffic was switched to a stack
+// which didn't get any traffic before and whose pre-traffic hook didn't
+// complete successfully.
+func checkPreTrafficHooks(stacks map[string]*StackContainer, previousWeights map[string]float64) error {
+	var failedStacks, pendingStacks []string
+	for stackName, stack := range stacks {
+		if stack.hooks == nil || stack.hooks.PreTraffic == nil {
+			continue
+		}
+		if previousWeights[stackName] > 0 || stack.actualTrafficWeight == 0 {
+			continue
+		}
+
+		if stack.Resources.PreTrafficJob == nil {
+			pendingStacks = append(pendingStacks, stackName)
+			continue
+		}
+
+		switch status, _, _ := hookJobStatus(stack.Resources.PreTrafficJob); status {
+		case metav1.ConditionFalse:
+			failedStacks = append(failedStacks, stackName)
+		case metav1.ConditionUnknown:
+			pendingStacks = append(pendingStacks, stackName)
+		}
+	}
+
+	if len(failedStacks) > 0 {
+		sort.Strings(failedStacks)
+		return fmt.Errorf("pre-traffic hook failed: %s", strings.Join(failedStacks, ", "))
+	}
+	if len(pendingStacks) > 0 {
+		sort.Strings(pendingStacks)
+		return fmt.Errorf("pre-traffic hook not completed: %s", strings.Join(pendingStacks, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func hookJob(name string, conditionType batchv1.JobConditionType) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			UID:  types.UID(name + "-uid"),
+		},
+	}
+	if conditionType != "" {
+		job.Status.Conditions = []batchv1.JobCondition{
+			{
+				Type:    conditionType,
+				Status:  v1.ConditionTrue,
+				Message: "some message",
+			},
+		}
+	}
+	return job
+}
+
+func testHook() *zv1.StackHook {
+	backoffLimit := int32(2)
+	return &zv1.StackHook{
+		BackoffLimit: &backoffLimit,
+		PodTemplate: zv1.PodTemplateSpec{
+			EmbeddedObjectMeta: zv1.EmbeddedObjectMeta{
+				Labels: map[string]string{
+					"hook-label": "foo",
+				},
+			},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{
+						Name:  "smoke-test",
+						Image: "smoke-test:latest",
+						Env: []v1.EnvVar{
+							{Name: "STACK_HOSTNAMES", Value: "custom"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestGenerateHookJobs(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		hooks               *zv1.StackSetHooks
+		ready               bool
+		desiredWeight       float64
+		actualWeight        float64
+		expectedPreTraffic  bool
+		expectedPostTraffic bool
+	}{
+		{
+			name:          "no hooks",
+			ready:         true,
+			desiredWeight: 100,
+			actualWeight:  100,
+		},
+		{
+			name:               "pre-traffic job is generated when traffic should be switched",
+			hooks:              &zv1.StackSetHooks{PreTraffic: testHook(), PostTraffic: testHook()},
+			ready:              true,
+			desiredWeight:      50,
+			expectedPreTraffic: true,
+		},
+		{
+			name:          "pre-traffic job is not generated for stacks which are not ready",
+			hooks:         &zv1.StackSetHooks{PreTraffic: testHook(), PostTraffic: testHook()},
+			desiredWeight: 50,
+		},
+		{
+			name:  "pre-traffic job is not generated without desired traffic",
+			hooks: &zv1.StackSetHooks{PreTraffic: testHook(), PostTraffic: testHook()},
+			ready: true,
+		},
+		{
+			name:          "pre-traffic job is not generated for stacks with traffic",
+			hooks:         &zv1.StackSetHooks{PreTraffic: testHook(), PostTraffic: testHook()},
+			ready:         true,
+			desiredWeight: 50,
+			actualWeight:  20,
+		},
+		{
+			name:                "post-traffic job is generated once the stack gets all the traffic",
+			hooks:               &zv1.StackSetHooks{PreTraffic: testHook(), PostTraffic: testHook()},
+			ready:               true,
+			desiredWeight:       100,
+			actualWeight:        100,
+			expectedPostTraffic: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stack := testStack("foo-v1").traffic(tc.desiredWeight, tc.actualWeight).stack()
+			stack.Stack.Namespace = "bar"
+			stack.Stack.Labels = map[string]string{
+				StacksetHeritageLabelKey: "foo",
+				StackVersionLabelKey:     "v1",
+			}
+			stack.stacksetName = "foo"
+			stack.hooks = tc.hooks
+			stack.clusterDomains = []string{"example.org"}
+			stack.ingressSpec = &zv1.StackSetIngressSpec{
+				Hosts: []string{"foo.example.org"},
+			}
+			if tc.ready {
+				stack.resourcesUpdated = true
+				stack.deploymentReplicas = 1
+				stack.updatedReplicas = 1
+				stack.readyReplicas = 1
+			}
+
+			preTrafficJob, err := stack.GeneratePreTrafficJob()
+			require.NoError(t, err)
+			postTrafficJob, err := stack.GeneratePostTrafficJob()
+			require.NoError(t, err)
+
+			if !tc.expectedPreTraffic {
+				require.Nil(t, preTrafficJob)
+			} else {
+				require.Equal(t, "foo-v1-pre-traffic", preTrafficJob.Name)
+				require.Equal(t, "bar", preTrafficJob.Namespace)
+				require.Equal(t, PreTrafficHook, preTrafficJob.Labels[HookLabelKey])
+				require.Equal(t, "foo-v1", preTrafficJob.OwnerReferences[0].Name)
+				require.Equal(t, tc.hooks.PreTraffic.BackoffLimit, preTrafficJob.Spec.BackoffLimit)
+				require.Equal(t, v1.RestartPolicyNever, preTrafficJob.Spec.Template.Spec.RestartPolicy)
+				require.Equal(t, map[string]string{"hook-label": "foo", HookLabelKey: PreTrafficHook}, preTrafficJob.Spec.Template.Labels)
+				require.Equal(t, []v1.EnvVar{
+					{Name: "STACK_HOSTNAMES", Value: "custom"},
+					{Name: "STACK_NAME", Value: "foo-v1"},
+					{Name: "STACKSET_NAME", Value: "foo"},
+					{Name: "STACK_SERVICE_NAME", Value: "foo-v1"},
+				}, preTrafficJob.Spec.Template.Spec.Containers[0].Env)
+				require.Len(t, tc.hooks.PreTraffic.PodTemplate.Spec.Containers[0].Env, 1)
+			}
+
+			if !tc.expectedPostTraffic {
+				require.Nil(t, postTrafficJob)
+			} else {
+				require.Equal(t, "foo-v1-post-traffic", postTrafficJob.Name)
+				require.Equal(t, PostTrafficHook, postTrafficJob.Labels[HookLabelKey])
+			}
+		})
+	}
+}
+
+func TestPerStackHostnames(t *testing.T) {
+	stack := testStack("foo-v1").stack()
+	stack.clusterDomains = []string{"example.org"}
+	stack.ingressSpec = &zv1.StackSetIngressSpec{
+		Hosts: []string{"foo.example.org"},
+	}
+	stack.routeGroupSpec = &zv1.RouteGroupSpec{
+		Hosts: []string{"foo.example.org"},
+	}
+	stack.Stack.Spec.RouteGroupOverrides = &zv1.StackIngressRouteGroupOverrides{
+		Hosts: []string{"$(STACK_NAME).rg.example.org"},
+	}
+
+	hostnames, err := stack.perStackHostnames()
+	require.NoError(t, err)
+	require.Equal(t, []string{"foo-v1.example.org", "foo-v1.rg.example.org"}, hostnames)
+}
+
+func TestHookConditions(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		job            *batchv1.Job
+		expectedStatus metav1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name: "no condition without a job",
+		},
+		{
+			name:           "job running",
+			job:            hookJob("foo-v1-pre-traffic", ""),
+			expectedStatus: metav1.ConditionUnknown,
+			expectedReason: hookReasonRunning,
+		},
+		{
+			name:           "job completed",
+			job:            hookJob("foo-v1-pre-traffic", batchv1.JobComplete),
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: hookReasonSucceeded,
+		},
+		{
+			name:           "job failed",
+			job:            hookJob("foo-v1-pre-traffic", batchv1.JobFailed),
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: hookReasonFailed,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stack := testStack("foo-v1").preTrafficHook(tc.job).stack()
+			stack.updateHookConditions()
+
+			condition := meta.FindStatusCondition(stack.conditions, zv1.PreTrafficHookSucceeded)
+			if tc.job == nil {
+				require.Nil(t, condition)
+				return
+			}
+			require.NotNil(t, condition)
+			require.Equal(t, tc.expectedStatus, condition.Status)
+			require.Equal(t, tc.expectedReason, condition.Reason)
+			require.Nil(t, meta.FindStatusCondition(stack.conditions, zv1.PostTrafficHookSucceeded))
+			require.Equal(t, tc.expectedStatus == metav1.ConditionFalse, stack.HookFailed(PreTrafficHook))
+
+			// The failure is only reported once it's stored in the status
+			stack.Stack.Status.Conditions = stack.conditions
+			require.False(t, stack.HookFailed(PreTrafficHook))
+		})
+	}
+}
+
+func TestHookFailedAfterRetry(t *testing.T) {
+	stack := testStack("foo-v1").preTrafficHook(hookJob("foo-v1-pre-traffic", batchv1.JobFailed)).stack()
+	stack.updateHookConditions()
+	require.True(t, stack.HookFailed(PreTrafficHook))
+
+	// The failure is only reported once
+	stack.Stack.Status.Conditions = append([]metav1.Condition(nil), stack.conditions...)
+	require.False(t, stack.HookFailed(PreTrafficHook))
+
+	// The Job of the retry fails again while the condition is still False
+	retried := hookJob("foo-v1-pre-traffic", batchv1.JobFailed)
+	retried.UID = "retried-uid"
+	stack.Resources.PreTrafficJob = retried
+	stack.updateHookConditions()
+	require.True(t, stack.HookFailed(PreTrafficHook))
+
+	stack.Stack.Status.Conditions = append([]metav1.Condition(nil), stack.conditions...)
+	require.False(t, stack.HookFailed(PreTrafficHook))
+}
+
+func TestHookJobName(t *testing.T) {
+	stack := testStack("foo-v1").stack()
+	stack.hooks = &zv1.StackSetHooks{PreTraffic: testHook()}
+	stack.desiredTrafficWeight = 100
+	stack.Stack.Name = "a-very-long-stackset-name-which-exceeds-the-limit-v20240101-120000"
+
+	job, err := stack.generateHookJob(PreTrafficHook, stack.hooks.PreTraffic)
+	require.NoError(t, err)
+	require.Len(t, job.Name, 63)
+	require.Equal(t, stack.Stack.Name[:54], job.Name[:54])
+	require.NotEqual(t, job.Name, truncatedResourceName(stack.Name()+"-"+PostTrafficHook))
+}
+
+func TestRetryHookJob(t *testing.T) {
+	stack := testStack("foo-v1").stack()
+	require.False(t, stack.RetryHookJob(nil))
+	require.False(t, stack.RetryHookJob(hookJob("foo-v1-pre-traffic", batchv1.JobFailed)))
+
+	stack.Stack.Annotations = map[string]string{HookRetryAnnotationKey: "1"}
+	require.False(t, stack.RetryHookJob(hookJob("foo-v1-pre-traffic", batchv1.JobComplete)))
+	require.True(t, stack.RetryHookJob(hookJob("foo-v1-pre-traffic", batchv1.JobFailed)))
+
+	// The Job of the current retry isn't retried again
+	job, err := stack.generateHookJob(PreTrafficHook, testHook())
+	require.NoError(t, err)
+	job.Status = hookJob("", batchv1.JobFailed).Status
+	require.False(t, stack.RetryHookJob(job))
+}
+
+func TestTrafficSwitchPreTrafficHook(t *testing.T) {
+	for _, tc := range []struct {
+		name                  string
+		stacks                map[types.UID]*StackContainer
+		expectedActualWeights map[string]float64
+		expectedError         string
+	}{
+		{
+			name: "traffic is switched once the pre-traffic hook completed",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(50, 100).ready(1).preTrafficHook(hookJob("foo-v1-pre-traffic", batchv1.JobComplete)).stack(),
+				"foo-v2": testStack("foo-v2").traffic(50, 0).ready(1).preTrafficHook(hookJob("foo-v2-pre-traffic", batchv1.JobComplete)).stack(),
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 50,
+				"foo-v2": 50,
+			},
+		},
+		{
+			name: "traffic is not switched while the pre-traffic hook is running",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(50, 100).ready(1).preTrafficHook(nil).stack(),
+				"foo-v2": testStack("foo-v2").traffic(50, 0).ready(1).preTrafficHook(hookJob("foo-v2-pre-traffic", "")).stack(),
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 100,
+				"foo-v2": 0,
+			},
+			expectedError: "pre-traffic hook not completed: foo-v2",
+		},
+		{
+			name: "traffic is not switched before the pre-traffic hook is started",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(50, 100).ready(1).preTrafficHook(nil).stack(),
+				"foo-v2": testStack("foo-v2").traffic(50, 0).ready(1).preTrafficHook(nil).stack(),
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 100,
+				"foo-v2": 0,
+			},
+			expectedError: "pre-traffic hook not completed: foo-v2",
+		},
+		{
+			name: "traffic is not switched if the pre-traffic hook failed",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(50, 100).ready(1).preTrafficHook(nil).stack(),
+				"foo-v2": testStack("foo-v2").traffic(50, 0).ready(1).preTrafficHook(hookJob("foo-v2-pre-traffic", batchv1.JobFailed)).stack(),
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 100,
+				"foo-v2": 0,
+			},
+			expectedError: "pre-traffic hook failed: foo-v2",
+		},
+		{
+			name: "traffic of stacks which already get traffic is not gated",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(50, 80).ready(1).preTrafficHook(nil).stack(),
+				"foo-v2": testStack("foo-v2").traffic(50, 20).ready(1).preTrafficHook(nil).stack(),
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 50,
+				"foo-v2": 50,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Spec: zv1.StackSetSpec{
+						Ingress: &zv1.StackSetIngressSpec{},
+					},
+				},
+				StackContainers:   tc.stacks,
+				TrafficReconciler: SimpleTrafficReconciler{},
+			}
+
+			err := c.ManageTraffic(time.Now())
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+
+			for name, weight := range tc.expectedActualWeights {
+				require.Equal(t, weight, c.StackContainers[types.UID(name)].actualTrafficWeight, "actual weight, stack %s", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// ScaledObjectAPIVersion is the API version of the KEDA ScaledObject.
+	ScaledObjectAPIVersion = "keda.sh/v1alpha1"
+	// KindScaledObject is the kind of the KEDA ScaledObject.
+	KindScaledObject = "ScaledObject"
+)
+
+// kedaMetrics are the metric types supported by the keda engine.
+var kedaMetrics = map[zv1.AutoscalerMetricType]struct{}{
+	zv1.CPUAutoscalerMetric:        {},
+	zv1.MemoryAutoscalerMetric:     {},
+	zv1.AmazonSQSAutoscalerMetric:  {},
+	zv1.CronAutoscalerMetric:       {},
+	zv1.KEDAAutoscalerMetric:       {},
+	zv1.PrometheusAutoscalerMetric: {},
+}
+
+// validateKEDAMetrics returns an error if the autoscaler uses the keda engine
+// with metrics it doesn't support. It's checked before a stack is created,
+// instead of failing to generate the ScaledObject of the stack later on.
+func validateKEDAMetrics(autoscaler *zv1.Autoscaler) error {
+	if autoscaler == nil || autoscaler.Engine != zv1.AutoscalerEngineKEDA {
+		return nil
+	}
+	for _, m := range autoscaler.Metrics {
+		if _, ok := kedaMetrics[m.Type]; !ok {
+			return kedaMetricNotSupported(m.Type)
+		}
+	}
+	return nil
+}
+
+// kedaMetricNotSupported returns the error for a metric type the keda engine
+// doesn't support, pointing to the KEDA scaler to use instead if there is one.
+func kedaMetricNotSupported(metricType zv1.AutoscalerMetricType) error {
+	switch metricType {
+	case zv1.KafkaAutoscalerMetric:
+		return fmt.Errorf("metric type %s not supported by the keda engine, use a KEDA metric with the kafka scaler instead", metricType)
+	case zv1.RabbitMQAutoscalerMetric:
+		return fmt.Errorf("metric type %s not supported by the keda engine, use a KEDA metric with the rabbitmq scaler instead", metricType)
+	}
+	return fmt.Errorf("metric type %s not supported by the keda engine", metricType)
+}
+
+// UsesKEDA returns true if the stack is scaled by a KEDA ScaledObject
+// instead of an HPA.
+func (sc *StackContainer) UsesKEDA() bool {
+	autoscaler := sc.Stack.Spec.Autoscaler
+	return autoscaler != nil && autoscaler.Engine == zv1.AutoscalerEngineKEDA
+}
+
+// GenerateScaledObject returns the KEDA ScaledObject of the stack as an
+// unstructured resource, or nil if the stack isn't scaled by KEDA. Like for
+// the HPA, the replicas are adjusted for gradual scale-down, warm standby and
+// prescaling.
+func (sc *StackContainer) GenerateScaledObject() (*unstructured.Unstructured, error) {
+	if !sc.UsesKEDA() {
+		return nil, nil
+	}
+	autoscalerSpec := sc.Stack.Spec.Autoscaler
+
+	triggers, err := kedaTriggers(sc.stacksetName, sc.Name(), autoscalerSpec.Metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	minReplicas, maxReplicas := sc.autoscalerReplicas(autoscalerSpec.MinReplicas, autoscalerSpec.MaxReplicas)
+
+	spec := map[string]interface{}{
+		"scaleTargetRef": map[string]interface{}{
+			"apiVersion": apiVersionAppsV1,
+			"kind":       kindDeployment,
+			"name":       sc.deploymentName(),
+		},
+		"maxReplicaCount": int64(maxReplicas),
+		"triggers":        triggers,
+	}
+	if minReplicas != nil {
+		spec["minReplicaCount"] = int64(*minReplicas)
+	}
+	if autoscalerSpec.Behavior != nil {
+		behavior, err := runtime.DefaultUnstructuredConverter.ToUnstructured(autoscalerSpec.Behavior)
+		if err != nil {
+			return nil, err
+		}
+		spec["advanced"] = map[string]interface{}{
+			"horizontalPodAutoscalerConfig": map[string]interface{}{
+				"behavior": behavior,
+			},
+		}
+	}
+
+	result := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": spec,
+		},
+	}
+	result.SetAPIVersion(ScaledObjectAPIVersion)
+	result.SetKind(KindScaledObject)
+
+	objectMeta := sc.resourceMeta()
+	result.SetName(objectMeta.Name)
+	result.SetNamespace(objectMeta.Namespace)
+	result.SetLabels(objectMeta.Labels)
+	result.SetAnnotations(objectMeta.Annotations)
+	result.SetOwnerReferences(objectMeta.OwnerReferences)
+	return result, nil
+}
+
+// kedaTriggers converts the autoscaler metrics to KEDA triggers.
+func kedaTriggers(stacksetName, stackName string, metrics []zv1.AutoscalerMetrics) ([]interface{}, error) {
+	var triggers []interface{}
+	for _, m := range metrics {
+		var (
+			trigger map[string]interface{}
+			err     error
+		)
+		switch m.Type {
+		case zv1.CPUAutoscalerMetric:
+			trigger, err = kedaResourceTrigger("cpu", m)
+		case zv1.MemoryAutoscalerMetric:
+			trigger, err = kedaResourceTrigger("memory", m)
+		case zv1.AmazonSQSAutoscalerMetric:
+			trigger, err = kedaSQSTrigger(m)
+		case zv1.CronAutoscalerMetric:
+			trigger, err = kedaCronTrigger(m)
+		case zv1.KEDAAutoscalerMetric:
+			trigger, err = kedaGenericTrigger(m)
+		case zv1.PrometheusAutoscalerMetric:
+			trigger, err = kedaPrometheusTrigger(m, stacksetName, stackName)
+		default:
+			err = kedaMetricNotSupported(m.Type)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		triggers = append(triggers, trigger)
+	}
+	return triggers, nil
+}
+
+func kedaResourceTrigger(triggerType string, metrics zv1.AutoscalerMetrics) (map[string]interface{}, error) {
+	if metrics.AverageUtilization == nil {
+		return nil, fmt.Errorf("utilization is not specified")
+	}
+
+	metadata := map[string]interface{}{
+		"value": strconv.Itoa(int(*metrics.AverageUtilization)),
+	}
+	if metrics.Container != "" {
+		metadata["containerName"] = metrics.Container
+	}
+	return map[string]interface{}{
+		"type":       triggerType,
+		"metricType": "Utilization",
+		"metadata":   metadata,
+	}, nil
+}
+
+func kedaSQSTrigger(metrics zv1.AutoscalerMetrics) (map[string]interface{}, error) {
+	if metrics.Average == nil {
+		return nil, fmt.Errorf("average not specified")
+	}
+	if metrics.Queue == nil || metrics.Queue.Name == "" || metrics.Queue.Region == "" {
+		return nil, fmt.Errorf("queue not specified correctly")
+	}
+
+	trigger := map[string]interface{}{
+		"type": "aws-sqs-queue",
+		"metadata": map[string]interface{}{
+			"queueURL":    metrics.Queue.Name,
+			"awsRegion":   metrics.Queue.Region,
+			"queueLength": metrics.Average.String(),
+		},
+	}
+	if metrics.Queue.AuthenticationRef != "" {
+		trigger["authenticationRef"] = map[string]interface{}{
+			"name": metrics.Queue.AuthenticationRef,
+		}
+	}
+	return trigger, nil
+}
+
+func kedaCronTrigger(metrics zv1.AutoscalerMetrics) (map[string]interface{}, error) {
+	cron := metrics.Cron
+	if cron == nil || cron.Timezone == "" || cron.Start == "" || cron.End == "" {
+		return nil, fmt.Errorf("cron schedule not specified correctly")
+	}
+
+	return map[string]interface{}{
+		"type": "cron",
+		"metadata": map[string]interface{}{
+			"timezone":        cron.Timezone,
+			"start":           cron.Start,
+			"end":             cron.End,
+			"desiredReplicas": strconv.Itoa(int(cron.DesiredReplicas)),
+		},
+	}, nil
+}
+
+func kedaPrometheusTrigger(metrics zv1.AutoscalerMetrics, stacksetName, stackName string) (map[string]interface{}, error) {
+	if metrics.Average == nil {
+		return nil, fmt.Errorf("average not specified")
+	}
+	if metrics.Prometheus == nil || metrics.Prometheus.Query == "" || metrics.Prometheus.Server == "" {
+		return nil, fmt.Errorf("the Prometheus metric is not specified correctly, the keda engine requires a server")
+	}
+
+	query, err := prometheusQuery(metrics.Prometheus, stacksetName, stackName)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"type": "prometheus",
+		"metadata": map[string]interface{}{
+			"serverAddress": metrics.Prometheus.Server,
+			"query":         query,
+			"threshold":     metrics.Average.String(),
+		},
+	}, nil
+}
+
+func kedaGenericTrigger(metrics zv1.AutoscalerMetrics) (map[string]interface{}, error) {
+	if metrics.KEDA == nil || metrics.KEDA.Type == "" {
+		return nil, fmt.Errorf("KEDA trigger not specified correctly")
+	}
+
+	metadata := map[string]interface{}{}
+	for k, v := range metrics.KEDA.Metadata {
+		metadata[k] = v
+	}
+	trigger := map[string]interface{}{
+		"type":     metrics.KEDA.Type,
+		"metadata": metadata,
+	}
+	if metrics.KEDA.AuthenticationRef != "" {
+		trigger["authenticationRef"] = map[string]interface{}{
+			"name": metrics.KEDA.AuthenticationRef,
+		}
+	}
+	return trigger, nil
+}
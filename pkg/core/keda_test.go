@@ -0,0 +1,407 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	autoscaling "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestKEDATriggers(t *testing.T) {
+	utilization := int32(80)
+	average := resource.MustParse("30")
+
+	for _, tc := range []struct {
+		name          string
+		metric        zv1.AutoscalerMetrics
+		expected      map[string]interface{}
+		expectedError bool
+	}{
+		{
+			name: "cpu",
+			metric: zv1.AutoscalerMetrics{
+				Type:               zv1.CPUAutoscalerMetric,
+				AverageUtilization: &utilization,
+			},
+			expected: map[string]interface{}{
+				"type":       "cpu",
+				"metricType": "Utilization",
+				"metadata": map[string]interface{}{
+					"value": "80",
+				},
+			},
+		},
+		{
+			name: "memory of a container",
+			metric: zv1.AutoscalerMetrics{
+				Type:               zv1.MemoryAutoscalerMetric,
+				AverageUtilization: &utilization,
+				Container:          "app",
+			},
+			expected: map[string]interface{}{
+				"type":       "memory",
+				"metricType": "Utilization",
+				"metadata": map[string]interface{}{
+					"value":         "80",
+					"containerName": "app",
+				},
+			},
+		},
+		{
+			name: "cpu without utilization",
+			metric: zv1.AutoscalerMetrics{
+				Type: zv1.CPUAutoscalerMetric,
+			},
+			expectedError: true,
+		},
+		{
+			name: "sqs",
+			metric: zv1.AutoscalerMetrics{
+				Type:    zv1.AmazonSQSAutoscalerMetric,
+				Average: &average,
+				Queue:   &zv1.MetricsQueue{Name: "queue", Region: "eu-central-1"},
+			},
+			expected: map[string]interface{}{
+				"type": "aws-sqs-queue",
+				"metadata": map[string]interface{}{
+					"queueURL":    "queue",
+					"awsRegion":   "eu-central-1",
+					"queueLength": "30",
+				},
+			},
+		},
+		{
+			name: "sqs with authentication",
+			metric: zv1.AutoscalerMetrics{
+				Type:    zv1.AmazonSQSAutoscalerMetric,
+				Average: &average,
+				Queue:   &zv1.MetricsQueue{Name: "queue", Region: "eu-central-1", AuthenticationRef: "aws-auth"},
+			},
+			expected: map[string]interface{}{
+				"type": "aws-sqs-queue",
+				"metadata": map[string]interface{}{
+					"queueURL":    "queue",
+					"awsRegion":   "eu-central-1",
+					"queueLength": "30",
+				},
+				"authenticationRef": map[string]interface{}{
+					"name": "aws-auth",
+				},
+			},
+		},
+		{
+			name: "sqs without queue",
+			metric: zv1.AutoscalerMetrics{
+				Type:    zv1.AmazonSQSAutoscalerMetric,
+				Average: &average,
+			},
+			expectedError: true,
+		},
+		{
+			name: "cron",
+			metric: zv1.AutoscalerMetrics{
+				Type: zv1.CronAutoscalerMetric,
+				Cron: &zv1.MetricsCron{
+					Timezone:        "Europe/Berlin",
+					Start:           "0 8 * * *",
+					End:             "0 20 * * *",
+					DesiredReplicas: 10,
+				},
+			},
+			expected: map[string]interface{}{
+				"type": "cron",
+				"metadata": map[string]interface{}{
+					"timezone":        "Europe/Berlin",
+					"start":           "0 8 * * *",
+					"end":             "0 20 * * *",
+					"desiredReplicas": "10",
+				},
+			},
+		},
+		{
+			name: "cron without schedule",
+			metric: zv1.AutoscalerMetrics{
+				Type: zv1.CronAutoscalerMetric,
+			},
+			expectedError: true,
+		},
+		{
+			name: "keda trigger",
+			metric: zv1.AutoscalerMetrics{
+				Type: zv1.KEDAAutoscalerMetric,
+				KEDA: &zv1.MetricsKEDA{
+					Type:              "kafka",
+					Metadata:          map[string]string{"topic": "events"},
+					AuthenticationRef: "kafka-auth",
+				},
+			},
+			expected: map[string]interface{}{
+				"type": "kafka",
+				"metadata": map[string]interface{}{
+					"topic": "events",
+				},
+				"authenticationRef": map[string]interface{}{
+					"name": "kafka-auth",
+				},
+			},
+		},
+		{
+			name: "prometheus",
+			metric: zv1.AutoscalerMetrics{
+				Type:    zv1.PrometheusAutoscalerMetric,
+				Average: &average,
+				Prometheus: &zv1.MetricsPrometheus{
+					Name:   "requests",
+					Query:  `scalar(sum(rate(requests_total{stack="$(STACK_NAME)"}[1m])))`,
+					Server: "http://prometheus:9090",
+				},
+			},
+			expected: map[string]interface{}{
+				"type": "prometheus",
+				"metadata": map[string]interface{}{
+					"serverAddress": "http://prometheus:9090",
+					"query":         `scalar(sum(rate(requests_total{stack="foo-v1"}[1m])))`,
+					"threshold":     "30",
+				},
+			},
+		},
+		{
+			name: "prometheus without server",
+			metric: zv1.AutoscalerMetrics{
+				Type:    zv1.PrometheusAutoscalerMetric,
+				Average: &average,
+				Prometheus: &zv1.MetricsPrometheus{
+					Name:  "requests",
+					Query: "scalar(up)",
+				},
+			},
+			expectedError: true,
+		},
+		{
+			name: "metric spec",
+			metric: zv1.AutoscalerMetrics{
+				Type: zv1.MetricSpecAutoscalerMetric,
+				MetricSpec: &autoscaling.MetricSpec{
+					Type: autoscaling.ExternalMetricSourceType,
+				},
+			},
+			expectedError: true,
+		},
+		{
+			name: "unsupported metric",
+			metric: zv1.AutoscalerMetrics{
+				Type:    zv1.ZMONAutoscalerMetric,
+				Average: &average,
+			},
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			triggers, err := kedaTriggers("foo", "foo-v1", []zv1.AutoscalerMetrics{tc.metric})
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, []interface{}{tc.expected}, triggers)
+		})
+	}
+}
+
+func TestValidateKEDAMetrics(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		autoscaler    *zv1.Autoscaler
+		expectedError string
+	}{
+		{
+			name: "no autoscaler",
+		},
+		{
+			name: "hpa engine",
+			autoscaler: &zv1.Autoscaler{
+				Metrics: []zv1.AutoscalerMetrics{{Type: zv1.ScalingScheduleMetric}},
+			},
+		},
+		{
+			name: "supported metrics",
+			autoscaler: &zv1.Autoscaler{
+				Engine:  zv1.AutoscalerEngineKEDA,
+				Metrics: []zv1.AutoscalerMetrics{{Type: zv1.CPUAutoscalerMetric}, {Type: zv1.CronAutoscalerMetric}},
+			},
+		},
+		{
+			name: "scaling schedule",
+			autoscaler: &zv1.Autoscaler{
+				Engine:  zv1.AutoscalerEngineKEDA,
+				Metrics: []zv1.AutoscalerMetrics{{Type: zv1.CPUAutoscalerMetric}, {Type: zv1.ScalingScheduleMetric}},
+			},
+			expectedError: "metric type ScalingSchedule not supported by the keda engine",
+		},
+		{
+			name: "kafka consumer lag",
+			autoscaler: &zv1.Autoscaler{
+				Engine:  zv1.AutoscalerEngineKEDA,
+				Metrics: []zv1.AutoscalerMetrics{{Type: zv1.KafkaAutoscalerMetric}},
+			},
+			expectedError: "metric type KafkaConsumerLag not supported by the keda engine, use a KEDA metric with the kafka scaler instead",
+		},
+		{
+			name: "rabbitmq queue length",
+			autoscaler: &zv1.Autoscaler{
+				Engine:  zv1.AutoscalerEngineKEDA,
+				Metrics: []zv1.AutoscalerMetrics{{Type: zv1.RabbitMQAutoscalerMetric}},
+			},
+			expectedError: "metric type RabbitMQQueueLength not supported by the keda engine, use a KEDA metric with the rabbitmq scaler instead",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateKEDAMetrics(tc.autoscaler)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNewStackUnsupportedKEDAMetric(t *testing.T) {
+	stackset := &zv1.StackSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Spec: zv1.StackSetSpec{
+			StackTemplate: zv1.StackTemplate{
+				Spec: zv1.StackSpecTemplate{
+					StackSpec: zv1.StackSpec{
+						Autoscaler: &zv1.Autoscaler{
+							Engine:      zv1.AutoscalerEngineKEDA,
+							MaxReplicas: 10,
+							Metrics:     []zv1.AutoscalerMetrics{{Type: zv1.ClusterScalingScheduleMetric}},
+						},
+					},
+					Version: "v1",
+				},
+			},
+		},
+	}
+	ssc := NewContainer(stackset, SimpleTrafficReconciler{}, "", nil)
+
+	sc, _, err := ssc.NewStack()
+	require.EqualError(t, err, "metric type ClusterScalingSchedule not supported by the keda engine")
+	require.Nil(t, sc)
+}
+
+func TestGenerateScaledObject(t *testing.T) {
+	minReplicas := int32(2)
+	utilization := int32(80)
+	stabilizationWindow := int32(60)
+
+	kedaAutoscaler := &zv1.Autoscaler{
+		MinReplicas: &minReplicas,
+		MaxReplicas: 10,
+		Engine:      zv1.AutoscalerEngineKEDA,
+		Metrics: []zv1.AutoscalerMetrics{
+			{
+				Type:               zv1.CPUAutoscalerMetric,
+				AverageUtilization: &utilization,
+			},
+		},
+		Behavior: &autoscaling.HorizontalPodAutoscalerBehavior{
+			ScaleDown: &autoscaling.HPAScalingRules{
+				StabilizationWindowSeconds: &stabilizationWindow,
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name               string
+		autoscaler         *zv1.Autoscaler
+		prescalingReplicas int32
+		expectedNil        bool
+		expectedMin        int64
+	}{
+		{
+			name:        "no autoscaler",
+			expectedNil: true,
+		},
+		{
+			name: "hpa engine",
+			autoscaler: &zv1.Autoscaler{
+				MaxReplicas: 10,
+			},
+			expectedNil: true,
+		},
+		{
+			name:        "keda engine",
+			autoscaler:  kedaAutoscaler,
+			expectedMin: 2,
+		},
+		{
+			name:               "prescaling raises the minimum",
+			autoscaler:         kedaAutoscaler,
+			prescalingReplicas: 5,
+			expectedMin:        5,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			container := &StackContainer{
+				Stack: &zv1.Stack{
+					ObjectMeta: testStackMeta,
+					Spec: zv1.StackSpec{
+						Autoscaler: tc.autoscaler,
+					},
+				},
+				prescalingActive:   tc.prescalingReplicas > 0,
+				prescalingReplicas: tc.prescalingReplicas,
+			}
+
+			scaledObject, err := container.GenerateScaledObject()
+			require.NoError(t, err)
+			if tc.expectedNil {
+				require.Nil(t, scaledObject)
+				return
+			}
+
+			hpa, err := container.GenerateHPA()
+			require.NoError(t, err)
+			require.Nil(t, hpa)
+
+			require.Equal(t, "keda.sh/v1alpha1", scaledObject.GetAPIVersion())
+			require.Equal(t, "ScaledObject", scaledObject.GetKind())
+			require.Equal(t, testResourceMeta.Name, scaledObject.GetName())
+			require.Equal(t, testResourceMeta.Labels, scaledObject.GetLabels())
+			require.Equal(t, testResourceMeta.Annotations, scaledObject.GetAnnotations())
+			require.Equal(t, testResourceMeta.OwnerReferences, scaledObject.GetOwnerReferences())
+			require.Equal(t, map[string]interface{}{
+				"scaleTargetRef": map[string]interface{}{
+					"apiVersion": "apps/v1",
+					"kind":       "Deployment",
+					"name":       "foo-v1",
+				},
+				"minReplicaCount": tc.expectedMin,
+				"maxReplicaCount": int64(10),
+				"triggers": []interface{}{
+					map[string]interface{}{
+						"type":       "cpu",
+						"metricType": "Utilization",
+						"metadata": map[string]interface{}{
+							"value": "80",
+						},
+					},
+				},
+				"advanced": map[string]interface{}{
+					"horizontalPodAutoscalerConfig": map[string]interface{}{
+						"behavior": map[string]interface{}{
+							"scaleDown": map[string]interface{}{
+								"stabilizationWindowSeconds": int64(60),
+							},
+						},
+					},
+				},
+			}, scaledObject.Object["spec"])
+		})
+	}
+}
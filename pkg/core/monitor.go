@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// MonitorAPIVersion is the API version of the Prometheus Operator monitors.
+const MonitorAPIVersion = "monitoring.coreos.com/v1"
+
+// GenerateMonitor returns the PodMonitor or ServiceMonitor of the stack as an
+// unstructured resource, or nil if no monitor is configured for the
+// StackSet. The monitor selects the pods or the Service of the stack and
+// adds the stackset and stack-version labels of the pods to the metrics.
+func (sc *StackContainer) GenerateMonitor() (*unstructured.Unstructured, error) {
+	monitor := sc.monitor
+	if monitor == nil {
+		return nil, nil
+	}
+
+	var endpointsField string
+	switch monitor.Kind {
+	case zv1.MonitorKindPodMonitor:
+		endpointsField = "podMetricsEndpoints"
+	case zv1.MonitorKindServiceMonitor:
+		endpointsField = "endpoints"
+	default:
+		return nil, fmt.Errorf("unsupported monitor kind %q", monitor.Kind)
+	}
+
+	if len(monitor.Endpoints) == 0 {
+		return nil, fmt.Errorf("at least one endpoint has to be specified for the %s", monitor.Kind)
+	}
+
+	var endpoints []interface{}
+	for _, endpoint := range monitor.Endpoints {
+		endpoints = append(endpoints, monitorEndpoint(endpoint))
+	}
+
+	matchLabels := map[string]interface{}{}
+	for k, v := range sc.selector() {
+		matchLabels[k] = v
+	}
+
+	var podTargetLabels []interface{}
+	for _, label := range []string{StacksetHeritageLabelKey, StackVersionLabelKey} {
+		podTargetLabels = append(podTargetLabels, label)
+	}
+
+	result := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchLabels": matchLabels,
+				},
+				"podTargetLabels": podTargetLabels,
+				endpointsField:    endpoints,
+			},
+		},
+	}
+	result.SetAPIVersion(MonitorAPIVersion)
+	result.SetKind(string(monitor.Kind))
+
+	objectMeta := sc.resourceMeta()
+	result.SetName(objectMeta.Name)
+	result.SetNamespace(objectMeta.Namespace)
+	result.SetLabels(mergeLabels(monitor.Labels, objectMeta.Labels))
+	result.SetAnnotations(objectMeta.Annotations)
+	result.SetOwnerReferences(objectMeta.OwnerReferences)
+	return result, nil
+}
+
+// monitorEndpoint returns the endpoint of a monitor with the unset fields
+// omitted.
+func monitorEndpoint(endpoint zv1.MonitorEndpoint) map[string]interface{} {
+	result := map[string]interface{}{
+		"port": endpoint.Port,
+	}
+	if endpoint.Path != "" {
+		result["path"] = endpoint.Path
+	}
+	if endpoint.Interval != "" {
+		result["interval"] = endpoint.Interval
+	}
+	if endpoint.Scheme != "" {
+		result["scheme"] = endpoint.Scheme
+	}
+	return result
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestGenerateMonitor(t *testing.T) {
+	endpoints := []zv1.MonitorEndpoint{
+		{
+			Port: "metrics",
+		},
+		{
+			Port:     "admin",
+			Path:     "/admin/metrics",
+			Interval: "30s",
+			Scheme:   "https",
+		},
+	}
+	expectedEndpoints := []interface{}{
+		map[string]interface{}{
+			"port": "metrics",
+		},
+		map[string]interface{}{
+			"port":     "admin",
+			"path":     "/admin/metrics",
+			"interval": "30s",
+			"scheme":   "https",
+		},
+	}
+
+	for _, tc := range []struct {
+		name                   string
+		monitor                *zv1.StackSetMonitor
+		expectedKind           string
+		expectedEndpointsField string
+		expectedNil            bool
+		expectedError          bool
+	}{
+		{
+			name:        "no monitor configured",
+			expectedNil: true,
+		},
+		{
+			name: "pod monitor",
+			monitor: &zv1.StackSetMonitor{
+				Kind:      zv1.MonitorKindPodMonitor,
+				Endpoints: endpoints,
+			},
+			expectedKind:           "PodMonitor",
+			expectedEndpointsField: "podMetricsEndpoints",
+		},
+		{
+			name: "service monitor",
+			monitor: &zv1.StackSetMonitor{
+				Kind:      zv1.MonitorKindServiceMonitor,
+				Endpoints: endpoints,
+			},
+			expectedKind:           "ServiceMonitor",
+			expectedEndpointsField: "endpoints",
+		},
+		{
+			name: "unsupported kind",
+			monitor: &zv1.StackSetMonitor{
+				Kind:      "Probe",
+				Endpoints: endpoints,
+			},
+			expectedError: true,
+		},
+		{
+			name: "no endpoints",
+			monitor: &zv1.StackSetMonitor{
+				Kind: zv1.MonitorKindPodMonitor,
+			},
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			container := &StackContainer{
+				Stack: &zv1.Stack{
+					ObjectMeta: testStackMeta,
+				},
+				monitor: tc.monitor,
+			}
+
+			monitor, err := container.GenerateMonitor()
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tc.expectedNil {
+				require.Nil(t, monitor)
+				return
+			}
+
+			require.Equal(t, &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "monitoring.coreos.com/v1",
+					"kind":       tc.expectedKind,
+					"metadata": map[string]interface{}{
+						"name":      "foo-v1",
+						"namespace": "bar",
+						"labels": map[string]interface{}{
+							StacksetHeritageLabelKey: "foo",
+							StackVersionLabelKey:     "v1",
+							"stack-label":            "foobar",
+						},
+						"annotations": map[string]interface{}{
+							stackGenerationAnnotationKey: "11",
+						},
+						"ownerReferences": []interface{}{
+							map[string]interface{}{
+								"apiVersion": APIVersion,
+								"kind":       KindStack,
+								"name":       "foo-v1",
+								"uid":        "abc-123",
+							},
+						},
+					},
+					"spec": map[string]interface{}{
+						"selector": map[string]interface{}{
+							"matchLabels": map[string]interface{}{
+								StacksetHeritageLabelKey: "foo",
+								StackVersionLabelKey:     "v1",
+							},
+						},
+						"podTargetLabels": []interface{}{
+							StacksetHeritageLabelKey,
+							StackVersionLabelKey,
+						},
+						tc.expectedEndpointsField: expectedEndpoints,
+					},
+				},
+			}, monitor)
+		})
+	}
+}
+
+func TestGenerateMonitorLabels(t *testing.T) {
+	container := &StackContainer{
+		Stack: &zv1.Stack{
+			ObjectMeta: testStackMeta,
+		},
+		monitor: &zv1.StackSetMonitor{
+			Kind: zv1.MonitorKindPodMonitor,
+			Labels: map[string]string{
+				"prometheus":             "main",
+				StacksetHeritageLabelKey: "other",
+			},
+			Endpoints: []zv1.MonitorEndpoint{{Port: "metrics"}},
+		},
+	}
+
+	monitor, err := container.GenerateMonitor()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		StacksetHeritageLabelKey: "foo",
+		StackVersionLabelKey:     "v1",
+		"stack-label":            "foobar",
+		"prometheus":             "main",
+	}, monitor.GetLabels())
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"math"
+
+	autoscaling "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// PrescalingEstimator estimates the replicas needed for the traffic of the
+// stacks, which is used to compute the replicas a stack is prescaled to
+// before its traffic is increased.
+type PrescalingEstimator interface {
+	// Estimate returns the replicas needed for the traffic of the stacks
+	// together with the traffic they were estimated for. The traffic is 0
+	// if the replicas can't be estimated.
+	Estimate(stacks map[string]*StackContainer) (replicas float64, traffic float64)
+}
+
+// ReplicaRatioEstimator estimates the replicas assuming that the replicas of
+// a stack scale linearly with its traffic. It's the default estimator.
+type ReplicaRatioEstimator struct{}
+
+func (ReplicaRatioEstimator) Estimate(stacks map[string]*StackContainer) (float64, float64) {
+	totalReplicas := 0.0
+	totalTraffic := 0.0
+
+	for _, stack := range stacks {
+		if stack.prescalingActive {
+			// Stack is prescaled, there are several possibilities
+			if stack.deploymentReplicas <= stack.prescalingReplicas && stack.prescalingDesiredTrafficWeight > 0 {
+				// We can't get information out of the HPA, so let's use the information captured previously
+				totalReplicas += float64(stack.prescalingReplicas)
+				totalTraffic += stack.prescalingDesiredTrafficWeight
+			} else if stack.deploymentReplicas > stack.prescalingReplicas && stack.actualTrafficWeight > 0 {
+				// Even though prescaling is active, stack is scaled up to more replicas and it has traffic,
+				// let's assume that we can get more precise replicas/traffic information this way
+				totalReplicas += float64(stack.deploymentReplicas)
+				totalTraffic += stack.actualTrafficWeight
+			}
+		} else if stack.actualTrafficWeight > 0 {
+			// Stack has traffic and is not prescaled
+			totalReplicas += float64(stack.deploymentReplicas)
+			totalTraffic += stack.actualTrafficWeight
+		}
+	}
+	return totalReplicas, totalTraffic
+}
+
+// HPAMetricsEstimator estimates the replicas from the status of the HPAs of
+// the stacks getting traffic: like the HPA, the current replicas are scaled
+// by the highest ratio of a current metric value to its target. This works
+// for stacks with different resource profiles and for overprovisioned
+// stacks. Stacks without HPA metrics use their current replicas.
+type HPAMetricsEstimator struct{}
+
+func (HPAMetricsEstimator) Estimate(stacks map[string]*StackContainer) (float64, float64) {
+	totalReplicas := 0.0
+	totalTraffic := 0.0
+
+	for _, stack := range stacks {
+		if stack.actualTrafficWeight <= 0 {
+			continue
+		}
+
+		replicas, ok := hpaDesiredReplicas(stack.Resources.HPA)
+		if !ok {
+			replicas = float64(stack.deploymentReplicas)
+		}
+		totalReplicas += replicas
+		totalTraffic += stack.actualTrafficWeight
+	}
+	return totalReplicas, totalTraffic
+}
+
+// hpaDesiredReplicas returns the replicas needed for the current metric
+// values of the HPA, without rounding or limiting them to the min and max
+// replicas.
+func hpaDesiredReplicas(hpa *autoscaling.HorizontalPodAutoscaler) (float64, bool) {
+	if hpa == nil || hpa.Status.CurrentReplicas <= 0 {
+		return 0, false
+	}
+
+	maxRatio := 0.0
+	found := false
+	for _, spec := range hpa.Spec.Metrics {
+		for _, status := range hpa.Status.CurrentMetrics {
+			target, current, ok := matchingMetricValues(spec, status)
+			if !ok {
+				continue
+			}
+			ratio, ok := metricUsageRatio(target, current)
+			if !ok {
+				continue
+			}
+			maxRatio = math.Max(maxRatio, ratio)
+			found = true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	return float64(hpa.Status.CurrentReplicas) * maxRatio, true
+}
+
+// matchingMetricValues returns the target and the current value of the
+// metric if the status belongs to the metric spec.
+func matchingMetricValues(spec autoscaling.MetricSpec, status autoscaling.MetricStatus) (autoscaling.MetricTarget, autoscaling.MetricValueStatus, bool) {
+	if spec.Type != status.Type {
+		return autoscaling.MetricTarget{}, autoscaling.MetricValueStatus{}, false
+	}
+
+	switch spec.Type {
+	case autoscaling.ResourceMetricSourceType:
+		if spec.Resource != nil && status.Resource != nil && spec.Resource.Name == status.Resource.Name {
+			return spec.Resource.Target, status.Resource.Current, true
+		}
+	case autoscaling.ContainerResourceMetricSourceType:
+		if spec.ContainerResource != nil && status.ContainerResource != nil &&
+			spec.ContainerResource.Name == status.ContainerResource.Name &&
+			spec.ContainerResource.Container == status.ContainerResource.Container {
+			return spec.ContainerResource.Target, status.ContainerResource.Current, true
+		}
+	case autoscaling.PodsMetricSourceType:
+		if spec.Pods != nil && status.Pods != nil && equality.Semantic.DeepEqual(spec.Pods.Metric, status.Pods.Metric) {
+			return spec.Pods.Target, status.Pods.Current, true
+		}
+	case autoscaling.ObjectMetricSourceType:
+		if spec.Object != nil && status.Object != nil &&
+			spec.Object.DescribedObject == status.Object.DescribedObject &&
+			equality.Semantic.DeepEqual(spec.Object.Metric, status.Object.Metric) {
+			return spec.Object.Target, status.Object.Current, true
+		}
+	case autoscaling.ExternalMetricSourceType:
+		if spec.External != nil && status.External != nil && equality.Semantic.DeepEqual(spec.External.Metric, status.External.Metric) {
+			return spec.External.Target, status.External.Current, true
+		}
+	}
+	return autoscaling.MetricTarget{}, autoscaling.MetricValueStatus{}, false
+}
+
+// metricUsageRatio returns the ratio of the current value of a metric to
+// its target.
+func metricUsageRatio(target autoscaling.MetricTarget, current autoscaling.MetricValueStatus) (float64, bool) {
+	switch target.Type {
+	case autoscaling.UtilizationMetricType:
+		if target.AverageUtilization == nil || *target.AverageUtilization <= 0 || current.AverageUtilization == nil {
+			return 0, false
+		}
+		return float64(*current.AverageUtilization) / float64(*target.AverageUtilization), true
+	case autoscaling.AverageValueMetricType:
+		if target.AverageValue == nil || target.AverageValue.MilliValue() <= 0 || current.AverageValue == nil {
+			return 0, false
+		}
+		return float64(current.AverageValue.MilliValue()) / float64(target.AverageValue.MilliValue()), true
+	case autoscaling.ValueMetricType:
+		if target.Value == nil || target.Value.MilliValue() <= 0 || current.Value == nil {
+			return 0, false
+		}
+		return float64(current.Value.MilliValue()) / float64(target.Value.MilliValue()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	autoscaling "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func testHPAWithMetrics(currentReplicas int32, specs []autoscaling.MetricSpec, statuses []autoscaling.MetricStatus) *autoscaling.HorizontalPodAutoscaler {
+	return &autoscaling.HorizontalPodAutoscaler{
+		Spec: autoscaling.HorizontalPodAutoscalerSpec{
+			Metrics: specs,
+		},
+		Status: autoscaling.HorizontalPodAutoscalerStatus{
+			CurrentReplicas: currentReplicas,
+			CurrentMetrics:  statuses,
+		},
+	}
+}
+
+func testCPUMetricSpec(utilization int32) autoscaling.MetricSpec {
+	return autoscaling.MetricSpec{
+		Type: autoscaling.ResourceMetricSourceType,
+		Resource: &autoscaling.ResourceMetricSource{
+			Name: v1.ResourceCPU,
+			Target: autoscaling.MetricTarget{
+				Type:               autoscaling.UtilizationMetricType,
+				AverageUtilization: &utilization,
+			},
+		},
+	}
+}
+
+func testCPUMetricStatus(utilization int32) autoscaling.MetricStatus {
+	return autoscaling.MetricStatus{
+		Type: autoscaling.ResourceMetricSourceType,
+		Resource: &autoscaling.ResourceMetricStatus{
+			Name: v1.ResourceCPU,
+			Current: autoscaling.MetricValueStatus{
+				AverageUtilization: &utilization,
+			},
+		},
+	}
+}
+
+func testExternalMetricSpec(name string, average string) autoscaling.MetricSpec {
+	value := resource.MustParse(average)
+	return autoscaling.MetricSpec{
+		Type: autoscaling.ExternalMetricSourceType,
+		External: &autoscaling.ExternalMetricSource{
+			Metric: autoscaling.MetricIdentifier{Name: name},
+			Target: autoscaling.MetricTarget{
+				Type:         autoscaling.AverageValueMetricType,
+				AverageValue: &value,
+			},
+		},
+	}
+}
+
+func testExternalMetricStatus(name string, average string) autoscaling.MetricStatus {
+	value := resource.MustParse(average)
+	return autoscaling.MetricStatus{
+		Type: autoscaling.ExternalMetricSourceType,
+		External: &autoscaling.ExternalMetricStatus{
+			Metric: autoscaling.MetricIdentifier{Name: name},
+			Current: autoscaling.MetricValueStatus{
+				AverageValue: &value,
+			},
+		},
+	}
+}
+
+func TestHPADesiredReplicas(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		hpa              *autoscaling.HorizontalPodAutoscaler
+		expectedReplicas float64
+		expectedOk       bool
+	}{
+		{
+			name: "no hpa",
+		},
+		{
+			name: "no current replicas",
+			hpa: testHPAWithMetrics(0,
+				[]autoscaling.MetricSpec{testCPUMetricSpec(50)},
+				[]autoscaling.MetricStatus{testCPUMetricStatus(25)}),
+		},
+		{
+			name: "no current metrics",
+			hpa: testHPAWithMetrics(10,
+				[]autoscaling.MetricSpec{testCPUMetricSpec(50)},
+				nil),
+		},
+		{
+			name: "overprovisioned stack",
+			hpa: testHPAWithMetrics(10,
+				[]autoscaling.MetricSpec{testCPUMetricSpec(50)},
+				[]autoscaling.MetricStatus{testCPUMetricStatus(25)}),
+			expectedReplicas: 5,
+			expectedOk:       true,
+		},
+		{
+			name: "highest ratio of multiple metrics",
+			hpa: testHPAWithMetrics(10,
+				[]autoscaling.MetricSpec{testCPUMetricSpec(50), testExternalMetricSpec("queue-length", "100")},
+				[]autoscaling.MetricStatus{testExternalMetricStatus("queue-length", "150"), testCPUMetricStatus(25)}),
+			expectedReplicas: 15,
+			expectedOk:       true,
+		},
+		{
+			name: "metrics of another source are ignored",
+			hpa: testHPAWithMetrics(10,
+				[]autoscaling.MetricSpec{testExternalMetricSpec("queue-length", "100")},
+				[]autoscaling.MetricStatus{testExternalMetricStatus("requests", "150")}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			replicas, ok := hpaDesiredReplicas(tc.hpa)
+			require.Equal(t, tc.expectedOk, ok)
+			require.Equal(t, tc.expectedReplicas, replicas)
+		})
+	}
+}
+
+func TestTrafficSwitchPrescalingHPAMetrics(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		estimator        PrescalingEstimator
+		expectedReplicas int32
+	}{
+		{
+			name:             "replica ratio by default",
+			expectedReplicas: 8,
+		},
+		{
+			name:             "hpa metrics",
+			estimator:        HPAMetricsEstimator{},
+			expectedReplicas: 4,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// The old stack runs at half of its target utilization
+			oldStack := testStack("foo-v1").traffic(20, 100).ready(10).stack()
+			oldStack.Resources.HPA = testHPAWithMetrics(10,
+				[]autoscaling.MetricSpec{testCPUMetricSpec(50)},
+				[]autoscaling.MetricStatus{testCPUMetricStatus(25)})
+			newStack := testStack("foo-v2").traffic(80, 0).stack()
+
+			c := StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Spec: zv1.StackSetSpec{
+						Ingress: &zv1.StackSetIngressSpec{},
+					},
+				},
+				StackContainers: map[types.UID]*StackContainer{
+					"foo-v1": oldStack,
+					"foo-v2": newStack,
+				},
+				TrafficReconciler: PrescalingTrafficReconciler{
+					ResetHPAMinReplicasTimeout: 5 * time.Minute,
+					Estimator:                  tc.estimator,
+				},
+			}
+
+			err := c.ManageTraffic(time.Now())
+			require.Error(t, err)
+			require.True(t, newStack.prescalingActive)
+			require.Equal(t, tc.expectedReplicas, newStack.prescalingReplicas)
+		})
+	}
+}
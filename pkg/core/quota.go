@@ -0,0 +1,141 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	quotaRequestsPrefix = "requests."
+	quotaLimitsPrefix   = "limits."
+
+	prescalingLimitedReason = "ResourceQuotaExceeded"
+)
+
+// podQuotaUsage returns the amount of a ResourceQuota resource used by a pod
+// with the given spec, or false if the pod doesn't use it. Like for the
+// scheduler, that's the higher of the largest init container and the sum of
+// the containers, plus the pod overhead.
+func podQuotaUsage(podSpec *corev1.PodSpec, name corev1.ResourceName) (resource.Quantity, bool) {
+	if name == corev1.ResourcePods {
+		return *resource.NewQuantity(1, resource.DecimalSI), true
+	}
+
+	resourceName := string(name)
+	useLimits := false
+	switch {
+	case strings.HasPrefix(resourceName, quotaRequestsPrefix):
+		resourceName = strings.TrimPrefix(resourceName, quotaRequestsPrefix)
+	case strings.HasPrefix(resourceName, quotaLimitsPrefix):
+		resourceName = strings.TrimPrefix(resourceName, quotaLimitsPrefix)
+		useLimits = true
+	case name != corev1.ResourceCPU && name != corev1.ResourceMemory && name != corev1.ResourceEphemeralStorage:
+		return resource.Quantity{}, false
+	}
+
+	containerUsage := func(container corev1.Container) (resource.Quantity, bool) {
+		resources := container.Resources.Requests
+		if useLimits {
+			resources = container.Resources.Limits
+		}
+		quantity, ok := resources[corev1.ResourceName(resourceName)]
+		return quantity, ok
+	}
+
+	var total resource.Quantity
+	for _, container := range podSpec.Containers {
+		if quantity, ok := containerUsage(container); ok {
+			total.Add(quantity)
+		}
+	}
+	for _, container := range podSpec.InitContainers {
+		if quantity, ok := containerUsage(container); ok && quantity.Cmp(total) > 0 {
+			total = quantity.DeepCopy()
+		}
+	}
+	if overhead, ok := podSpec.Overhead[corev1.ResourceName(resourceName)]; ok {
+		total.Add(overhead)
+	}
+	return total, !total.IsZero()
+}
+
+// quotaHeadroomReplicas returns how many more pods with the given spec fit
+// into the ResourceQuotas and the name of the most limiting one. Quotas with
+// scopes are ignored. It returns false if none of the quotas limits the pods.
+func quotaHeadroomReplicas(quotas []corev1.ResourceQuota, podSpec *corev1.PodSpec) (int32, string, bool) {
+	headroom := int64(math.MaxInt32)
+	limitingQuota := ""
+	for _, quota := range quotas {
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+
+		for name, hard := range quota.Status.Hard {
+			perPod, ok := podQuotaUsage(podSpec, name)
+			if !ok {
+				continue
+			}
+
+			available := hard.DeepCopy()
+			if used, ok := quota.Status.Used[name]; ok {
+				available.Sub(used)
+			}
+
+			pods := int64(0)
+			if available.Sign() > 0 {
+				pods = available.MilliValue() / perPod.MilliValue()
+			}
+			if pods < headroom {
+				headroom = pods
+				limitingQuota = quota.Name
+			}
+		}
+	}
+
+	if limitingQuota == "" {
+		return 0, "", false
+	}
+	return int32(headroom), limitingQuota, true
+}
+
+// limitPrescalingReplicas limits the prescaling replicas of the stack to the
+// headroom of the ResourceQuotas, so traffic is switched to the stack once
+// it's scaled up as far as possible instead of waiting for pods which can't
+// be created. The PrescalingLimited condition is set while the replicas are
+// limited. It returns false if the quotas don't even allow minReplicas, the
+// stack can't be prescaled in this case.
+func (sc *StackContainer) limitPrescalingReplicas(quotas []corev1.ResourceQuota, replicas, minReplicas int32) (int32, bool) {
+	headroom, quota, ok := quotaHeadroomReplicas(quotas, sc.podSpec())
+	if !ok || replicas <= sc.deploymentReplicas+headroom {
+		meta.RemoveStatusCondition(&sc.conditions, zv1.PrescalingLimited)
+		return replicas, true
+	}
+
+	limited := sc.deploymentReplicas + headroom
+	if limited < minReplicas {
+		meta.SetStatusCondition(&sc.conditions, metav1.Condition{
+			Type:               zv1.PrescalingLimited,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: sc.Stack.Generation,
+			Reason:             prescalingLimitedReason,
+			Message:            fmt.Sprintf("prescaling not possible, ResourceQuota %s only allows %d of at least %d replicas", quota, limited, minReplicas),
+		})
+		return 0, false
+	}
+
+	meta.SetStatusCondition(&sc.conditions, metav1.Condition{
+		Type:               zv1.PrescalingLimited,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sc.Stack.Generation,
+		Reason:             prescalingLimitedReason,
+		Message:            fmt.Sprintf("prescaling limited to %d of %d replicas by ResourceQuota %s", limited, replicas, quota),
+	})
+	return limited, true
+}
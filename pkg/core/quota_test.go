@@ -0,0 +1,304 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func testQuota(name string, hard, used corev1.ResourceList) corev1.ResourceQuota {
+	return corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: hard,
+			Used: used,
+		},
+	}
+}
+
+func testQuotaPodSpec() *corev1.PodSpec {
+	return &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name: "app",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("500m"),
+						corev1.ResourceMemory: resource.MustParse("1Gi"),
+					},
+					Limits: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("2Gi"),
+					},
+				},
+			},
+			{
+				Name: "sidecar",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU: resource.MustParse("500m"),
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestQuotaHeadroomReplicas(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		quotas           []corev1.ResourceQuota
+		expectedHeadroom int32
+		expectedQuota    string
+		expectedLimited  bool
+	}{
+		{
+			name: "no quotas",
+		},
+		{
+			name: "cpu requests",
+			quotas: []corev1.ResourceQuota{
+				testQuota("compute",
+					corev1.ResourceList{"requests.cpu": resource.MustParse("10")},
+					corev1.ResourceList{"requests.cpu": resource.MustParse("4500m")}),
+			},
+			expectedHeadroom: 5,
+			expectedQuota:    "compute",
+			expectedLimited:  true,
+		},
+		{
+			name: "the most limiting quota wins",
+			quotas: []corev1.ResourceQuota{
+				testQuota("compute",
+					corev1.ResourceList{"cpu": resource.MustParse("100"), "limits.memory": resource.MustParse("20Gi")},
+					corev1.ResourceList{"cpu": resource.MustParse("10"), "limits.memory": resource.MustParse("14Gi")}),
+				testQuota("pods",
+					corev1.ResourceList{"pods": resource.MustParse("50")},
+					corev1.ResourceList{"pods": resource.MustParse("46")}),
+			},
+			expectedHeadroom: 3,
+			expectedQuota:    "compute",
+			expectedLimited:  true,
+		},
+		{
+			name: "exhausted quota",
+			quotas: []corev1.ResourceQuota{
+				testQuota("pods",
+					corev1.ResourceList{"pods": resource.MustParse("10")},
+					corev1.ResourceList{"pods": resource.MustParse("12")}),
+			},
+			expectedHeadroom: 0,
+			expectedQuota:    "pods",
+			expectedLimited:  true,
+		},
+		{
+			name: "resources not used by the pods are ignored",
+			quotas: []corev1.ResourceQuota{
+				testQuota("storage",
+					corev1.ResourceList{"requests.storage": resource.MustParse("10Gi"), "limits.cpu": resource.MustParse("1")},
+					corev1.ResourceList{"requests.storage": resource.MustParse("10Gi"), "limits.cpu": resource.MustParse("1")}),
+			},
+		},
+		{
+			name: "quotas with scopes are ignored",
+			quotas: []corev1.ResourceQuota{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "best-effort"},
+					Spec: corev1.ResourceQuotaSpec{
+						Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort},
+					},
+					Status: corev1.ResourceQuotaStatus{
+						Hard: corev1.ResourceList{"pods": resource.MustParse("0")},
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			headroom, quota, limited := quotaHeadroomReplicas(tc.quotas, testQuotaPodSpec())
+			require.Equal(t, tc.expectedLimited, limited)
+			require.Equal(t, tc.expectedHeadroom, headroom)
+			require.Equal(t, tc.expectedQuota, quota)
+		})
+	}
+}
+
+func TestTrafficSwitchPrescalingQuota(t *testing.T) {
+	now := time.Now()
+
+	newStack := testStack("foo-v2").traffic(100, 0).ready(2).stack()
+	newStack.Stack.Spec.PodTemplate.Spec = *testQuotaPodSpec()
+
+	c := StackSetContainer{
+		StackSet: &zv1.StackSet{
+			Spec: zv1.StackSetSpec{
+				Ingress: &zv1.StackSetIngressSpec{},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"foo-v1": testStack("foo-v1").traffic(0, 100).ready(10).stack(),
+			"foo-v2": newStack,
+		},
+		TrafficReconciler: PrescalingTrafficReconciler{
+			ResetHPAMinReplicasTimeout: 5 * time.Minute,
+			ResourceQuotas: []corev1.ResourceQuota{
+				testQuota("pods",
+					corev1.ResourceList{"pods": resource.MustParse("15")},
+					corev1.ResourceList{"pods": resource.MustParse("12")}),
+			},
+		},
+	}
+
+	// The new stack can only be scaled to 2+3 replicas instead of 10
+	err := c.ManageTraffic(now)
+	require.Error(t, err)
+	require.EqualValues(t, 5, newStack.prescalingReplicas)
+	condition := meta.FindStatusCondition(newStack.conditions, zv1.PrescalingLimited)
+	require.NotNil(t, condition)
+	require.Equal(t, metav1.ConditionTrue, condition.Status)
+	require.Equal(t, "prescaling limited to 5 of 10 replicas by ResourceQuota pods", condition.Message)
+
+	// Traffic is switched once the stack is scaled up as far as possible
+	newStack.deploymentReplicas = 5
+	newStack.updatedReplicas = 5
+	newStack.readyReplicas = 5
+	err = c.ManageTraffic(now)
+	require.NoError(t, err)
+	require.EqualValues(t, 100, newStack.actualTrafficWeight)
+
+	// The condition is removed when the prescaling is reset
+	newStack.prescalingLastTrafficIncrease = now.Add(-10 * time.Minute)
+	err = c.ManageTraffic(now)
+	require.NoError(t, err)
+	require.Nil(t, meta.FindStatusCondition(newStack.conditions, zv1.PrescalingLimited))
+}
+
+func TestPodQuotaUsage(t *testing.T) {
+	podSpec := testQuotaPodSpec()
+	podSpec.InitContainers = []corev1.Container{
+		{
+			Name: "migrate",
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("2"),
+					corev1.ResourceMemory: resource.MustParse("512Mi"),
+				},
+			},
+		},
+	}
+	podSpec.Overhead = corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("100m"),
+		corev1.ResourceMemory: resource.MustParse("128Mi"),
+	}
+
+	for _, tc := range []struct {
+		name          string
+		resource      corev1.ResourceName
+		expectedUsage resource.Quantity
+	}{
+		{
+			name:          "the init container uses more than the containers",
+			resource:      "requests.cpu",
+			expectedUsage: resource.MustParse("2100m"),
+		},
+		{
+			name:          "the containers use more than the init container",
+			resource:      "requests.memory",
+			expectedUsage: resource.MustParse("1152Mi"),
+		},
+		{
+			name:          "limits",
+			resource:      "limits.memory",
+			expectedUsage: resource.MustParse("2176Mi"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			usage, ok := podQuotaUsage(podSpec, tc.resource)
+			require.True(t, ok)
+			require.Zero(t, tc.expectedUsage.Cmp(usage), "expected %s, got %s", tc.expectedUsage.String(), usage.String())
+		})
+	}
+}
+
+func TestTrafficSwitchPrescalingQuotaExhausted(t *testing.T) {
+	now := time.Now()
+
+	newStack := testStack("foo-v2").traffic(100, 0).ready(0).stack()
+	newStack.Stack.Spec.PodTemplate.Spec = *testQuotaPodSpec()
+
+	c := StackSetContainer{
+		StackSet: &zv1.StackSet{
+			Spec: zv1.StackSetSpec{
+				Ingress: &zv1.StackSetIngressSpec{},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"foo-v1": testStack("foo-v1").traffic(0, 100).ready(10).stack(),
+			"foo-v2": newStack,
+		},
+		TrafficReconciler: PrescalingTrafficReconciler{
+			ResetHPAMinReplicasTimeout: 5 * time.Minute,
+			ResourceQuotas: []corev1.ResourceQuota{
+				testQuota("pods",
+					corev1.ResourceList{"pods": resource.MustParse("10")},
+					corev1.ResourceList{"pods": resource.MustParse("10")}),
+			},
+		},
+	}
+
+	// The new stack can't get a single pod, so it isn't prescaled
+	err := c.ManageTraffic(now)
+	require.EqualError(t, err, "stacks can't be prescaled within the ResourceQuotas: foo-v2")
+	require.False(t, newStack.prescalingActive)
+	require.EqualValues(t, 0, newStack.prescalingReplicas)
+	require.EqualValues(t, 0, newStack.actualTrafficWeight)
+	condition := meta.FindStatusCondition(newStack.conditions, zv1.PrescalingLimited)
+	require.NotNil(t, condition)
+	require.Equal(t, "prescaling not possible, ResourceQuota pods only allows 0 of at least 1 replicas", condition.Message)
+
+	// The condition is removed once the traffic isn't increased anymore
+	newStack.desiredTrafficWeight = 0
+	c.StackContainers["foo-v1"].desiredTrafficWeight = 100
+	err = c.ManageTraffic(now)
+	require.NoError(t, err)
+	require.Nil(t, meta.FindStatusCondition(newStack.conditions, zv1.PrescalingLimited))
+}
+
+func TestTrafficSwitchPrescalingQuotaSeededRequests(t *testing.T) {
+	newStack := testStack("foo-v2").traffic(100, 0).ready(2).stack()
+	newStack.Stack.Spec.PodTemplate.Spec = *testQuotaPodSpec()
+	newStack.Stack.Spec.VerticalPodAutoscaler = &zv1.VerticalPodAutoscaler{Seed: zv1.VPASeedRequests}
+	newStack.Stack.Annotations = map[string]string{VPASeedAnnotationKey: `{"app":{"cpu":"1500m"}}`}
+
+	c := StackSetContainer{
+		StackSet: &zv1.StackSet{
+			Spec: zv1.StackSetSpec{
+				Ingress: &zv1.StackSetIngressSpec{},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"foo-v1": testStack("foo-v1").traffic(0, 100).ready(10).stack(),
+			"foo-v2": newStack,
+		},
+		TrafficReconciler: PrescalingTrafficReconciler{
+			ResetHPAMinReplicasTimeout: 5 * time.Minute,
+			ResourceQuotas: []corev1.ResourceQuota{
+				testQuota("compute",
+					corev1.ResourceList{"requests.cpu": resource.MustParse("20")},
+					corev1.ResourceList{"requests.cpu": resource.MustParse("14")}),
+			},
+		},
+	}
+
+	// The pods of the Deployment request 2 CPUs with the seeded requests
+	// instead of the 1 CPU of the pod template, so only 3 more fit
+	err := c.ManageTraffic(time.Now())
+	require.Error(t, err)
+	require.EqualValues(t, 5, newStack.prescalingReplicas)
+}
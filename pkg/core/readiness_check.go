@@ -0,0 +1,159 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	defaultReadinessCheckStatusCode = http.StatusOK
+	defaultReadinessCheckTimeout    = 5 * time.Second
+	defaultReadinessCheckPeriod     = 30 * time.Second
+
+	readinessCheckReasonSucceeded = "CheckSucceeded"
+	readinessCheckReasonFailed    = "CheckFailed"
+)
+
+// ReadinessCheckRequest describes the HTTP request made by the readiness
+// check of a stack.
+type ReadinessCheckRequest struct {
+	URL                string
+	ExpectedStatusCode int
+	Timeout            time.Duration
+	// Period defines how long the result of the check is valid.
+	Period time.Duration
+}
+
+// ReadinessCheckRequired returns true if the stack has to pass the HTTP
+// readiness check, i.e. if it's ready and its traffic should be increased.
+func (sc *StackContainer) ReadinessCheckRequired() bool {
+	return sc.readinessCheck != nil && sc.desiredTrafficWeight > sc.actualTrafficWeight && sc.IsReady()
+}
+
+// ReadinessCheckRequest returns the request made by the readiness check of
+// the stack.
+func (sc *StackContainer) ReadinessCheckRequest() (*ReadinessCheckRequest, error) {
+	if sc.readinessCheck == nil {
+		return nil, nil
+	}
+
+	url, err := sc.readinessCheckURL()
+	if err != nil {
+		return nil, err
+	}
+
+	request := &ReadinessCheckRequest{
+		URL:                url,
+		ExpectedStatusCode: defaultReadinessCheckStatusCode,
+		Timeout:            defaultReadinessCheckTimeout,
+		Period:             defaultReadinessCheckPeriod,
+	}
+	if sc.readinessCheck.ExpectedStatusCode != nil {
+		request.ExpectedStatusCode = int(*sc.readinessCheck.ExpectedStatusCode)
+	}
+	if sc.readinessCheck.TimeoutSeconds != nil {
+		request.Timeout = time.Duration(*sc.readinessCheck.TimeoutSeconds) * time.Second
+	}
+	if sc.readinessCheck.PeriodSeconds != nil {
+		request.Period = time.Duration(*sc.readinessCheck.PeriodSeconds) * time.Second
+	}
+	return request, nil
+}
+
+func (sc *StackContainer) readinessCheckURL() (string, error) {
+	path := sc.readinessCheck.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	switch sc.readinessCheck.Target {
+	case zv1.ReadinessCheckTargetHostname:
+		hostnames, err := sc.perStackHostnames()
+		if err != nil {
+			return "", err
+		}
+		if len(hostnames) == 0 {
+			return "", fmt.Errorf("stack %s has no per-stack hostname", sc.Name())
+		}
+		return fmt.Sprintf("https://%s%s", hostnames[0], path), nil
+	case zv1.ReadinessCheckTargetService, "":
+		port, err := sc.readinessCheckServicePort()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("http://%s.%s.svc:%d%s", sc.Name(), sc.Namespace(), port, path), nil
+	default:
+		return "", fmt.Errorf("unknown readiness check target: %s", sc.readinessCheck.Target)
+	}
+}
+
+// readinessCheckServicePort returns the port of the stack Service called by
+// the readiness check.
+func (sc *StackContainer) readinessCheckServicePort() (int32, error) {
+	if sc.readinessCheck.Port != nil {
+		return *sc.readinessCheck.Port, nil
+	}
+
+	if !sc.HasBackendPort() {
+		return 0, fmt.Errorf("readiness check port must be specified without a backendPort")
+	}
+
+	if sc.backendPort.Type == intstr.Int {
+		return sc.backendPort.IntVal, nil
+	}
+
+	servicePorts, err := getServicePorts(sc.Stack.Spec, sc.backendPort)
+	if err != nil {
+		return 0, err
+	}
+	for _, port := range servicePorts {
+		if port.Name == sc.backendPort.StrVal {
+			return port.Port, nil
+		}
+	}
+	return 0, fmt.Errorf("no service ports matching backendPort '%s'", sc.backendPort.String())
+}
+
+// SetReadinessCheckResult records the result of the readiness check in the
+// status of the stack.
+func (sc *StackContainer) SetReadinessCheckResult(succeeded bool, message string) {
+	status, reason := metav1.ConditionTrue, readinessCheckReasonSucceeded
+	if !succeeded {
+		status, reason = metav1.ConditionFalse, readinessCheckReasonFailed
+	}
+	meta.SetStatusCondition(&sc.conditions, metav1.Condition{
+		Type:               zv1.ReadinessCheckSucceeded,
+		Status:             status,
+		ObservedGeneration: sc.Stack.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// checkReadinessChecks returns an error if the traffic of a stack was
+// increased although its readiness check didn't succeed.
+func checkReadinessChecks(stacks map[string]*StackContainer, previousWeights map[string]float64) error {
+	var failedStacks []string
+	for stackName, stack := range stacks {
+		if stack.readinessCheck == nil || stack.actualTrafficWeight <= previousWeights[stackName] {
+			continue
+		}
+		if !meta.IsStatusConditionTrue(stack.conditions, zv1.ReadinessCheckSucceeded) {
+			failedStacks = append(failedStacks, stackName)
+		}
+	}
+
+	if len(failedStacks) > 0 {
+		sort.Strings(failedStacks)
+		return fmt.Errorf("readiness check not succeeded: %s", strings.Join(failedStacks, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestReadinessCheckRequest(t *testing.T) {
+	port := int32(9090)
+	statusCode := int32(204)
+	period := int32(60)
+
+	for _, tc := range []struct {
+		name            string
+		readinessCheck  *zv1.ReadinessCheck
+		backendPort     *intstr.IntOrString
+		expectedRequest *ReadinessCheckRequest
+		expectedError   bool
+	}{
+		{
+			name: "no readiness check",
+		},
+		{
+			name:           "service is called on the backend port",
+			readinessCheck: &zv1.ReadinessCheck{Path: "/health"},
+			backendPort:    &intstr.IntOrString{Type: intstr.Int, IntVal: 8080},
+			expectedRequest: &ReadinessCheckRequest{
+				URL:                "http://foo-v1.bar.svc:8080/health",
+				ExpectedStatusCode: 200,
+				Timeout:            5 * time.Second,
+				Period:             30 * time.Second,
+			},
+		},
+		{
+			name:           "named backend port is resolved",
+			readinessCheck: &zv1.ReadinessCheck{Path: "health"},
+			backendPort:    &intstr.IntOrString{Type: intstr.String, StrVal: "ingress"},
+			expectedRequest: &ReadinessCheckRequest{
+				URL:                "http://foo-v1.bar.svc:8081/health",
+				ExpectedStatusCode: 200,
+				Timeout:            5 * time.Second,
+				Period:             30 * time.Second,
+			},
+		},
+		{
+			name: "custom port, status code and period",
+			readinessCheck: &zv1.ReadinessCheck{
+				Path:               "/health",
+				Port:               &port,
+				ExpectedStatusCode: &statusCode,
+				PeriodSeconds:      &period,
+			},
+			expectedRequest: &ReadinessCheckRequest{
+				URL:                "http://foo-v1.bar.svc:9090/health",
+				ExpectedStatusCode: 204,
+				Timeout:            5 * time.Second,
+				Period:             60 * time.Second,
+			},
+		},
+		{
+			name:           "service port is required without a backend port",
+			readinessCheck: &zv1.ReadinessCheck{Path: "/health"},
+			expectedError:  true,
+		},
+		{
+			name:           "per-stack hostname is called",
+			readinessCheck: &zv1.ReadinessCheck{Path: "/health", Target: zv1.ReadinessCheckTargetHostname},
+			backendPort:    &intstr.IntOrString{Type: intstr.Int, IntVal: 8080},
+			expectedRequest: &ReadinessCheckRequest{
+				URL:                "https://foo-v1.example.org/health",
+				ExpectedStatusCode: 200,
+				Timeout:            5 * time.Second,
+				Period:             30 * time.Second,
+			},
+		},
+		{
+			name:           "hostname target requires a per-stack hostname",
+			readinessCheck: &zv1.ReadinessCheck{Path: "/health", Target: zv1.ReadinessCheckTargetHostname},
+			expectedError:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stack := testStack("foo-v1").stack()
+			stack.Stack.Namespace = "bar"
+			stack.Stack.Spec.PodTemplate.Spec.Containers = []v1.Container{
+				{
+					Ports: []v1.ContainerPort{
+						{Name: "main", ContainerPort: 8080},
+						{Name: "ingress", ContainerPort: 8081},
+					},
+				},
+			}
+			stack.readinessCheck = tc.readinessCheck
+			stack.backendPort = tc.backendPort
+			stack.clusterDomains = []string{"example.org"}
+			stack.ingressSpec = &zv1.StackSetIngressSpec{
+				Hosts: []string{"foo.example.org"},
+			}
+
+			request, err := stack.ReadinessCheckRequest()
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedRequest, request)
+		})
+	}
+}
+
+func TestTrafficSwitchReadinessCheck(t *testing.T) {
+	succeeded := true
+	failed := false
+
+	for _, tc := range []struct {
+		name                  string
+		stacks                map[types.UID]*StackContainer
+		expectedActualWeights map[string]float64
+		expectedError         string
+	}{
+		{
+			name: "traffic is increased once the readiness check succeeded",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(50, 100).ready(1).readinessCheck(&succeeded).stack(),
+				"foo-v2": testStack("foo-v2").traffic(50, 0).ready(1).readinessCheck(&succeeded).stack(),
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 50,
+				"foo-v2": 50,
+			},
+		},
+		{
+			name: "traffic is not increased if the readiness check failed",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(50, 80).ready(1).readinessCheck(&succeeded).stack(),
+				"foo-v2": testStack("foo-v2").traffic(50, 20).ready(1).readinessCheck(&failed).stack(),
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 80,
+				"foo-v2": 20,
+			},
+			expectedError: "readiness check not succeeded: foo-v2",
+		},
+		{
+			name: "traffic is not increased before the readiness check was performed",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(50, 100).ready(1).readinessCheck(nil).stack(),
+				"foo-v2": testStack("foo-v2").traffic(50, 0).ready(1).readinessCheck(nil).stack(),
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 100,
+				"foo-v2": 0,
+			},
+			expectedError: "readiness check not succeeded: foo-v2",
+		},
+		{
+			name: "traffic can be decreased without a successful readiness check",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(0, 50).ready(1).readinessCheck(&failed).stack(),
+				"foo-v2": testStack("foo-v2").traffic(100, 50).ready(1).readinessCheck(&succeeded).stack(),
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 0,
+				"foo-v2": 100,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Spec: zv1.StackSetSpec{
+						Ingress: &zv1.StackSetIngressSpec{},
+					},
+				},
+				StackContainers:   tc.stacks,
+				TrafficReconciler: SimpleTrafficReconciler{},
+			}
+
+			err := c.ManageTraffic(time.Now())
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+
+			for name, weight := range tc.expectedActualWeights {
+				require.Equal(t, weight, c.StackContainers[types.UID(name)].actualTrafficWeight, "actual weight, stack %s", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+)
+
+// recreateStackRequested returns true if the StackSet is annotated to
+// recreate the stack of the given version.
+func recreateStackRequested(stackset *zv1.StackSet, version string) bool {
+	return stackset.Annotations[RecreateStackAnnotationKey] == version
+}
+
+// CheckRecreateRequest returns an error if the StackSet is annotated to
+// recreate a stack which can't be recreated, because it still exists or
+// isn't of the current version. Such an annotation has to be removed, it
+// would recreate the stack unexpectedly later on otherwise.
+func (ssc *StackSetContainer) CheckRecreateRequest() error {
+	version, ok := ssc.StackSet.Annotations[RecreateStackAnnotationKey]
+	if !ok {
+		return nil
+	}
+
+	currentVersion, err := currentStackVersion(ssc.StackSet)
+	if err != nil {
+		return err
+	}
+	if version != currentVersion {
+		return fmt.Errorf("version %s is not the current version %s", version, currentVersion)
+	}
+
+	stackName := generateStackName(ssc.StackSet, version)
+	if ssc.stackByName(stackName) != nil {
+		return fmt.Errorf("stack %s still exists", stackName)
+	}
+	return nil
+}
+
+// GenerateStackSetWithoutRecreateRequest returns the StackSet without the
+// recreate annotation.
+func (ssc *StackSetContainer) GenerateStackSetWithoutRecreateRequest() *zv1.StackSet {
+	result := ssc.StackSet.DeepCopy()
+	delete(result.Annotations, RecreateStackAnnotationKey)
+	return result
+}
+
+// deletedStackTraffic returns the desired traffic weights of the stacks
+// which were deleted but can be recreated, i.e. the stack of the observed
+// version, as stored in the annotation.
+func deletedStackTraffic(stackset *zv1.StackSet) map[string]float64 {
+	weights := make(map[string]float64)
+	if data, ok := stackset.Annotations[DeletedStackTrafficAnnotationKey]; ok {
+		// an invalid annotation is overwritten or removed
+		_ = json.Unmarshal([]byte(data), &weights)
+	}
+	return weights
+}
+
+// GenerateStackSetDesiredTraffic returns the StackSet with the desired
+// traffic of its stacks. If the stack of the observed version was deleted,
+// its last desired traffic is kept in an annotation, so it can be restored
+// if the stack is recreated.
+func (ssc *StackSetContainer) GenerateStackSetDesiredTraffic() *zv1.StackSet {
+	result := ssc.StackSet.DeepCopy()
+	result.Spec.Traffic = ssc.GenerateStackSetTraffic()
+
+	observedVersion := ssc.StackSet.Status.ObservedStackVersion
+	if observedVersion == "" {
+		return result
+	}
+
+	stackName := generateStackName(ssc.StackSet, observedVersion)
+	if ssc.stackByName(stackName) != nil {
+		delete(result.Annotations, DeletedStackTrafficAnnotationKey)
+		return result
+	}
+
+	for _, desiredTraffic := range ssc.StackSet.Spec.Traffic {
+		if desiredTraffic.StackName == stackName && desiredTraffic.Weight > 0 {
+			data, err := json.Marshal(map[string]float64{stackName: desiredTraffic.Weight})
+			if err != nil {
+				return result
+			}
+			if result.Annotations == nil {
+				result.Annotations = make(map[string]string)
+			}
+			result.Annotations[DeletedStackTrafficAnnotationKey] = string(data)
+		}
+	}
+	return result
+}
+
+// GenerateRecreatedStackSet returns the StackSet after the stack with the
+// given name was recreated. The recreate annotation is removed and the
+// desired traffic the stack had before it was deleted is restored, the
+// traffic of the other stacks is reduced proportionally. If the stack had no
+// desired traffic, but the desired traffic of the StackSet went away with the
+// deleted stack, all the traffic is switched to the recreated stack.
+func (ssc *StackSetContainer) GenerateRecreatedStackSet(stackName string) *zv1.StackSet {
+	result := ssc.StackSet.DeepCopy()
+	delete(result.Annotations, RecreateStackAnnotationKey)
+	delete(result.Annotations, DeletedStackTrafficAnnotationKey)
+
+	spec := result.Spec
+	if spec.Ingress == nil && spec.RouteGroup == nil && spec.ExternalIngress == nil {
+		return result
+	}
+
+	// the stack still has desired traffic if it was deleted and recreated
+	// before the desired traffic was updated
+	weights := make(map[string]float64)
+	for _, sc := range ssc.StackContainers {
+		weights[sc.Name()] = 0
+	}
+	for _, desiredTraffic := range spec.Traffic {
+		if _, ok := weights[desiredTraffic.StackName]; ok || desiredTraffic.StackName == stackName {
+			weights[desiredTraffic.StackName] = desiredTraffic.Weight
+		}
+	}
+
+	if weight, ok := deletedStackTraffic(ssc.StackSet)[stackName]; ok && weights[stackName] == 0 {
+		restoreWeight(weights, stackName, weight)
+	}
+
+	if allZero(weights) {
+		result.Spec.Traffic = []*zv1.DesiredTraffic{
+			{
+				StackName: stackName,
+				Weight:    100,
+			},
+		}
+		return result
+	}
+
+	if weights[stackName] > 0 {
+		result.Spec.Traffic = desiredTrafficFromWeights(weights)
+	}
+	return result
+}
+
+// restoreWeight sets the weight of a stack and reduces the weights of the
+// other stacks proportionally, so they still add up to 100.
+func restoreWeight(weights map[string]float64, stackName string, weight float64) {
+	others := float64(0)
+	for name, w := range weights {
+		if name != stackName {
+			others += w
+		}
+	}
+	if others == 0 {
+		weight = 100
+	}
+	for name, w := range weights {
+		if name != stackName {
+			weights[name] = w / others * (100 - weight)
+		}
+	}
+	weights[stackName] = weight
+}
+
+// desiredTrafficFromWeights returns the desired traffic of the stacks with
+// a weight, sorted by the name of the stacks.
+func desiredTrafficFromWeights(weights map[string]float64) []*zv1.DesiredTraffic {
+	var traffic []*zv1.DesiredTraffic
+	for name, weight := range weights {
+		if weight > 0 {
+			traffic = append(traffic, &zv1.DesiredTraffic{StackName: name, Weight: weight})
+		}
+	}
+	sort.Slice(traffic, func(i, j int) bool {
+		return traffic[i].StackName < traffic[j].StackName
+	})
+	return traffic
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	defaultScaledownPercentage  = 50
+	defaultScaledownMinReplicas = 1
+)
+
+// gradualScaledownReplicas returns the number of replicas of a stack which
+// lost its traffic and is scaled down step by step. The replicas are reduced
+// by the configured percentage every interval, starting from the replicas the
+// stack had when it lost its traffic, until the minimum is reached. The second
+// return value is false if the stack is not scaled down gradually.
+func (sc *StackContainer) gradualScaledownReplicas() (int32, bool) {
+	if sc.scaledown == nil || sc.scaledown.IntervalSeconds <= 0 || sc.lastTrafficReplicas == 0 {
+		return 0, false
+	}
+	if sc.HasTraffic() || sc.IsPinned() || sc.noTrafficSince.IsZero() || sc.ScaledDown() {
+		return 0, false
+	}
+
+	percentage := int32(defaultScaledownPercentage)
+	if sc.scaledown.Percentage != nil {
+		percentage = *sc.scaledown.Percentage
+	}
+	minReplicas := int32(defaultScaledownMinReplicas)
+	if sc.scaledown.MinReplicas != nil {
+		minReplicas = *sc.scaledown.MinReplicas
+	}
+
+	replicas := sc.lastTrafficReplicas
+	if replicas <= minReplicas {
+		return replicas, true
+	}
+
+	steps := int64(time.Since(sc.noTrafficSince) / (time.Duration(sc.scaledown.IntervalSeconds) * time.Second))
+	for i := int64(0); i < steps && replicas > minReplicas; i++ {
+		reduced := int32(math.Ceil(float64(replicas) * float64(percentage) / 100))
+		if reduced >= replicas {
+			reduced = replicas - 1
+		}
+		replicas = reduced
+	}
+
+	if replicas < minReplicas {
+		replicas = minReplicas
+	}
+	return replicas, true
+}
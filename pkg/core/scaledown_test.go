@@ -0,0 +1,156 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestGradualScaledownReplicas(t *testing.T) {
+	percentage := int32(25)
+	minReplicas := int32(3)
+
+	for _, tc := range []struct {
+		name                string
+		scaledown           *zv1.GradualScaledown
+		lastTrafficReplicas int32
+		noTrafficSince      time.Duration
+		traffic             float64
+		expectedReplicas    int32
+		expectedScalingDown bool
+	}{
+		{
+			name:                "gradual scale-down not configured",
+			lastTrafficReplicas: 20,
+			noTrafficSince:      90 * time.Second,
+		},
+		{
+			name:                "stack which never had traffic",
+			scaledown:           &zv1.GradualScaledown{IntervalSeconds: 60},
+			lastTrafficReplicas: 0,
+			noTrafficSince:      90 * time.Second,
+		},
+		{
+			name:                "stack with traffic",
+			scaledown:           &zv1.GradualScaledown{IntervalSeconds: 60},
+			lastTrafficReplicas: 20,
+			traffic:             10,
+		},
+		{
+			name:                "stack already scaled down",
+			scaledown:           &zv1.GradualScaledown{IntervalSeconds: 60},
+			lastTrafficReplicas: 20,
+			noTrafficSince:      time.Hour,
+		},
+		{
+			name:                "stack just lost its traffic",
+			scaledown:           &zv1.GradualScaledown{IntervalSeconds: 60},
+			lastTrafficReplicas: 20,
+			noTrafficSince:      30 * time.Second,
+			expectedReplicas:    20,
+			expectedScalingDown: true,
+		},
+		{
+			name:                "replicas are halved every interval",
+			scaledown:           &zv1.GradualScaledown{IntervalSeconds: 60},
+			lastTrafficReplicas: 20,
+			noTrafficSince:      150 * time.Second,
+			expectedReplicas:    5,
+			expectedScalingDown: true,
+		},
+		{
+			name:                "replicas are reduced to one by default",
+			scaledown:           &zv1.GradualScaledown{IntervalSeconds: 60},
+			lastTrafficReplicas: 8,
+			noTrafficSince:      290 * time.Second,
+			expectedReplicas:    1,
+			expectedScalingDown: true,
+		},
+		{
+			name:                "custom percentage and min replicas",
+			scaledown:           &zv1.GradualScaledown{IntervalSeconds: 60, Percentage: &percentage, MinReplicas: &minReplicas},
+			lastTrafficReplicas: 20,
+			noTrafficSince:      150 * time.Second,
+			expectedReplicas:    3,
+			expectedScalingDown: true,
+		},
+		{
+			name:                "replicas below the minimum are kept",
+			scaledown:           &zv1.GradualScaledown{IntervalSeconds: 60, MinReplicas: &minReplicas},
+			lastTrafficReplicas: 2,
+			noTrafficSince:      150 * time.Second,
+			expectedReplicas:    2,
+			expectedScalingDown: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stack := testStack("foo-v1").traffic(tc.traffic, tc.traffic).stack()
+			stack.scaledown = tc.scaledown
+			stack.scaledownTTL = 5 * time.Minute
+			stack.lastTrafficReplicas = tc.lastTrafficReplicas
+			if tc.noTrafficSince != 0 {
+				stack.noTrafficSince = time.Now().Add(-tc.noTrafficSince)
+			}
+
+			replicas, scalingDown := stack.gradualScaledownReplicas()
+			require.Equal(t, tc.expectedScalingDown, scalingDown)
+			require.Equal(t, tc.expectedReplicas, replicas)
+		})
+	}
+}
+
+func TestGradualScaledownGenerateResources(t *testing.T) {
+	minReplicas := int32(10)
+
+	stack := testStack("foo-v1").stack()
+	stack.Stack.Spec.Autoscaler = &zv1.Autoscaler{
+		MinReplicas: &minReplicas,
+		MaxReplicas: 30,
+	}
+	stack.scaledown = &zv1.GradualScaledown{IntervalSeconds: 60}
+	stack.scaledownTTL = 5 * time.Minute
+	stack.stackReplicas = 10
+	stack.deploymentReplicas = 12
+	stack.lastTrafficReplicas = 20
+	stack.noTrafficSince = time.Now().Add(-90 * time.Second)
+
+	deployment := stack.GenerateDeployment()
+	require.Equal(t, int32(10), *deployment.Spec.Replicas)
+
+	hpa, err := stack.GenerateHPA()
+	require.NoError(t, err)
+	require.Equal(t, int32(10), *hpa.Spec.MinReplicas)
+	require.Equal(t, int32(10), hpa.Spec.MaxReplicas)
+
+	// the replicas are not increased by the scale-down
+	stack.deploymentReplicas = 4
+	deployment = stack.GenerateDeployment()
+	require.Equal(t, int32(4), *deployment.Spec.Replicas)
+}
+
+func TestManageTrafficLastTrafficReplicas(t *testing.T) {
+	c := StackSetContainer{
+		StackSet: &zv1.StackSet{
+			Spec: zv1.StackSetSpec{
+				Ingress: &zv1.StackSetIngressSpec{},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"foo-v1": testStack("foo-v1").traffic(0, 100).currentActualTrafficWeight(100).ready(7).stack(),
+			"foo-v2": testStack("foo-v2").traffic(100, 0).ready(3).stack(),
+			"foo-v3": testStack("foo-v3").traffic(0, 0).ready(5).stack(),
+		},
+		TrafficReconciler: SimpleTrafficReconciler{},
+	}
+	c.StackContainers["foo-v2"].lastTrafficReplicas = 3
+
+	err := c.ManageTraffic(time.Now())
+	require.NoError(t, err)
+
+	require.Equal(t, int32(7), c.StackContainers["foo-v1"].lastTrafficReplicas)
+	require.Equal(t, int32(0), c.StackContainers["foo-v2"].lastTrafficReplicas)
+	require.Equal(t, int32(0), c.StackContainers["foo-v3"].lastTrafficReplicas)
+}
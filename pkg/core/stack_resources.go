@@ -13,6 +13,7 @@ import (
 	autoscaling "k8s.io/api/autoscaling/v2"
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -163,11 +164,23 @@ func (sc *StackContainer) GenerateDeployment() *appsv1.Deployment {
 
 	var updatedReplicas *int32
 
-	if desiredReplicas != 0 && !sc.ScaledDown() {
+	scaledownReplicas, scalingDown := sc.gradualScaledownReplicas()
+
+	if desiredReplicas != 0 && scalingDown {
+		// Stack lost its traffic, reduce the replicas step by step
+		if sc.deploymentReplicas > scaledownReplicas || (!sc.IsAutoscaled() && sc.deploymentReplicas != scaledownReplicas) {
+			updatedReplicas = wrapReplicas(scaledownReplicas)
+		}
+	} else if desiredReplicas != 0 && !sc.ScaledDown() {
 		// Stack scaled up, rescale the deployment if it's at 0 replicas, or if HPA is unused and we don't run autoscaling
 		if sc.deploymentReplicas == 0 || (!sc.IsAutoscaled() && desiredReplicas != sc.deploymentReplicas) {
 			updatedReplicas = wrapReplicas(desiredReplicas)
 		}
+	} else if desiredReplicas != 0 && sc.IsWarmStandby() {
+		// Stack doesn't receive traffic, but is kept as warm standby
+		if sc.deploymentReplicas != sc.warmStandbyReplicas {
+			updatedReplicas = wrapReplicas(sc.warmStandbyReplicas)
+		}
 	} else {
 		// Stack scaled down (manually or because it doesn't receive traffic), check if we need to scale down the deployment
 		if sc.deploymentReplicas != 0 {
@@ -201,7 +214,7 @@ func (sc *StackContainer) GenerateDeployment() *appsv1.Deployment {
 			},
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: objectMetaInjectLabels(templateObjectMeta, stack.Labels),
-				Spec:       *stack.Spec.PodTemplate.Spec.DeepCopy(),
+				Spec:       *sc.podSpec(),
 			},
 		},
 	}
@@ -211,11 +224,21 @@ func (sc *StackContainer) GenerateDeployment() *appsv1.Deployment {
 	return deployment
 }
 
+// podSpec returns the spec of the pods of the stack as they are run by the
+// Deployment, with the references to the config resources rewritten and the
+// seeded resource requests.
+func (sc *StackContainer) podSpec() *v1.PodSpec {
+	podSpec := sc.Stack.Spec.PodTemplate.Spec.DeepCopy()
+	sc.rewriteConfigReferences(podSpec)
+	sc.seedContainerRequests(podSpec)
+	return podSpec
+}
+
 func (sc *StackContainer) GenerateHPA() (*autoscaling.HorizontalPodAutoscaler, error) {
 	autoscalerSpec := sc.Stack.Spec.Autoscaler
 	hpaSpec := sc.Stack.Spec.HorizontalPodAutoscaler
 
-	if autoscalerSpec == nil && hpaSpec == nil {
+	if (autoscalerSpec == nil && hpaSpec == nil) || sc.UsesKEDA() {
 		return nil, nil
 	}
 
@@ -229,7 +252,7 @@ func (sc *StackContainer) GenerateHPA() (*autoscaling.HorizontalPodAutoscaler, e
 			ScaleTargetRef: autoscaling.CrossVersionObjectReference{
 				APIVersion: apiVersionAppsV1,
 				Kind:       kindDeployment,
-				Name:       sc.Name(),
+				Name:       sc.deploymentName(),
 			},
 		},
 	}
@@ -262,13 +285,42 @@ func (sc *StackContainer) GenerateHPA() (*autoscaling.HorizontalPodAutoscaler, e
 		result.Spec.Behavior = hpaSpec.Behavior
 	}
 
+	result.Spec.MinReplicas, result.Spec.MaxReplicas = sc.autoscalerReplicas(result.Spec.MinReplicas, result.Spec.MaxReplicas)
+	return result, nil
+}
+
+// autoscalerReplicas returns the minimum and maximum replicas of the
+// autoscaler of the stack adjusted for gradual scale-down, warm standby,
+// prescaling and the traffic while it's switched.
+func (sc *StackContainer) autoscalerReplicas(minReplicas *int32, maxReplicas int32) (*int32, int32) {
+	// Don't scale up stacks which are scaled down step by step
+	if scaledownReplicas, ok := sc.gradualScaledownReplicas(); ok {
+		maxReplicas = scaledownReplicas
+		if minReplicas == nil || *minReplicas > scaledownReplicas {
+			minReplicas = &scaledownReplicas
+		}
+	}
+
+	// The replicas of the warm standby are fixed
+	if sc.IsWarmStandby() && sc.ScaledDown() {
+		replicas := sc.warmStandbyReplicas
+		minReplicas = &replicas
+		maxReplicas = replicas
+	}
+
 	// If prescaling is enabled, ensure we have at least `precalingReplicas` pods
-	if sc.prescalingActive && (result.Spec.MinReplicas == nil || *result.Spec.MinReplicas < sc.prescalingReplicas) {
+	if sc.prescalingActive && (minReplicas == nil || *minReplicas < sc.prescalingReplicas) {
 		pr := sc.prescalingReplicas
-		result.Spec.MinReplicas = &pr
+		minReplicas = &pr
 	}
 
-	return result, nil
+	// Ensure we have enough pods for the traffic while it's switched
+	if sc.trafficMinReplicas > 0 && (minReplicas == nil || *minReplicas < sc.trafficMinReplicas) {
+		tr := sc.trafficMinReplicas
+		minReplicas = &tr
+	}
+
+	return minReplicas, maxReplicas
 }
 
 func (sc *StackContainer) GenerateService() (*v1.Service, error) {
@@ -299,6 +351,46 @@ func (sc *StackContainer) GenerateService() (*v1.Service, error) {
 	}, nil
 }
 
+// GeneratePDB returns the PodDisruptionBudget of the stack. It's not
+// generated for stacks scaled down to zero, so it doesn't block node drains
+// for idle stacks.
+func (sc *StackContainer) GeneratePDB() (*policyv1.PodDisruptionBudget, error) {
+	pdbSpec := sc.Stack.Spec.PodDisruptionBudget
+	if pdbSpec == nil {
+		return nil, nil
+	}
+
+	if sc.stackReplicas == 0 || (sc.ScaledDown() && !sc.IsWarmStandby()) {
+		return nil, nil
+	}
+
+	if pdbSpec.MinAvailable != nil && pdbSpec.MaxUnavailable != nil {
+		return nil, fmt.Errorf("only one of minAvailable and maxUnavailable can be specified for the PodDisruptionBudget")
+	}
+
+	result := &policyv1.PodDisruptionBudget{
+		ObjectMeta: sc.resourceMeta(),
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: sc.selector(),
+			},
+		},
+	}
+
+	switch {
+	case pdbSpec.MinAvailable != nil:
+		minAvailable := *pdbSpec.MinAvailable
+		result.Spec.MinAvailable = &minAvailable
+	case pdbSpec.MaxUnavailable != nil:
+		maxUnavailable := *pdbSpec.MaxUnavailable
+		result.Spec.MaxUnavailable = &maxUnavailable
+	default:
+		maxUnavailable := intstr.FromInt(1)
+		result.Spec.MaxUnavailable = &maxUnavailable
+	}
+	return result, nil
+}
+
 func (sc *StackContainer) stackHostnames(spec ingressOrRouteGroupSpec, overrides *zv1.StackIngressRouteGroupOverrides) ([]string, error) {
 	result := sets.NewString()
 
@@ -453,19 +545,24 @@ func (sc *StackContainer) GenerateStackStatus() *zv1.StackStatus {
 		prescaling = zv1.PrescalingStatus{
 			Active:               sc.prescalingActive,
 			Replicas:             sc.prescalingReplicas,
+			OverscalePercent:     sc.prescalingOverscalePercent,
 			DesiredTrafficWeight: sc.prescalingDesiredTrafficWeight,
 			LastTrafficIncrease:  wrapTime(sc.prescalingLastTrafficIncrease),
 		}
 	}
 	return &zv1.StackStatus{
-		ActualTrafficWeight:  sc.actualTrafficWeight,
-		DesiredTrafficWeight: sc.desiredTrafficWeight,
-		Replicas:             sc.createdReplicas,
-		ReadyReplicas:        sc.readyReplicas,
-		UpdatedReplicas:      sc.updatedReplicas,
-		DesiredReplicas:      sc.deploymentReplicas,
-		Prescaling:           prescaling,
-		NoTrafficSince:       wrapTime(sc.noTrafficSince),
-		LabelSelector:        labels.Set(sc.selector()).String(),
+		ActualTrafficWeight:   sc.actualTrafficWeight,
+		DesiredTrafficWeight:  sc.desiredTrafficWeight,
+		Replicas:              sc.createdReplicas,
+		ReadyReplicas:         sc.readyReplicas,
+		UpdatedReplicas:       sc.updatedReplicas,
+		DesiredReplicas:       sc.deploymentReplicas,
+		Prescaling:            prescaling,
+		NoTrafficSince:        wrapTime(sc.noTrafficSince),
+		LastTrafficReplicas:   sc.lastTrafficReplicas,
+		TrafficSwitchReplicas: sc.trafficSwitchReplicas,
+		Pinned:                sc.IsPinned(),
+		LabelSelector:         labels.Set(sc.selector()).String(),
+		Conditions:            sc.conditions,
 	}
 }
@@ -9,8 +9,8 @@ import (
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	apps "k8s.io/api/apps/v1"
-	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
 	autoscaling "k8s.io/api/autoscaling/v2"
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -798,17 +798,18 @@ func TestStackGenerateService(t *testing.T) {
 
 func TestStackGenerateDeployment(t *testing.T) {
 	for _, tc := range []struct {
-		name               string
-		hpaEnabled         bool
-		stackReplicas      int32
-		minReadySeconds    int32
-		prescalingActive   bool
-		prescalingReplicas int32
-		deploymentReplicas int32
-		noTrafficSince     time.Time
-		expectedReplicas   int32
-		maxUnavailable     int
-		maxSurge           int
+		name                string
+		hpaEnabled          bool
+		stackReplicas       int32
+		minReadySeconds     int32
+		prescalingActive    bool
+		prescalingReplicas  int32
+		deploymentReplicas  int32
+		noTrafficSince      time.Time
+		warmStandbyReplicas int32
+		expectedReplicas    int32
+		maxUnavailable      int
+		maxSurge            int
 	}{
 		{
 			name:               "stack scaled down to zero, deployment still running",
@@ -842,6 +843,31 @@ func TestStackGenerateDeployment(t *testing.T) {
 			deploymentReplicas: 0,
 			expectedReplicas:   0,
 		},
+		{
+			name:                "stack doesn't have traffic, but is kept as warm standby",
+			stackReplicas:       3,
+			deploymentReplicas:  3,
+			noTrafficSince:      time.Now().Add(-time.Hour),
+			warmStandbyReplicas: 2,
+			expectedReplicas:    2,
+		},
+		{
+			name:                "stack doesn't have traffic, but is kept as warm standby, hpa enabled",
+			hpaEnabled:          true,
+			stackReplicas:       3,
+			deploymentReplicas:  5,
+			noTrafficSince:      time.Now().Add(-time.Hour),
+			warmStandbyReplicas: 2,
+			expectedReplicas:    2,
+		},
+		{
+			name:                "stack scaled down to zero, not kept as warm standby",
+			stackReplicas:       0,
+			deploymentReplicas:  3,
+			noTrafficSince:      time.Now().Add(-time.Hour),
+			warmStandbyReplicas: 2,
+			expectedReplicas:    0,
+		},
 		{
 			name:               "stack running, deployment has zero replicas",
 			stackReplicas:      3,
@@ -982,12 +1008,13 @@ func TestStackGenerateDeployment(t *testing.T) {
 						},
 					},
 				},
-				stackReplicas:      tc.stackReplicas,
-				prescalingActive:   tc.prescalingActive,
-				prescalingReplicas: tc.prescalingReplicas,
-				deploymentReplicas: tc.deploymentReplicas,
-				noTrafficSince:     tc.noTrafficSince,
-				scaledownTTL:       time.Minute,
+				stackReplicas:       tc.stackReplicas,
+				prescalingActive:    tc.prescalingActive,
+				prescalingReplicas:  tc.prescalingReplicas,
+				deploymentReplicas:  tc.deploymentReplicas,
+				noTrafficSince:      tc.noTrafficSince,
+				warmStandbyReplicas: tc.warmStandbyReplicas,
+				scaledownTTL:        time.Minute,
 			}
 			if tc.hpaEnabled {
 				c.Stack.Spec.HorizontalPodAutoscaler = &zv1.HorizontalPodAutoscaler{}
@@ -1032,6 +1059,16 @@ func TestStackGenerateDeployment(t *testing.T) {
 	}
 }
 
+func TestStackGenerateDeploymentPinned(t *testing.T) {
+	stack := testStack("foo-v1").noTrafficSince(time.Now().Add(-time.Hour)).replicas(3).pinned().stack()
+	stack.scaledownTTL = time.Minute
+	stack.deploymentReplicas = 3
+
+	require.False(t, stack.ScaledDown())
+	require.Equal(t, int32(3), *stack.GenerateDeployment().Spec.Replicas)
+	require.True(t, stack.GenerateStackStatus().Pinned)
+}
+
 func TestGenerateHPA(t *testing.T) {
 	min := int32(1)
 	max := int32(2)
@@ -1155,6 +1192,191 @@ func TestGenerateHPA(t *testing.T) {
 	}
 }
 
+func TestGenerateHPAWarmStandby(t *testing.T) {
+	min := int32(3)
+	utilization := int32(50)
+
+	container := &StackContainer{
+		Stack: &zv1.Stack{
+			ObjectMeta: testStackMeta,
+			Spec: zv1.StackSpec{
+				Autoscaler: &zv1.Autoscaler{
+					MinReplicas: &min,
+					MaxReplicas: 10,
+					Metrics: []zv1.AutoscalerMetrics{
+						{
+							Type:               zv1.CPUAutoscalerMetric,
+							AverageUtilization: &utilization,
+						},
+					},
+				},
+			},
+		},
+		noTrafficSince:      time.Now().Add(-time.Hour),
+		scaledownTTL:        time.Minute,
+		warmStandbyReplicas: 2,
+	}
+
+	hpa, err := container.GenerateHPA()
+	require.NoError(t, err)
+	require.Equal(t, int32(2), *hpa.Spec.MinReplicas)
+	require.Equal(t, int32(2), hpa.Spec.MaxReplicas)
+}
+
+func TestGenerateHPATrafficMinReplicas(t *testing.T) {
+	min := int32(3)
+	utilization := int32(50)
+
+	for _, tc := range []struct {
+		name                string
+		trafficMinReplicas  int32
+		expectedMinReplicas int32
+	}{
+		{
+			name:                "not limited by the traffic",
+			expectedMinReplicas: 3,
+		},
+		{
+			name:                "below the minimum replicas of the autoscaler",
+			trafficMinReplicas:  2,
+			expectedMinReplicas: 3,
+		},
+		{
+			name:                "above the minimum replicas of the autoscaler",
+			trafficMinReplicas:  6,
+			expectedMinReplicas: 6,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			container := &StackContainer{
+				Stack: &zv1.Stack{
+					ObjectMeta: testStackMeta,
+					Spec: zv1.StackSpec{
+						Autoscaler: &zv1.Autoscaler{
+							MinReplicas: &min,
+							MaxReplicas: 10,
+							Metrics: []zv1.AutoscalerMetrics{
+								{
+									Type:               zv1.CPUAutoscalerMetric,
+									AverageUtilization: &utilization,
+								},
+							},
+						},
+					},
+				},
+				trafficMinReplicas: tc.trafficMinReplicas,
+			}
+
+			hpa, err := container.GenerateHPA()
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedMinReplicas, *hpa.Spec.MinReplicas)
+			require.Equal(t, int32(10), hpa.Spec.MaxReplicas)
+		})
+	}
+}
+
+func TestGeneratePDB(t *testing.T) {
+	minAvailable := intstr.FromString("50%")
+	maxUnavailable := intstr.FromInt(2)
+	defaultMaxUnavailable := intstr.FromInt(1)
+
+	for _, tc := range []struct {
+		name                   string
+		pdb                    *zv1.PodDisruptionBudget
+		stackReplicas          int32
+		noTrafficSince         time.Time
+		warmStandbyReplicas    int32
+		expectedMinAvailable   *intstr.IntOrString
+		expectedMaxUnavailable *intstr.IntOrString
+		expectedNil            bool
+		expectedError          bool
+	}{
+		{
+			name:          "no pdb configured",
+			stackReplicas: 3,
+			expectedNil:   true,
+		},
+		{
+			name:                   "default pdb",
+			pdb:                    &zv1.PodDisruptionBudget{},
+			stackReplicas:          3,
+			expectedMaxUnavailable: &defaultMaxUnavailable,
+		},
+		{
+			name:                 "min available",
+			pdb:                  &zv1.PodDisruptionBudget{MinAvailable: &minAvailable},
+			stackReplicas:        3,
+			expectedMinAvailable: &minAvailable,
+		},
+		{
+			name:                   "max unavailable",
+			pdb:                    &zv1.PodDisruptionBudget{MaxUnavailable: &maxUnavailable},
+			stackReplicas:          3,
+			expectedMaxUnavailable: &maxUnavailable,
+		},
+		{
+			name:          "min available and max unavailable",
+			pdb:           &zv1.PodDisruptionBudget{MinAvailable: &minAvailable, MaxUnavailable: &maxUnavailable},
+			stackReplicas: 3,
+			expectedError: true,
+		},
+		{
+			name:        "no pdb for stacks with zero replicas",
+			pdb:         &zv1.PodDisruptionBudget{},
+			expectedNil: true,
+		},
+		{
+			name:           "no pdb for scaled down stacks",
+			pdb:            &zv1.PodDisruptionBudget{},
+			stackReplicas:  3,
+			noTrafficSince: time.Now().Add(-time.Hour),
+			expectedNil:    true,
+		},
+		{
+			name:                   "pdb for warm standby stacks",
+			pdb:                    &zv1.PodDisruptionBudget{},
+			stackReplicas:          3,
+			noTrafficSince:         time.Now().Add(-time.Hour),
+			warmStandbyReplicas:    1,
+			expectedMaxUnavailable: &defaultMaxUnavailable,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			container := &StackContainer{
+				Stack: &zv1.Stack{
+					ObjectMeta: testStackMeta,
+					Spec: zv1.StackSpec{
+						PodDisruptionBudget: tc.pdb,
+					},
+				},
+				stackReplicas:       tc.stackReplicas,
+				noTrafficSince:      tc.noTrafficSince,
+				scaledownTTL:        time.Minute,
+				warmStandbyReplicas: tc.warmStandbyReplicas,
+			}
+
+			pdb, err := container.GeneratePDB()
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tc.expectedNil {
+				require.Nil(t, pdb)
+				return
+			}
+
+			require.Equal(t, testResourceMeta, pdb.ObjectMeta)
+			require.Equal(t, map[string]string{
+				StacksetHeritageLabelKey: "foo",
+				StackVersionLabelKey:     "v1",
+			}, pdb.Spec.Selector.MatchLabels)
+			require.Equal(t, tc.expectedMinAvailable, pdb.Spec.MinAvailable)
+			require.Equal(t, tc.expectedMaxUnavailable, pdb.Spec.MaxUnavailable)
+		})
+	}
+}
+
 func TestGenerateStackStatus(t *testing.T) {
 	hourAgo := time.Now().Add(-time.Hour)
 
@@ -3,13 +3,18 @@ package core
 import (
 	"encoding/json"
 	"errors"
+	"hash/fnv"
+	"math"
 	"sort"
+	"strconv"
+	"time"
 
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	corev1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
 )
 
 const (
@@ -23,14 +28,53 @@ var (
 	errNoPaths             = errors.New("invalid ingress, no paths defined")
 	errNoStacks            = errors.New("no stacks to assign traffic to")
 	errStackServiceBackend = errors.New("additionalBackends must not reference a Stack Service")
+
+	errMissingAutoscalerMaxReplicas = errors.New("maxReplicas of the autoscaler is neither set in the stack template nor in the autoscaler defaults")
+	errConflictingAutoscalers       = errors.New("horizontalPodAutoscaler and autoscaler must not both be set in the stack template")
 )
 
-func currentStackVersion(stackset *zv1.StackSet) string {
-	version := stackset.Spec.StackTemplate.Spec.Version
+func currentStackVersion(stackset *zv1.StackSet) (string, error) {
+	template := stackset.Spec.StackTemplate.Spec
+	version := template.Version
+	if version == "" && template.HashVersion != nil {
+		hash, err := templateHash(template.StackSpec)
+		if err != nil {
+			return "", err
+		}
+		version = hash
+		if template.HashVersion.Prefix != "" {
+			version = template.HashVersion.Prefix + "-" + hash
+		}
+	}
 	if version == "" {
 		version = defaultVersion
 	}
-	return version
+	return version, nil
+}
+
+// templateHash returns a stable hash of the parts of the stack spec which
+// affect the workload. The replicas and the autoscaling configuration are
+// ignored as they don't require a new stack.
+func templateHash(spec zv1.StackSpec) (string, error) {
+	normalized := spec.DeepCopy()
+	normalized.Replicas = nil
+	normalized.HorizontalPodAutoscaler = nil
+	normalized.Autoscaler = nil
+	if normalized.Service != nil {
+		normalized.Service = sanitizeServicePorts(normalized.Service)
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := fnv.New32a()
+	_, err = hasher.Write(data)
+	if err != nil {
+		return "", err
+	}
+	return rand.SafeEncodeString(strconv.FormatUint(uint64(hasher.Sum32()), 10)), nil
 }
 
 func generateStackName(stackset *zv1.StackSet, version string) string {
@@ -51,47 +95,78 @@ func sanitizeServicePorts(service *zv1.StackServiceSpec) *zv1.StackServiceSpec {
 }
 
 // NewStack returns an (optional) stack that should be created
-func (ssc *StackSetContainer) NewStack() (*StackContainer, string) {
+func (ssc *StackSetContainer) NewStack() (*StackContainer, string, error) {
 	stackset := ssc.StackSet
 
 	observedStackVersion := stackset.Status.ObservedStackVersion
-	stackVersion := currentStackVersion(stackset)
+	stackVersion, err := currentStackVersion(stackset)
+	if err != nil {
+		return nil, "", err
+	}
 	stackName := generateStackName(stackset, stackVersion)
 	stack := ssc.stackByName(stackName)
 
 	// If the current stack doesn't exist, check that we haven't created it before. We shouldn't recreate
-	// it if it was removed for any reason.
-	if stack == nil && observedStackVersion != stackVersion {
-		newSpec := stackset.Spec.StackTemplate.Spec.StackSpec.DeepCopy()
-		if newSpec.Service != nil {
-			newSpec.Service = sanitizeServicePorts(newSpec.Service)
+	// it if it was removed for any reason, unless this was explicitly requested.
+	if stack == nil && (observedStackVersion != stackVersion || recreateStackRequested(stackset, stackVersion)) {
+		// Don't create a new stack while the resources of an existing
+		// application should be adopted as the initial stack.
+		if ssc.adoptionPending() {
+			return nil, "", nil
+		}
+
+		newSpec := ssc.stackTemplateSpec()
+		if newSpec.Autoscaler != nil && newSpec.HorizontalPodAutoscaler != nil {
+			return nil, "", errConflictingAutoscalers
+		}
+		if newSpec.Autoscaler != nil && newSpec.Autoscaler.MaxReplicas == 0 {
+			return nil, "", errMissingAutoscalerMaxReplicas
+		}
+		if err := validateKEDAMetrics(newSpec.Autoscaler); err != nil {
+			return nil, "", err
+		}
+
+		annotations := stackset.Spec.StackTemplate.Annotations
+		seedAnnotations, err := ssc.vpaSeedAnnotations(&newSpec)
+		if err != nil {
+			return nil, "", err
+		}
+		if seedAnnotations != nil {
+			annotations = mergeLabels(annotations, seedAnnotations)
 		}
 
 		return &StackContainer{
-			Stack: &zv1.Stack{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      stackName,
-					Namespace: ssc.StackSet.Namespace,
-					OwnerReferences: []metav1.OwnerReference{
-						{
-							APIVersion: stackset.APIVersion,
-							Kind:       stackset.Kind,
-							Name:       stackset.Name,
-							UID:        stackset.UID,
-						},
-					},
-					Labels: mergeLabels(
-						map[string]string{StacksetHeritageLabelKey: stackset.Name},
-						stackset.Labels,
-						map[string]string{StackVersionLabelKey: stackVersion}),
-					Annotations: stackset.Spec.StackTemplate.Annotations,
+			Stack: ssc.newStackObject(stackVersion, annotations, newSpec),
+		}, stackVersion, nil
+	}
+
+	return nil, "", nil
+}
+
+// newStackObject returns a Stack of the given version owned by the
+// StackSet.
+func (ssc *StackSetContainer) newStackObject(version string, annotations map[string]string, spec zv1.StackSpec) *zv1.Stack {
+	stackset := ssc.StackSet
+	return &zv1.Stack{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateStackName(stackset, version),
+			Namespace: stackset.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: stackset.APIVersion,
+					Kind:       stackset.Kind,
+					Name:       stackset.Name,
+					UID:        stackset.UID,
 				},
-				Spec: *newSpec,
 			},
-		}, stackVersion
+			Labels: mergeLabels(
+				map[string]string{StacksetHeritageLabelKey: stackset.Name},
+				stackset.Labels,
+				map[string]string{StackVersionLabelKey: version}),
+			Annotations: annotations,
+		},
+		Spec: spec,
 	}
-
-	return nil, ""
 }
 
 // MarkExpiredStacks marks stacks that should be deleted
@@ -101,12 +176,40 @@ func (ssc *StackSetContainer) MarkExpiredStacks() {
 		historyLimit = int(*ssc.StackSet.Spec.StackLifecycle.Limit)
 	}
 
+	var deleteAfter time.Duration
+	if ssc.StackSet.Spec.StackLifecycle.DeleteAfterSecondsWithoutTraffic != nil {
+		deleteAfter = time.Duration(*ssc.StackSet.Spec.StackLifecycle.DeleteAfterSecondsWithoutTraffic) * time.Second
+	}
+
+	var maxAge time.Duration
+	if ssc.StackSet.Spec.StackLifecycle.MaxAgeSeconds != nil {
+		maxAge = time.Duration(*ssc.StackSet.Spec.StackLifecycle.MaxAgeSeconds) * time.Second
+	}
+
 	gcCandidates := make([]*StackContainer, 0, len(ssc.StackContainers))
 
 	for _, sc := range ssc.StackContainers {
+		// Pinned stacks and the warm standby are never deleted and don't
+		// count against the limit
+		if sc.IsPinned() || sc.IsWarmStandby() {
+			continue
+		}
+
 		// Stacks are considered for cleanup if we don't have RouteGroup nor an ingress or if the stack is scaled down because of inactivity
 		hasIngress := sc.routeGroupSpec != nil || sc.ingressSpec != nil || ssc.StackSet.Spec.ExternalIngress != nil
 		if !hasIngress || sc.ScaledDown() {
+			// Stacks without traffic for too long are deleted regardless of the limit
+			if deleteAfter > 0 && hasIngress && time.Since(sc.noTrafficSince) > deleteAfter {
+				sc.PendingRemoval = true
+				sc.RemovalReason = RemovalReasonNoTraffic
+				continue
+			}
+			// Stacks older than the max age are deleted regardless of the limit
+			if maxAge > 0 && !sc.HasTraffic() && time.Since(sc.Stack.CreationTimestamp.Time) > maxAge {
+				sc.PendingRemoval = true
+				sc.RemovalReason = RemovalReasonMaxAge
+				continue
+			}
 			gcCandidates = append(gcCandidates, sc)
 		}
 	}
@@ -134,6 +237,47 @@ func (ssc *StackSetContainer) MarkExpiredStacks() {
 	excessStacks := len(gcCandidates) - historyLimit
 	for _, sc := range gcCandidates[:excessStacks] {
 		sc.PendingRemoval = true
+		sc.RemovalReason = RemovalReasonLimit
+	}
+}
+
+// updateWarmStandby selects the stack which most recently lost its traffic as
+// the warm standby and calculates the number of replicas it's
+// kept at.
+func (ssc *StackSetContainer) updateWarmStandby() {
+	var standby *StackContainer
+	var trafficReplicas int32
+	for _, sc := range ssc.StackContainers {
+		sc.warmStandbyReplicas = 0
+
+		if sc.HasTraffic() {
+			trafficReplicas += sc.deploymentReplicas
+			continue
+		}
+
+		// Only stacks which actually lost their traffic are candidates, new
+		// stacks which never got traffic and stacks which were scaled down
+		// manually are not kept around
+		if sc.noTrafficSince.IsZero() || sc.lastTrafficReplicas == 0 || sc.stackReplicas == 0 {
+			continue
+		}
+
+		if standby == nil || sc.noTrafficSince.After(standby.noTrafficSince) ||
+			(sc.noTrafficSince.Equal(standby.noTrafficSince) && standby.Stack.CreationTimestamp.Before(&sc.Stack.CreationTimestamp)) {
+			standby = sc
+		}
+	}
+
+	warmStandby := ssc.StackSet.Spec.StackLifecycle.WarmStandby
+	if warmStandby == nil || standby == nil || trafficReplicas == 0 {
+		return
+	}
+
+	switch {
+	case warmStandby.Replicas != nil:
+		standby.warmStandbyReplicas = *warmStandby.Replicas
+	case warmStandby.Percentage != nil:
+		standby.warmStandbyReplicas = int32(math.Ceil(float64(trafficReplicas) * float64(*warmStandby.Percentage) / 100))
 	}
 }
 
@@ -172,7 +316,7 @@ func (ssc *StackSetContainer) GenerateRouteGroup() (*rgv1.RouteGroup, error) {
 
 	// Generate backends
 	stacks := make(map[string]struct{}, len(ssc.StackContainers))
-	for _, sc := range ssc.StackContainers {
+	for _, sc := range ssc.trafficStackContainers() {
 		stacks[sc.Name()] = struct{}{}
 		result.Spec.Backends = append(result.Spec.Backends, rgv1.RouteGroupBackend{
 			Name:        sc.Name(),
@@ -184,7 +328,7 @@ func (ssc *StackSetContainer) GenerateRouteGroup() (*rgv1.RouteGroup, error) {
 		if sc.actualTrafficWeight > 0 {
 			result.Spec.DefaultBackends = append(result.Spec.DefaultBackends, rgv1.RouteGroupBackendReference{
 				BackendName: sc.Name(),
-				Weight:      int(sc.actualTrafficWeight),
+				Weight:      int(ssc.backendWeight(sc.actualTrafficWeight)),
 			})
 		}
 	}
@@ -257,9 +401,9 @@ func (ssc *StackSetContainer) GenerateIngress() (*networking.Ingress, error) {
 
 	actualWeights := make(map[string]float64)
 
-	for _, sc := range ssc.StackContainers {
+	for _, sc := range ssc.trafficStackContainers() {
 		if sc.actualTrafficWeight > 0 {
-			actualWeights[sc.Name()] = sc.actualTrafficWeight
+			actualWeights[sc.Name()] = ssc.backendWeight(sc.actualTrafficWeight)
 
 			rule.IngressRuleValue.HTTP.Paths = append(rule.IngressRuleValue.HTTP.Paths, networking.HTTPIngressPath{
 				Path:     stackset.Spec.Ingress.Path,
@@ -338,16 +482,29 @@ func (ssc *StackSetContainer) GenerateStackSetStatus() *zv1.StackSetStatus {
 			result.ReadyStacks += 1
 		}
 	}
+	// the traffic of the stacks of the external StackSets is part of the
+	// traffic of the StackSet, but they're not counted as its stacks
+	for _, sc := range ssc.ExternalStackContainers {
+		if sc.HasBackendPort() {
+			traffic = append(traffic, &zv1.ActualTraffic{
+				StackName:   sc.Name(),
+				ServiceName: sc.Name(),
+				ServicePort: *sc.backendPort,
+				Weight:      sc.actualTrafficWeight,
+			})
+		}
+	}
 	sort.Slice(traffic, func(i, j int) bool {
 		return traffic[i].StackName < traffic[j].StackName
 	})
 	result.Traffic = traffic
+	result.Conditions = ssc.templateDriftConditions()
 	return result
 }
 
 func (ssc *StackSetContainer) GenerateStackSetTraffic() []*zv1.DesiredTraffic {
 	var traffic []*zv1.DesiredTraffic
-	for _, sc := range ssc.StackContainers {
+	for _, sc := range ssc.trafficStackContainers() {
 		if sc.PendingRemoval {
 			continue
 		}
@@ -154,6 +154,29 @@ func TestExpiredStacks(t *testing.T) {
 			},
 			expected: nil,
 		},
+		{
+			name:    "test don't GC the warm standby",
+			limit:   1,
+			ingress: true,
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).warmStandby(2).stack(),
+				testStack("stack2").createdAt(now.Add(-2 * time.Hour)).noTrafficSince(now.Add(-2 * time.Hour)).stack(),
+				testStack("stack3").createdAt(now.Add(-3 * time.Hour)).noTrafficSince(now.Add(-3 * time.Hour)).stack(),
+			},
+			expected: map[string]bool{"stack3": true},
+		},
+		{
+			name:    "test don't GC pinned stacks and don't count them against the limit",
+			limit:   1,
+			ingress: true,
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+				testStack("stack2").createdAt(now.Add(-2 * time.Hour)).noTrafficSince(now.Add(-2 * time.Hour)).stack(),
+				testStack("stack3").createdAt(now.Add(-3 * time.Hour)).noTrafficSince(now.Add(-3 * time.Hour)).pinned().stack(),
+				testStack("stack4").createdAt(now.Add(-4 * time.Hour)).noTrafficSince(now.Add(-4 * time.Hour)).pinned().stack(),
+			},
+			expected: map[string]bool{"stack2": true},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			c := StackSetContainer{
@@ -192,6 +215,179 @@ func TestExpiredStacks(t *testing.T) {
 	}
 }
 
+func TestExpiredStacksWithoutTraffic(t *testing.T) {
+	now := time.Now()
+	limit := int32(2)
+	deleteAfter := int64(24 * 60 * 60)
+
+	c := StackSetContainer{
+		StackSet: &zv1.StackSet{
+			Spec: zv1.StackSetSpec{
+				StackLifecycle: zv1.StackLifecycle{
+					Limit:                            &limit,
+					DeleteAfterSecondsWithoutTraffic: &deleteAfter,
+				},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{},
+	}
+	for _, stack := range []*StackContainer{
+		testStack("stack1").traffic(100, 100).stack(),
+		testStack("stack2").noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+		testStack("stack3").noTrafficSince(now.Add(-2 * time.Hour)).stack(),
+		testStack("stack4").noTrafficSince(now.Add(-3 * time.Hour)).stack(),
+		testStack("stack5").noTrafficSince(now.Add(-48 * time.Hour)).stack(),
+		testStack("stack6").noTrafficSince(now.Add(-48 * time.Hour)).pinned().stack(),
+	} {
+		stack.scaledownTTL = defaultScaledownTTL
+		stack.ingressSpec = &zv1.StackSetIngressSpec{}
+		c.StackContainers[types.UID(stack.Name())] = stack
+	}
+
+	c.MarkExpiredStacks()
+
+	expected := map[string]RemovalReason{
+		"stack4": RemovalReasonLimit,
+		"stack5": RemovalReasonNoTraffic,
+	}
+	for _, stack := range c.StackContainers {
+		_, pendingRemoval := expected[stack.Name()]
+		require.Equal(t, pendingRemoval, stack.PendingRemoval, "stack %s", stack.Name())
+		require.Equal(t, expected[stack.Name()], stack.RemovalReason, "stack %s", stack.Name())
+	}
+}
+
+func TestWarmStandby(t *testing.T) {
+	now := time.Now()
+	replicas := int32(2)
+	percentage := int32(30)
+
+	for _, tc := range []struct {
+		name        string
+		warmStandby *zv1.WarmStandby
+		stacks      []*StackContainer
+		expected    map[string]int32
+	}{
+		{
+			name: "no warm standby configured",
+			stacks: []*StackContainer{
+				testStack("stack1").traffic(100, 100).deployment(true, 10, 10, 10).stack(),
+				testStack("stack2").noTrafficSince(now.Add(-1 * time.Hour)).lastTrafficReplicas(10).replicas(3).stack(),
+			},
+		},
+		{
+			name:        "stack which most recently got traffic is kept with fixed replicas",
+			warmStandby: &zv1.WarmStandby{Replicas: &replicas},
+			stacks: []*StackContainer{
+				testStack("stack1").traffic(100, 100).deployment(true, 10, 10, 10).stack(),
+				testStack("stack2").noTrafficSince(now.Add(-1 * time.Hour)).lastTrafficReplicas(10).replicas(3).stack(),
+				testStack("stack3").noTrafficSince(now.Add(-2 * time.Hour)).lastTrafficReplicas(10).replicas(3).stack(),
+			},
+			expected: map[string]int32{"stack2": 2},
+		},
+		{
+			name:        "stack is kept with a percentage of the replicas of the stacks getting traffic",
+			warmStandby: &zv1.WarmStandby{Percentage: &percentage},
+			stacks: []*StackContainer{
+				testStack("stack1").traffic(50, 50).deployment(true, 10, 10, 10).stack(),
+				testStack("stack2").traffic(50, 50).deployment(true, 5, 5, 5).stack(),
+				testStack("stack3").noTrafficSince(now.Add(-1 * time.Hour)).lastTrafficReplicas(10).replicas(3).stack(),
+			},
+			expected: map[string]int32{"stack3": 5},
+		},
+		{
+			name:        "stacks scaled down manually are not kept",
+			warmStandby: &zv1.WarmStandby{Replicas: &replicas},
+			stacks: []*StackContainer{
+				testStack("stack1").traffic(100, 100).deployment(true, 10, 10, 10).stack(),
+				testStack("stack2").noTrafficSince(now.Add(-1 * time.Hour)).lastTrafficReplicas(10).replicas(0).stack(),
+				testStack("stack3").noTrafficSince(now.Add(-2 * time.Hour)).lastTrafficReplicas(10).replicas(3).stack(),
+			},
+			expected: map[string]int32{"stack3": 2},
+		},
+		{
+			name:        "new stacks which never got traffic are not kept",
+			warmStandby: &zv1.WarmStandby{Replicas: &replicas},
+			stacks: []*StackContainer{
+				testStack("stack1").traffic(100, 100).deployment(true, 10, 10, 10).stack(),
+				testStack("stack2").noTrafficSince(now.Add(-1 * time.Hour)).lastTrafficReplicas(10).replicas(3).stack(),
+				testStack("stack3").noTrafficSince(now.Add(-1 * time.Minute)).replicas(3).stack(),
+			},
+			expected: map[string]int32{"stack2": 2},
+		},
+		{
+			name:        "no warm standby without previous stacks",
+			warmStandby: &zv1.WarmStandby{Replicas: &replicas},
+			stacks: []*StackContainer{
+				testStack("stack1").traffic(100, 100).deployment(true, 10, 10, 10).stack(),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Spec: zv1.StackSetSpec{
+						StackLifecycle: zv1.StackLifecycle{
+							WarmStandby: tc.warmStandby,
+						},
+					},
+				},
+				StackContainers: map[types.UID]*StackContainer{},
+			}
+			for _, stack := range tc.stacks {
+				c.StackContainers[types.UID(stack.Name())] = stack
+			}
+
+			c.updateWarmStandby()
+			for _, stack := range tc.stacks {
+				require.Equal(t, tc.expected[stack.Name()], stack.warmStandbyReplicas, "stack %s", stack.Name())
+				require.Equal(t, tc.expected[stack.Name()] > 0, stack.IsWarmStandby(), "stack %s", stack.Name())
+			}
+		})
+	}
+}
+
+func TestExpiredStacksMaxAge(t *testing.T) {
+	now := time.Now()
+	limit := int32(2)
+	maxAge := int64(7 * 24 * 60 * 60)
+
+	c := StackSetContainer{
+		StackSet: &zv1.StackSet{
+			Spec: zv1.StackSetSpec{
+				StackLifecycle: zv1.StackLifecycle{
+					Limit:         &limit,
+					MaxAgeSeconds: &maxAge,
+				},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{},
+	}
+	for _, stack := range []*StackContainer{
+		testStack("stack1").traffic(100, 100).createdAt(now.Add(-30 * 24 * time.Hour)).stack(),
+		testStack("stack2").noTrafficSince(now.Add(-1 * time.Hour)).createdAt(now.Add(-2 * time.Hour)).stack(),
+		testStack("stack3").noTrafficSince(now.Add(-2 * time.Hour)).createdAt(now.Add(-8 * 24 * time.Hour)).stack(),
+		testStack("stack4").noTrafficSince(now.Add(-1 * time.Minute)).createdAt(now.Add(-8 * 24 * time.Hour)).stack(),
+		testStack("stack5").noTrafficSince(now.Add(-48 * time.Hour)).createdAt(now.Add(-30 * 24 * time.Hour)).pinned().stack(),
+	} {
+		stack.scaledownTTL = defaultScaledownTTL
+		stack.ingressSpec = &zv1.StackSetIngressSpec{}
+		c.StackContainers[types.UID(stack.Name())] = stack
+	}
+
+	c.MarkExpiredStacks()
+
+	// stack4 is old, but not scaled down yet
+	expected := map[string]RemovalReason{
+		"stack3": RemovalReasonMaxAge,
+	}
+	for _, stack := range c.StackContainers {
+		_, pendingRemoval := expected[stack.Name()]
+		require.Equal(t, pendingRemoval, stack.PendingRemoval, "stack %s", stack.Name())
+		require.Equal(t, expected[stack.Name()], stack.RemovalReason, "stack %s", stack.Name())
+	}
+}
+
 func TestSanitizeServicePorts(t *testing.T) {
 	service := &zv1.StackServiceSpec{
 		Ports: []v1.ServicePort{
@@ -251,6 +447,107 @@ func TestStackSetNewStack(t *testing.T) {
 			expectedStack:     nil,
 			expectedStackName: "",
 		},
+		{
+			name: "stack is not created while adoption is pending",
+			stackset: &zv1.StackSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Annotations: map[string]string{AdoptStackAnnotationKey: "v0"},
+				},
+				Spec: zv1.StackSetSpec{
+					StackTemplate: zv1.StackTemplate{
+						Spec: zv1.StackSpecTemplate{
+							Version: "v1",
+						},
+					},
+				},
+			},
+			stacks:            map[types.UID]*StackContainer{},
+			expectedStack:     nil,
+			expectedStackName: "",
+		},
+		{
+			name: "stack is not created while a partially completed adoption is pending",
+			stackset: &zv1.StackSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Annotations: map[string]string{AdoptStackAnnotationKey: "v0"},
+				},
+				Spec: zv1.StackSetSpec{
+					StackTemplate: zv1.StackTemplate{
+						Spec: zv1.StackSpecTemplate{
+							Version: "v1",
+						},
+					},
+				},
+			},
+			stacks: map[types.UID]*StackContainer{
+				"foo-v0": testStack("foo-v0").stack(),
+			},
+			expectedStack:     nil,
+			expectedStackName: "",
+		},
+		{
+			name: "recreation of another version is ignored",
+			stackset: &zv1.StackSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Annotations: map[string]string{RecreateStackAnnotationKey: "v0"},
+				},
+				Spec: zv1.StackSetSpec{
+					StackTemplate: zv1.StackTemplate{
+						Spec: zv1.StackSpecTemplate{
+							Version: "v1",
+						},
+					},
+				},
+				Status: zv1.StackSetStatus{
+					ObservedStackVersion: "v1",
+				},
+			},
+			stacks:            map[types.UID]*StackContainer{},
+			expectedStack:     nil,
+			expectedStackName: "",
+		},
+		{
+			name: "stack already created but recreation requested",
+			stackset: &zv1.StackSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Namespace:   "bar",
+					Annotations: map[string]string{RecreateStackAnnotationKey: "v1"},
+				},
+				Spec: zv1.StackSetSpec{
+					StackTemplate: zv1.StackTemplate{
+						Spec: zv1.StackSpecTemplate{
+							Version: "v1",
+						},
+					},
+				},
+				Status: zv1.StackSetStatus{
+					ObservedStackVersion: "v1",
+				},
+			},
+			stacks: map[types.UID]*StackContainer{},
+			expectedStack: &StackContainer{
+				Stack: &zv1.Stack{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo-v1",
+						Namespace: "bar",
+						Labels: map[string]string{
+							StacksetHeritageLabelKey: "foo",
+							StackVersionLabelKey:     "v1",
+						},
+						OwnerReferences: []metav1.OwnerReference{
+							{
+								Name: "foo",
+							},
+						},
+					},
+				},
+			},
+			expectedStackName: "v1",
+		},
 		{
 			name: "stack needs to be created",
 			stackset: &zv1.StackSet{
@@ -366,13 +663,321 @@ func TestStackSetNewStack(t *testing.T) {
 				StackContainers:             tc.stacks,
 				backendWeightsAnnotationKey: traffic.DefaultBackendWeightsAnnotationKey,
 			}
-			newStack, newStackName := stackset.NewStack()
+			newStack, newStackName, err := stackset.NewStack()
+			require.NoError(t, err)
 			require.EqualValues(t, tc.expectedStack, newStack)
 			require.EqualValues(t, tc.expectedStackName, newStackName)
 		})
 	}
 }
 
+func TestNewStackConflictingAutoscalers(t *testing.T) {
+	stackset := &zv1.StackSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Spec: zv1.StackSetSpec{
+			StackTemplate: zv1.StackTemplate{
+				Spec: zv1.StackSpecTemplate{
+					StackSpec: zv1.StackSpec{
+						HorizontalPodAutoscaler: &zv1.HorizontalPodAutoscaler{MaxReplicas: 10},
+						Autoscaler:              &zv1.Autoscaler{MaxReplicas: 10},
+					},
+					Version: "v1",
+				},
+			},
+		},
+	}
+	ssc := NewContainer(stackset, SimpleTrafficReconciler{}, "", nil)
+
+	sc, _, err := ssc.NewStack()
+	require.Equal(t, errConflictingAutoscalers, err)
+	require.Nil(t, sc)
+}
+
+func TestGenerateRecreatedStackSet(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		ingress         bool
+		traffic         []*zv1.DesiredTraffic
+		deletedTraffic  string
+		stacks          map[types.UID]*StackContainer
+		expectedTraffic []*zv1.DesiredTraffic
+	}{
+		{
+			name:    "traffic is not restored without traffic management",
+			traffic: nil,
+			stacks: map[types.UID]*StackContainer{
+				"v0": testStack("foo-v0").stack(),
+			},
+			expectedTraffic: nil,
+		},
+		{
+			name:    "traffic is restored if no stack has desired traffic",
+			ingress: true,
+			traffic: []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 0}},
+			stacks: map[types.UID]*StackContainer{
+				"v0": testStack("foo-v0").stack(),
+			},
+			expectedTraffic: []*zv1.DesiredTraffic{{StackName: "foo-v1", Weight: 100}},
+		},
+		{
+			name:    "traffic of deleted stacks is ignored",
+			ingress: true,
+			traffic: []*zv1.DesiredTraffic{{StackName: "foo-v-1", Weight: 100}},
+			stacks: map[types.UID]*StackContainer{
+				"v0": testStack("foo-v0").stack(),
+			},
+			expectedTraffic: []*zv1.DesiredTraffic{{StackName: "foo-v1", Weight: 100}},
+		},
+		{
+			name:    "remaining desired traffic is kept",
+			ingress: true,
+			traffic: []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 100}},
+			stacks: map[types.UID]*StackContainer{
+				"v0": testStack("foo-v0").stack(),
+			},
+			expectedTraffic: []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 100}},
+		},
+		{
+			name:    "desired traffic of the recreated stack is kept",
+			ingress: true,
+			traffic: []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 20}, {StackName: "foo-v1", Weight: 80}},
+			stacks: map[types.UID]*StackContainer{
+				"v0": testStack("foo-v0").stack(),
+			},
+			expectedTraffic: []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 20}, {StackName: "foo-v1", Weight: 80}},
+		},
+		{
+			name:            "traffic of the deleted stack is restored",
+			ingress:         true,
+			traffic:         []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 100}},
+			deletedTraffic:  `{"foo-v1": 80}`,
+			stacks:          map[types.UID]*StackContainer{"v0": testStack("foo-v0").stack()},
+			expectedTraffic: []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 20}, {StackName: "foo-v1", Weight: 80}},
+		},
+		{
+			name:            "other stacks keep their share of the remaining traffic",
+			ingress:         true,
+			traffic:         []*zv1.DesiredTraffic{{StackName: "foo-v-1", Weight: 25}, {StackName: "foo-v0", Weight: 75}},
+			deletedTraffic:  `{"foo-v1": 60}`,
+			stacks:          map[types.UID]*StackContainer{"v-1": testStack("foo-v-1").stack(), "v0": testStack("foo-v0").stack()},
+			expectedTraffic: []*zv1.DesiredTraffic{{StackName: "foo-v-1", Weight: 10}, {StackName: "foo-v0", Weight: 30}, {StackName: "foo-v1", Weight: 60}},
+		},
+		{
+			name:            "traffic of another deleted stack is ignored",
+			ingress:         true,
+			traffic:         []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 100}},
+			deletedTraffic:  `{"foo-v-1": 80}`,
+			stacks:          map[types.UID]*StackContainer{"v0": testStack("foo-v0").stack()},
+			expectedTraffic: []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 100}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stackset := &zv1.StackSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+					Annotations: map[string]string{
+						RecreateStackAnnotationKey: "v1",
+						"custom":                   "annotation",
+					},
+				},
+				Spec: zv1.StackSetSpec{
+					Traffic: tc.traffic,
+				},
+			}
+			if tc.ingress {
+				stackset.Spec.Ingress = &zv1.StackSetIngressSpec{}
+			}
+			if tc.deletedTraffic != "" {
+				stackset.Annotations[DeletedStackTrafficAnnotationKey] = tc.deletedTraffic
+			}
+			ssc := &StackSetContainer{
+				StackSet:        stackset,
+				StackContainers: tc.stacks,
+			}
+
+			result := ssc.GenerateRecreatedStackSet("foo-v1")
+			require.Equal(t, map[string]string{"custom": "annotation"}, result.Annotations)
+			require.Equal(t, tc.expectedTraffic, result.Spec.Traffic)
+			require.Contains(t, stackset.Annotations, RecreateStackAnnotationKey)
+		})
+	}
+}
+
+func TestGenerateStackSetDesiredTraffic(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		annotations         map[string]string
+		stacks              map[types.UID]*StackContainer
+		expectedAnnotations map[string]string
+	}{
+		{
+			name: "traffic of the deleted current stack is kept",
+			stacks: map[types.UID]*StackContainer{
+				"v0": testStack("foo-v0").traffic(100, 100).stack(),
+			},
+			expectedAnnotations: map[string]string{DeletedStackTrafficAnnotationKey: `{"foo-v1":80}`},
+		},
+		{
+			name:        "kept traffic is updated from the desired traffic",
+			annotations: map[string]string{DeletedStackTrafficAnnotationKey: `{"foo-v1":50}`},
+			stacks: map[types.UID]*StackContainer{
+				"v0": testStack("foo-v0").traffic(100, 100).stack(),
+			},
+			expectedAnnotations: map[string]string{DeletedStackTrafficAnnotationKey: `{"foo-v1":80}`},
+		},
+		{
+			name:        "kept traffic is removed once the stack exists",
+			annotations: map[string]string{DeletedStackTrafficAnnotationKey: `{"foo-v1":80}`},
+			stacks: map[types.UID]*StackContainer{
+				"v0": testStack("foo-v0").traffic(20, 20).stack(),
+				"v1": testStack("foo-v1").traffic(80, 80).stack(),
+			},
+			expectedAnnotations: map[string]string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ssc := &StackSetContainer{
+				StackSet: &zv1.StackSet{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        "foo",
+						Annotations: tc.annotations,
+					},
+					Spec: zv1.StackSetSpec{
+						Ingress: &zv1.StackSetIngressSpec{},
+						Traffic: []*zv1.DesiredTraffic{{StackName: "foo-v0", Weight: 20}, {StackName: "foo-v1", Weight: 80}},
+					},
+					Status: zv1.StackSetStatus{
+						ObservedStackVersion: "v1",
+					},
+				},
+				StackContainers: tc.stacks,
+			}
+
+			result := ssc.GenerateStackSetDesiredTraffic()
+			require.Equal(t, ssc.GenerateStackSetTraffic(), result.Spec.Traffic)
+			require.Equal(t, tc.expectedAnnotations, result.Annotations)
+		})
+	}
+}
+
+func TestCheckRecreateRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		annotations   map[string]string
+		stacks        map[types.UID]*StackContainer
+		expectedError string
+	}{
+		{
+			name:   "no request",
+			stacks: map[types.UID]*StackContainer{},
+		},
+		{
+			name:        "deleted current stack",
+			annotations: map[string]string{RecreateStackAnnotationKey: "v1"},
+			stacks:      map[types.UID]*StackContainer{"v0": testStack("foo-v0").stack()},
+		},
+		{
+			name:          "existing stack",
+			annotations:   map[string]string{RecreateStackAnnotationKey: "v1"},
+			stacks:        map[types.UID]*StackContainer{"v1": testStack("foo-v1").stack()},
+			expectedError: "stack foo-v1 still exists",
+		},
+		{
+			name:          "different version",
+			annotations:   map[string]string{RecreateStackAnnotationKey: "v0"},
+			stacks:        map[types.UID]*StackContainer{},
+			expectedError: "version v0 is not the current version v1",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ssc := &StackSetContainer{
+				StackSet: &zv1.StackSet{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        "foo",
+						Annotations: tc.annotations,
+					},
+					Spec: zv1.StackSetSpec{
+						StackTemplate: zv1.StackTemplate{
+							Spec: zv1.StackSpecTemplate{Version: "v1"},
+						},
+					},
+				},
+				StackContainers: tc.stacks,
+			}
+
+			err := ssc.CheckRecreateRequest()
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestCurrentStackVersion(t *testing.T) {
+	replicas := int32(3)
+	updatedReplicas := int32(5)
+
+	template := zv1.StackSpecTemplate{
+		StackSpec: zv1.StackSpec{
+			Replicas: &replicas,
+			PodTemplate: zv1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Name:  "foo",
+							Image: "ghcr.io/zalando/skipper:latest",
+						},
+					},
+				},
+			},
+		},
+		HashVersion: &zv1.HashVersion{},
+	}
+
+	version := func(template zv1.StackSpecTemplate) string {
+		stackset := &zv1.StackSet{
+			Spec: zv1.StackSetSpec{
+				StackTemplate: zv1.StackTemplate{Spec: template},
+			},
+		}
+		version, err := currentStackVersion(stackset)
+		require.NoError(t, err)
+		return version
+	}
+
+	hashVersion := version(template)
+	require.NotEqual(t, defaultVersion, hashVersion)
+	require.Equal(t, hashVersion, version(template))
+
+	// fields which don't affect the workload are ignored
+	scaled := *template.DeepCopy()
+	scaled.Replicas = &updatedReplicas
+	scaled.Autoscaler = &zv1.Autoscaler{MaxReplicas: 10}
+	require.Equal(t, hashVersion, version(scaled))
+
+	// workload changes result in a new version
+	updated := *template.DeepCopy()
+	updated.PodTemplate.Spec.Containers[0].Image = "ghcr.io/zalando/skipper:v2"
+	require.NotEqual(t, hashVersion, version(updated))
+
+	// prefix
+	prefixed := *template.DeepCopy()
+	prefixed.HashVersion.Prefix = "release"
+	require.Equal(t, "release-"+hashVersion, version(prefixed))
+
+	// an explicit version takes precedence
+	explicit := *template.DeepCopy()
+	explicit.Version = "v1"
+	require.Equal(t, "v1", version(explicit))
+
+	// the default version is used without opting in
+	disabled := *template.DeepCopy()
+	disabled.HashVersion = nil
+	require.Equal(t, defaultVersion, version(disabled))
+}
+
 func intstrptr(value string) *intstr.IntOrString {
 	v := intstr.FromString(value)
 	return &v
@@ -1129,6 +1734,50 @@ func TestStackSetGenerateIngressNone(t *testing.T) {
 	require.Nil(t, ingress)
 }
 
+func TestStackSetGenerateBackendWeightsPrecision(t *testing.T) {
+	c := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "bar",
+			},
+			Spec: zv1.StackSetSpec{
+				Ingress: &zv1.StackSetIngressSpec{
+					Hosts:       []string{"example.org"},
+					BackendPort: intStrTestPort,
+				},
+				RouteGroup: &zv1.RouteGroupSpec{
+					Hosts:       []string{"example.org"},
+					BackendPort: int(testPort),
+				},
+				TrafficPrecision: zv1.TrafficPrecisionPerMille,
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"v1": testStack("foo-v1").traffic(99.9, 99.9).stack(),
+			"v2": testStack("foo-v2").traffic(0.1, 0.1).stack(),
+		},
+		backendWeightsAnnotationKey: traffic.DefaultBackendWeightsAnnotationKey,
+	}
+
+	ingress, err := c.GenerateIngress()
+	require.NoError(t, err)
+	require.Equal(t, `{"foo-v1":999,"foo-v2":1}`, ingress.Annotations[traffic.DefaultBackendWeightsAnnotationKey])
+
+	routegroup, err := c.GenerateRouteGroup()
+	require.NoError(t, err)
+	require.Equal(t, []rgv1.RouteGroupBackendReference{
+		{
+			BackendName: "foo-v1",
+			Weight:      999,
+		},
+		{
+			BackendName: "foo-v2",
+			Weight:      1,
+		},
+	}, routegroup.Spec.DefaultBackends)
+}
+
 func TestStackSetGenerateRouteGroup(t *testing.T) {
 	c := &StackSetContainer{
 		StackSet: &zv1.StackSet{
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// maximum number of changed fields listed in the drift description
+	templateDriftMaxFields = 5
+
+	templateDriftReasonDetected = "TemplateChanged"
+	templateDriftReasonNone     = "NoDrift"
+)
+
+// TemplateDrift describes the difference between the stack template of a
+// StackSet and the spec of the current stack.
+type TemplateDrift struct {
+	// Stack is the current stack, i.e. the stack with the version of the
+	// stack template.
+	Stack *StackContainer
+	// Fields are the paths of the fields which differ.
+	Fields []string
+
+	template zv1.StackSpec
+}
+
+// String returns a short description of the drift.
+func (d *TemplateDrift) String() string {
+	fields := d.Fields
+	suffix := ""
+	if len(fields) > templateDriftMaxFields {
+		suffix = fmt.Sprintf(" and %d more", len(fields)-templateDriftMaxFields)
+		fields = fields[:templateDriftMaxFields]
+	}
+	return fmt.Sprintf("stack %s differs from the stack template in %s%s", d.Stack.Name(), strings.Join(fields, ", "), suffix)
+}
+
+// UpdatedStack returns a copy of the current stack with the spec from the
+// stack template.
+func (d *TemplateDrift) UpdatedStack() *zv1.Stack {
+	updated := d.Stack.Stack.DeepCopy()
+	updated.Spec = *d.template.DeepCopy()
+	return updated
+}
+
+// fieldPathReporter collects the paths of the fields which differ.
+type fieldPathReporter struct {
+	path   cmp.Path
+	fields []string
+}
+
+func (r *fieldPathReporter) PushStep(ps cmp.PathStep) {
+	r.path = append(r.path, ps)
+}
+
+func (r *fieldPathReporter) Report(rs cmp.Result) {
+	if !rs.Equal() {
+		r.fields = append(r.fields, strings.TrimPrefix(r.path.GoString(), "{v1.StackSpec}"))
+	}
+}
+
+func (r *fieldPathReporter) PopStep() {
+	r.path = r.path[:len(r.path)-1]
+}
+
+// stackTemplateSpec returns the spec of the stack template as it's used for
+// new stacks.
+func (ssc *StackSetContainer) stackTemplateSpec() zv1.StackSpec {
+	spec := ssc.StackSet.Spec.StackTemplate.Spec.StackSpec.DeepCopy()
+	if spec.Service != nil {
+		spec.Service = sanitizeServicePorts(spec.Service)
+	}
+	ssc.applyAutoscalerDefaults(spec)
+	return *spec
+}
+
+// updateTemplateDrift compares the stack template with the spec of the
+// current stack.
+func (ssc *StackSetContainer) updateTemplateDrift() error {
+	ssc.templateDrift = nil
+
+	version, err := currentStackVersion(ssc.StackSet)
+	if err != nil {
+		return err
+	}
+
+	sc := ssc.stackByName(generateStackName(ssc.StackSet, version))
+	if sc == nil {
+		return nil
+	}
+
+	template := ssc.stackTemplateSpec()
+	reporter := &fieldPathReporter{}
+	cmp.Equal(template, sc.Stack.Spec, cmpopts.EquateEmpty(), cmp.Reporter(reporter))
+	if len(reporter.fields) == 0 {
+		return nil
+	}
+
+	ssc.templateDrift = &TemplateDrift{
+		Stack:    sc,
+		Fields:   reporter.fields,
+		template: template,
+	}
+	return nil
+}
+
+// TemplateDrift returns the drift between the stack template and the
+// current stack, or nil if there's none.
+func (ssc *StackSetContainer) TemplateDrift() *TemplateDrift {
+	return ssc.templateDrift
+}
+
+// TemplateDriftApplied marks the drift as resolved after the current stack
+// was updated with the spec of the stack template.
+func (ssc *StackSetContainer) TemplateDriftApplied(updated *zv1.Stack) {
+	if ssc.templateDrift == nil {
+		return
+	}
+	ssc.templateDrift.Stack.Stack = updated
+	ssc.templateDrift = nil
+}
+
+// templateDriftConditions returns the conditions of the StackSet updated
+// with the TemplateDrift condition.
+func (ssc *StackSetContainer) templateDriftConditions() []metav1.Condition {
+	var conditions []metav1.Condition
+	for _, condition := range ssc.StackSet.Status.Conditions {
+		conditions = append(conditions, *condition.DeepCopy())
+	}
+
+	condition := metav1.Condition{
+		Type:               zv1.TemplateDrift,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ssc.StackSet.Generation,
+		Reason:             templateDriftReasonNone,
+		Message:            "The current stack matches the stack template",
+	}
+	if ssc.templateDrift != nil {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = templateDriftReasonDetected
+		condition.Message = ssc.templateDrift.String()
+	}
+	meta.SetStatusCondition(&conditions, condition)
+	return conditions
+}
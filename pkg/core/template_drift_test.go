@@ -0,0 +1,110 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestTemplateDrift(t *testing.T) {
+	podTemplate := func(image string) zv1.PodTemplateSpec {
+		return zv1.PodTemplateSpec{
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{
+						Name:  "foo",
+						Image: image,
+					},
+				},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name           string
+		stackName      string
+		stackSpec      zv1.StackSpec
+		expectedFields []string
+	}{
+		{
+			name:      "no drift",
+			stackName: "foo-v1",
+			stackSpec: zv1.StackSpec{PodTemplate: podTemplate("foo:v1")},
+		},
+		{
+			name:      "empty and nil fields are equal",
+			stackName: "foo-v1",
+			stackSpec: zv1.StackSpec{
+				PodTemplate: zv1.PodTemplateSpec{
+					EmbeddedObjectMeta: zv1.EmbeddedObjectMeta{Labels: map[string]string{}},
+					Spec:               podTemplate("foo:v1").Spec,
+				},
+			},
+		},
+		{
+			name:           "changed image",
+			stackName:      "foo-v1",
+			stackSpec:      zv1.StackSpec{PodTemplate: podTemplate("foo:v0")},
+			expectedFields: []string{".PodTemplate.Spec.Containers[0].Image"},
+		},
+		{
+			name:      "older stacks are ignored",
+			stackName: "foo-v0",
+			stackSpec: zv1.StackSpec{PodTemplate: podTemplate("foo:v0")},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stack := testStack(tc.stackName).stack()
+			stack.Stack.Spec = tc.stackSpec
+
+			ssc := &StackSetContainer{
+				StackSet: &zv1.StackSet{
+					ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+					Spec: zv1.StackSetSpec{
+						StackTemplate: zv1.StackTemplate{
+							Spec: zv1.StackSpecTemplate{
+								Version: "v1",
+								StackSpec: zv1.StackSpec{
+									PodTemplate: podTemplate("foo:v1"),
+								},
+							},
+						},
+					},
+				},
+				StackContainers: map[types.UID]*StackContainer{
+					types.UID(tc.stackName): stack,
+				},
+			}
+
+			require.NoError(t, ssc.UpdateFromResources())
+
+			drift := ssc.TemplateDrift()
+			condition := meta.FindStatusCondition(ssc.GenerateStackSetStatus().Conditions, zv1.TemplateDrift)
+			require.NotNil(t, condition)
+
+			if tc.expectedFields == nil {
+				require.Nil(t, drift)
+				require.Equal(t, metav1.ConditionFalse, condition.Status)
+				return
+			}
+
+			require.NotNil(t, drift)
+			require.Equal(t, tc.expectedFields, drift.Fields)
+			require.Equal(t, metav1.ConditionTrue, condition.Status)
+			require.Equal(t, "stack foo-v1 differs from the stack template in .PodTemplate.Spec.Containers[0].Image", condition.Message)
+
+			updated := drift.UpdatedStack()
+			require.Equal(t, "foo:v1", updated.Spec.PodTemplate.Spec.Containers[0].Image)
+			require.Equal(t, "foo:v0", stack.Stack.Spec.PodTemplate.Spec.Containers[0].Image)
+
+			ssc.TemplateDriftApplied(updated)
+			require.Nil(t, ssc.TemplateDrift())
+			require.Equal(t, updated, stack.Stack)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -93,6 +94,11 @@ func (f *testStackFactory) noTrafficSince(since time.Time) *testStackFactory {
 	return f
 }
 
+func (f *testStackFactory) lastTrafficReplicas(replicas int32) *testStackFactory {
+	f.container.lastTrafficReplicas = replicas
+	return f
+}
+
 func (f *testStackFactory) pendingRemoval() *testStackFactory {
 	f.container.PendingRemoval = true
 	return f
@@ -106,6 +112,37 @@ func (f *testStackFactory) prescaling(replicas int32, desiredTrafficWeight float
 	return f
 }
 
+func (f *testStackFactory) preTrafficHook(job *batchv1.Job) *testStackFactory {
+	f.container.hooks = &zv1.StackSetHooks{
+		PreTraffic: &zv1.StackHook{},
+	}
+	f.container.Resources.PreTrafficJob = job
+	return f
+}
+
+func (f *testStackFactory) pinned() *testStackFactory {
+	f.container.Stack.Annotations = map[string]string{PinnedAnnotationKey: "true"}
+	return f
+}
+
+func (f *testStackFactory) replicas(replicas int32) *testStackFactory {
+	f.container.stackReplicas = replicas
+	return f
+}
+
+func (f *testStackFactory) warmStandby(replicas int32) *testStackFactory {
+	f.container.warmStandbyReplicas = replicas
+	return f
+}
+
+func (f *testStackFactory) readinessCheck(succeeded *bool) *testStackFactory {
+	f.container.readinessCheck = &zv1.ReadinessCheck{Path: "/health"}
+	if succeeded != nil {
+		f.container.SetReadinessCheckResult(*succeeded, "")
+	}
+	return f
+}
+
 func (f *testStackFactory) stack() *StackContainer {
 	return f.container
 }
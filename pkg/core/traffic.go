@@ -4,6 +4,8 @@ import (
 	"math"
 	"sort"
 	"time"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 )
 
 type TrafficReconciler interface {
@@ -58,8 +60,34 @@ func normalizeWeights(backendWeights map[string]float64) {
 	}
 }
 
-// roundWeights rounds all the weights to whole numbers while ensuring they
-// still add up to 100.
+// trafficUnits returns the number of units the total traffic of 100% is
+// split into at the traffic precision of the StackSet.
+func (ssc *StackSetContainer) trafficUnits() float64 {
+	switch ssc.StackSet.Spec.TrafficPrecision {
+	case zv1.TrafficPrecisionPerMille:
+		return 1000
+	case zv1.TrafficPrecisionBasisPoint:
+		return 10000
+	default:
+		return 100
+	}
+}
+
+// backendWeight returns the weight of a backend of the ingress or the
+// RouteGroup for a traffic weight in percent. With a precision finer than
+// percent the weight is given in units of that precision, so the weights of
+// all backends add up to exactly 1000 or 10000.
+func (ssc *StackSetContainer) backendWeight(weight float64) float64 {
+	units := ssc.trafficUnits()
+	if units == 100 {
+		return weight
+	}
+	return math.Round(weight * units / 100)
+}
+
+// roundWeights rounds all the weights to whole units, of which there are
+// `units` in 100%, while ensuring they still add up to 100. With 100 units
+// the weights are rounded to whole percents.
 //
 // Example:
 //
@@ -71,11 +99,15 @@ func normalizeWeights(backendWeights map[string]float64) {
 //
 //	[34, 33, 33]
 //
+// or, with 1000 units, to:
+//
+//	[33.4, 33.3, 33.3]
+//
 // The function assumes that the weights are already normalized to a sum of
 // 100.
 // It's using the "Largest Remainder Method" for rounding:
 // https://en.wikipedia.org/wiki/Largest_remainder_method
-func roundWeights(weights map[string]float64) {
+func roundWeights(weights map[string]float64, units float64) {
 	type backendWeight struct {
 		Backend string
 		Weight  float64
@@ -83,16 +115,17 @@ func roundWeights(weights map[string]float64) {
 
 	var weightList []backendWeight
 	sum := 0
-	// floor all weights of the map
+	// scale the weights to units and floor them
 	// sum the rounded weights
 	// copy weights map to a slice to sort it later
 	for backend, weight := range weights {
-		roundedWeight := math.Floor(weight)
+		scaledWeight := weight * units / 100
+		roundedWeight := math.Floor(scaledWeight)
 		weights[backend] = roundedWeight
 		sum += int(roundedWeight)
 		weightList = append(weightList, backendWeight{
 			Backend: backend,
-			Weight:  weight,
+			Weight:  scaledWeight,
 		})
 	}
 	// sort weights by:
@@ -113,10 +146,14 @@ func roundWeights(weights map[string]float64) {
 		return fi == fj && ii == ij && weightList[i].Backend < weightList[j].Backend
 	})
 	// check the remaining weight and distribute
-	diff := 100 - sum
+	diff := int(units) - sum
 	for _, backend := range weightList[:diff] {
 		weights[backend.Backend]++
 	}
+	// scale the weights back to percent
+	for backend, weight := range weights {
+		weights[backend] = weight * 100 / units
+	}
 }
 
 // ManageTraffic handles the traffic reconciler logic
@@ -135,7 +172,7 @@ func (ssc *StackSetContainer) ManageTraffic(currentTimestamp time.Time) error {
 	}
 
 	stacks := make(map[string]*StackContainer)
-	for _, stack := range ssc.StackContainers {
+	for _, stack := range ssc.trafficStackContainers() {
 		stacks[stack.Name()] = stack
 	}
 
@@ -161,7 +198,7 @@ func (ssc *StackSetContainer) ManageTraffic(currentTimestamp time.Time) error {
 			weights[fallbackStack.Name()] = 100
 		} else {
 			normalizeWeights(weights)
-			roundWeights(weights)
+			roundWeights(weights, ssc.trafficUnits())
 		}
 	}
 
@@ -176,6 +213,16 @@ func (ssc *StackSetContainer) ManageTraffic(currentTimestamp time.Time) error {
 	// weights **must** be normalised.
 	err := ssc.TrafficReconciler.Reconcile(stacks, currentTimestamp)
 
+	// Don't switch traffic to stacks which didn't pass their pre-traffic hook
+	if err == nil {
+		err = checkPreTrafficHooks(stacks, actualWeights)
+	}
+
+	// Don't increase the traffic of stacks which didn't pass their readiness check
+	if err == nil {
+		err = checkReadinessChecks(stacks, actualWeights)
+	}
+
 	// Update the actual weights from the reconciled ones
 	if err == nil {
 		actualWeights = make(map[string]float64)
@@ -196,10 +243,18 @@ func (ssc *StackSetContainer) ManageTraffic(currentTimestamp time.Time) error {
 	for _, stack := range ssc.StackContainers {
 		if stack.HasTraffic() {
 			stack.noTrafficSince = time.Time{}
+			stack.lastTrafficReplicas = 0
 		} else if stack.noTrafficSince.IsZero() {
 			stack.noTrafficSince = currentTimestamp
+			// Remember the replicas of stacks which lost their traffic
+			// for the gradual scale-down
+			if stack.currentActualTrafficWeight > 0 {
+				stack.lastTrafficReplicas = stack.deploymentReplicas
+			}
 		}
 	}
+
+	ssc.updateWarmStandby()
 	return err
 }
 
@@ -6,62 +6,90 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 )
 
 // PrescalingTrafficReconciler is a traffic reconciler that forcibly scales up the deployment
 // before switching traffic
 type PrescalingTrafficReconciler struct {
 	ResetHPAMinReplicasTimeout time.Duration
+	// ResourceQuotas of the namespace, the prescaling replicas are limited
+	// to their headroom
+	ResourceQuotas []corev1.ResourceQuota
+	// OverscalePercent is added on top of the replicas required for the
+	// desired traffic
+	OverscalePercent int32
+	// MinReplicas is the minimum number of replicas a stack is prescaled to
+	MinReplicas int32
+	// Estimator estimates the replicas needed for the traffic, defaults to
+	// ReplicaRatioEstimator
+	Estimator PrescalingEstimator
 }
 
 func (r PrescalingTrafficReconciler) Reconcile(stacks map[string]*StackContainer, currentTimestamp time.Time) error {
 	// Calculate how many replicas we need per unit of traffic
-	totalReplicas := 0.0
-	totalTraffic := 0.0
-
-	for _, stack := range stacks {
-		if stack.prescalingActive {
-			// Stack is prescaled, there are several possibilities
-			if stack.deploymentReplicas <= stack.prescalingReplicas && stack.prescalingDesiredTrafficWeight > 0 {
-				// We can't get information out of the HPA, so let's use the information captured previously
-				totalReplicas += float64(stack.prescalingReplicas)
-				totalTraffic += stack.prescalingDesiredTrafficWeight
-			} else if stack.deploymentReplicas > stack.prescalingReplicas && stack.actualTrafficWeight > 0 {
-				// Even though prescaling is active, stack is scaled up to more replicas and it has traffic,
-				// let's assume that we can get more precise replicas/traffic information this way
-				totalReplicas += float64(stack.deploymentReplicas)
-				totalTraffic += stack.actualTrafficWeight
-			}
-		} else if stack.actualTrafficWeight > 0 {
-			// Stack has traffic and is not prescaled
-			totalReplicas += float64(stack.deploymentReplicas)
-			totalTraffic += stack.actualTrafficWeight
-		}
+	estimator := r.Estimator
+	if estimator == nil {
+		estimator = ReplicaRatioEstimator{}
 	}
+	totalReplicas, totalTraffic := estimator.Estimate(stacks)
 
 	// Prescale stacks if needed
-	for _, stack := range stacks {
+	var unprescalableStacks []string
+	for stackName, stack := range stacks {
+		// Stacks of external StackSets are scaled by their own StackSet
+		if stack.external {
+			continue
+		}
+
 		// If traffic needs to be increased
 		if stack.desiredTrafficWeight > stack.actualTrafficWeight {
 			// If prescaling is not active, or desired weight changed since the last prescaling attempt, update
 			// the target replica count
 			if !stack.prescalingActive || stack.prescalingDesiredTrafficWeight < stack.desiredTrafficWeight {
-				stack.prescalingDesiredTrafficWeight = stack.desiredTrafficWeight
-
+				replicas := stack.prescalingReplicas
 				if totalTraffic != 0 {
-					stack.prescalingReplicas = int32(math.Ceil(stack.desiredTrafficWeight * totalReplicas / totalTraffic))
+					overscale := float64(100 + r.OverscalePercent)
+					replicas = int32(math.Ceil(stack.desiredTrafficWeight * totalReplicas * overscale / (totalTraffic * 100)))
 				}
 
 				// Unable to determine target scale, fallback to stack replicas
-				if stack.prescalingReplicas == 0 {
-					stack.prescalingReplicas = effectiveReplicas(stack.Stack.Spec.Replicas)
+				if replicas == 0 {
+					replicas = effectiveReplicas(stack.Stack.Spec.Replicas)
+				}
+
+				// Raise to the configured minimum
+				if replicas < r.MinReplicas {
+					replicas = r.MinReplicas
 				}
 
 				// Limit to MaxReplicas
-				if stack.prescalingReplicas > stack.MaxReplicas() {
-					stack.prescalingReplicas = stack.MaxReplicas()
+				if replicas > stack.MaxReplicas() {
+					replicas = stack.MaxReplicas()
 				}
 
+				// Limit to the headroom of the ResourceQuotas. The stack
+				// isn't prescaled if they don't even allow the minimum
+				// replicas, as it would never be ready for the traffic.
+				minReplicas := r.MinReplicas
+				if minReplicas < 1 {
+					minReplicas = 1
+				}
+				if minReplicas > replicas {
+					minReplicas = replicas
+				}
+				limited, ok := stack.limitPrescalingReplicas(r.ResourceQuotas, replicas, minReplicas)
+				if !ok {
+					unprescalableStacks = append(unprescalableStacks, stackName)
+					continue
+				}
+
+				stack.prescalingReplicas = limited
+				stack.prescalingDesiredTrafficWeight = stack.desiredTrafficWeight
+				stack.prescalingOverscalePercent = r.OverscalePercent
 			}
 
 			stack.prescalingActive = true
@@ -72,9 +100,19 @@ func (r PrescalingTrafficReconciler) Reconcile(stacks map[string]*StackContainer
 		if stack.prescalingActive && !stack.prescalingLastTrafficIncrease.IsZero() && time.Since(stack.prescalingLastTrafficIncrease) > r.ResetHPAMinReplicasTimeout {
 			stack.prescalingActive = false
 			stack.prescalingReplicas = 0
+			stack.prescalingOverscalePercent = 0
 			stack.prescalingDesiredTrafficWeight = 0
 			stack.prescalingLastTrafficIncrease = time.Time{}
 		}
+
+		if !stack.prescalingActive {
+			meta.RemoveStatusCondition(&stack.conditions, zv1.PrescalingLimited)
+		}
+	}
+
+	if len(unprescalableStacks) > 0 {
+		sort.Strings(unprescalableStacks)
+		return fmt.Errorf("stacks can't be prescaled within the ResourceQuotas: %s", strings.Join(unprescalableStacks, ", "))
 	}
 
 	// Update the traffic weights:
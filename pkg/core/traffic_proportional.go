@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProportionalTrafficReconciler is a traffic reconciler that keeps the
+// minimum replicas of the stacks proportional to their traffic while the
+// traffic is switched. Unlike the PrescalingTrafficReconciler, the minimum
+// replicas are derived again on every reconciliation, for the stacks gaining
+// traffic as well as for the ones losing it.
+type ProportionalTrafficReconciler struct{}
+
+func (ProportionalTrafficReconciler) Reconcile(stacks map[string]*StackContainer, currentTimestamp time.Time) error {
+	switching := false
+	for _, stack := range stacks {
+		if stack.desiredTrafficWeight != stack.actualTrafficWeight {
+			switching = true
+		}
+	}
+
+	// Remember the replicas of the stacks when the switch starts, the
+	// replicas raised by the minimum replicas of the switch must not raise
+	// them any further
+	for _, stack := range stacks {
+		if !switching {
+			stack.trafficSwitchReplicas = 0
+		} else if stack.trafficSwitchReplicas == 0 {
+			stack.trafficSwitchReplicas = stack.deploymentReplicas
+		}
+	}
+
+	// Calculate how many replicas we need per unit of traffic
+	totalReplicas := 0.0
+	totalTraffic := 0.0
+	for _, stack := range stacks {
+		if stack.actualTrafficWeight > 0 {
+			totalReplicas += float64(stack.trafficSwitchReplicas)
+			totalTraffic += stack.actualTrafficWeight
+		}
+	}
+
+	// While the traffic is switched, every stack needs the replicas for its
+	// desired traffic, so the stacks gaining traffic are scaled up before
+	// they get it.
+	for _, stack := range stacks {
+		stack.trafficMinReplicas = 0
+		// Stacks of external StackSets are scaled by their own StackSet and
+		// stacks without an autoscaler keep their fixed replicas
+		if !switching || totalTraffic == 0 || stack.external || !stack.IsAutoscaled() {
+			continue
+		}
+
+		replicas := int32(math.Ceil(stack.desiredTrafficWeight * totalReplicas / totalTraffic))
+		if replicas > stack.MaxReplicas() {
+			replicas = stack.MaxReplicas()
+		}
+		stack.trafficMinReplicas = replicas
+	}
+
+	// Stacks only get more traffic once they have the replicas for it
+	var nonReadyStacks []string
+	actualWeights := make(map[string]float64, len(stacks))
+	for stackName, stack := range stacks {
+		if stack.desiredTrafficWeight > stack.actualTrafficWeight {
+			if !stack.IsReady() || stack.updatedReplicas < stack.trafficMinReplicas || stack.readyReplicas < stack.trafficMinReplicas {
+				nonReadyStacks = append(nonReadyStacks, stackName)
+				continue
+			}
+		}
+
+		actualWeights[stackName] = stack.desiredTrafficWeight
+	}
+
+	if len(nonReadyStacks) > 0 {
+		sort.Strings(nonReadyStacks)
+		return fmt.Errorf("stacks not ready: %s", strings.Join(nonReadyStacks, ", "))
+	}
+
+	normalizeWeights(actualWeights)
+
+	for stackName, stack := range stacks {
+		stack.actualTrafficWeight = actualWeights[stackName]
+	}
+
+	return nil
+}
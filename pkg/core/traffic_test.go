@@ -922,6 +922,281 @@ func TestTrafficSwitchPrescaling(t *testing.T) {
 	}
 }
 
+func TestTrafficSwitchPrescalingOverscale(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		overscalePercent int32
+		minReplicas      int32
+		maxReplicas      int32
+		expectedReplicas int32
+	}{
+		{
+			name:             "no overscaling",
+			expectedReplicas: 4,
+		},
+		{
+			name:             "overscaled by a percentage",
+			overscalePercent: 20,
+			expectedReplicas: 5, // 4.8 replicas rounded up
+		},
+		{
+			name:             "raised to the minimum",
+			overscalePercent: 20,
+			minReplicas:      8,
+			expectedReplicas: 8,
+		},
+		{
+			name:             "limited to the max replicas",
+			overscalePercent: 50,
+			minReplicas:      8,
+			maxReplicas:      7,
+			expectedReplicas: 7,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			newStack := testStack("foo-v2").traffic(40, 0)
+			if tc.maxReplicas != 0 {
+				newStack = newStack.maxReplicas(tc.maxReplicas)
+			}
+			stack := newStack.stack()
+
+			c := StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Spec: zv1.StackSetSpec{
+						Ingress: &zv1.StackSetIngressSpec{},
+					},
+				},
+				StackContainers: map[types.UID]*StackContainer{
+					"foo-v1": testStack("foo-v1").traffic(60, 100).ready(10).stack(),
+					"foo-v2": stack,
+				},
+				TrafficReconciler: PrescalingTrafficReconciler{
+					ResetHPAMinReplicasTimeout: 5 * time.Minute,
+					OverscalePercent:           tc.overscalePercent,
+					MinReplicas:                tc.minReplicas,
+				},
+			}
+
+			err := c.ManageTraffic(time.Now())
+			require.Error(t, err)
+			require.True(t, stack.prescalingActive)
+			require.Equal(t, tc.expectedReplicas, stack.prescalingReplicas)
+			require.Equal(t, tc.overscalePercent, stack.prescalingOverscalePercent)
+			require.Equal(t, tc.overscalePercent, stack.GenerateStackStatus().Prescaling.OverscalePercent)
+		})
+	}
+}
+
+func TestTrafficSwitchProportional(t *testing.T) {
+	for _, tc := range []struct {
+		name                  string
+		stacks                map[types.UID]*StackContainer
+		expectedMinReplicas   map[string]int32
+		expectedActualWeights map[string]float64
+		expectedError         string
+	}{
+		{
+			name: "minimum replicas are derived from the traffic while it's switched",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(30, 60).ready(6).maxReplicas(20).stack(),
+				"foo-v2": testStack("foo-v2").traffic(10, 40).ready(4).maxReplicas(20).stack(),
+				"foo-v3": testStack("foo-v3").traffic(60, 0).ready(2).maxReplicas(20).stack(),
+			},
+			// 6+4/100 = 0.1 replicas per 1% of traffic
+			expectedMinReplicas: map[string]int32{
+				"foo-v1": 3,
+				"foo-v2": 1,
+				"foo-v3": 6,
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 60,
+				"foo-v2": 40,
+				"foo-v3": 0,
+			},
+			expectedError: "stacks not ready: foo-v3",
+		},
+		{
+			name: "traffic is switched once the stacks are scaled up",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(30, 60).ready(6).maxReplicas(20).stack(),
+				"foo-v2": testStack("foo-v2").traffic(10, 40).ready(4).maxReplicas(20).stack(),
+				"foo-v3": testStack("foo-v3").traffic(60, 0).ready(6).maxReplicas(20).stack(),
+			},
+			expectedMinReplicas: map[string]int32{
+				"foo-v1": 3,
+				"foo-v2": 1,
+				"foo-v3": 6,
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 30,
+				"foo-v2": 10,
+				"foo-v3": 60,
+			},
+		},
+		{
+			name: "minimum replicas are limited to the maximum replicas",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(0, 100).ready(10).maxReplicas(20).stack(),
+				"foo-v2": testStack("foo-v2").traffic(100, 0).ready(5).maxReplicas(5).stack(),
+			},
+			expectedMinReplicas: map[string]int32{
+				"foo-v1": 0,
+				"foo-v2": 5,
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 0,
+				"foo-v2": 100,
+			},
+		},
+		{
+			name: "minimum replicas are not limited without a switch",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(70, 70).ready(7).maxReplicas(20).stack(),
+				"foo-v2": testStack("foo-v2").traffic(30, 30).ready(3).maxReplicas(20).stack(),
+			},
+			expectedMinReplicas: map[string]int32{
+				"foo-v1": 0,
+				"foo-v2": 0,
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 70,
+				"foo-v2": 30,
+			},
+		},
+		{
+			name: "stacks without an autoscaler keep their replicas",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(0, 100).ready(10).stack(),
+				"foo-v2": testStack("foo-v2").traffic(100, 0).ready(2).stack(),
+			},
+			expectedMinReplicas: map[string]int32{
+				"foo-v1": 0,
+				"foo-v2": 0,
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 0,
+				"foo-v2": 100,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Spec: zv1.StackSetSpec{
+						Ingress: &zv1.StackSetIngressSpec{},
+					},
+				},
+				StackContainers:   tc.stacks,
+				TrafficReconciler: ProportionalTrafficReconciler{},
+			}
+
+			err := c.ManageTraffic(time.Now())
+			if tc.expectedError != "" {
+				require.Error(t, err)
+				require.Equal(t, tc.expectedError, err.Error())
+			} else {
+				require.NoError(t, err)
+			}
+
+			minReplicas := map[string]int32{}
+			actualWeights := map[string]float64{}
+			for name, stack := range c.StackContainers {
+				minReplicas[string(name)] = stack.trafficMinReplicas
+				actualWeights[string(name)] = stack.actualTrafficWeight
+			}
+			require.Equal(t, tc.expectedMinReplicas, minReplicas)
+			require.Equal(t, tc.expectedActualWeights, actualWeights)
+		})
+	}
+}
+
+func TestTrafficSwitchProportionalIterations(t *testing.T) {
+	// The HPA of foo-v1 scales it up to the minimum replicas of the switch
+	// while its pods start, the replicas added for the switch don't raise
+	// the minimum replicas any further
+	statuses := map[types.UID]*zv1.StackStatus{}
+	for i, iteration := range []struct {
+		stacks                 map[types.UID]*StackContainer
+		expectedMinReplicas    int32
+		expectedSwitchReplicas int32
+		expectedActualWeight   float64
+	}{
+		{
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(100, 50).ready(5).maxReplicas(20).stack(),
+				"foo-v2": testStack("foo-v2").traffic(0, 50).ready(5).maxReplicas(20).stack(),
+			},
+			expectedMinReplicas:    10,
+			expectedSwitchReplicas: 5,
+			expectedActualWeight:   50,
+		},
+		{
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(100, 50).partiallyReady(5, 10).maxReplicas(20).stack(),
+				"foo-v2": testStack("foo-v2").traffic(0, 50).ready(5).maxReplicas(20).stack(),
+			},
+			expectedMinReplicas:    10,
+			expectedSwitchReplicas: 5,
+			expectedActualWeight:   50,
+		},
+		{
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(100, 50).partiallyReady(8, 10).maxReplicas(20).stack(),
+				"foo-v2": testStack("foo-v2").traffic(0, 50).ready(5).maxReplicas(20).stack(),
+			},
+			expectedMinReplicas:    10,
+			expectedSwitchReplicas: 5,
+			expectedActualWeight:   50,
+		},
+		{
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(100, 50).ready(10).maxReplicas(20).stack(),
+				"foo-v2": testStack("foo-v2").traffic(0, 50).ready(5).maxReplicas(20).stack(),
+			},
+			expectedMinReplicas:    10,
+			expectedSwitchReplicas: 5,
+			expectedActualWeight:   100,
+		},
+		{
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(100, 100).ready(10).maxReplicas(20).stack(),
+				"foo-v2": testStack("foo-v2").traffic(0, 0).ready(5).maxReplicas(20).stack(),
+			},
+			expectedMinReplicas:    0,
+			expectedSwitchReplicas: 0,
+			expectedActualWeight:   100,
+		},
+	} {
+		// The replicas from the start of the switch are restored from the
+		// status written in the previous iteration
+		for name, stack := range iteration.stacks {
+			if status, ok := statuses[name]; ok {
+				stack.trafficSwitchReplicas = status.TrafficSwitchReplicas
+			}
+		}
+
+		c := StackSetContainer{
+			StackSet: &zv1.StackSet{
+				Spec: zv1.StackSetSpec{
+					Ingress: &zv1.StackSetIngressSpec{},
+				},
+			},
+			StackContainers:   iteration.stacks,
+			TrafficReconciler: ProportionalTrafficReconciler{},
+		}
+		_ = c.ManageTraffic(time.Now())
+
+		stack := iteration.stacks["foo-v1"]
+		require.Equal(t, iteration.expectedMinReplicas, stack.trafficMinReplicas, "iteration %d", i)
+		require.Equal(t, iteration.expectedSwitchReplicas, stack.trafficSwitchReplicas, "iteration %d", i)
+		require.Equal(t, iteration.expectedActualWeight, stack.actualTrafficWeight, "iteration %d", i)
+
+		for name, stack := range iteration.stacks {
+			statuses[name] = stack.GenerateStackStatus()
+		}
+	}
+}
+
 func TestTrafficSwitchNoTrafficSince(t *testing.T) {
 	for reconcilerName, reconciler := range map[string]TrafficReconciler{
 		"simple": SimpleTrafficReconciler{},
@@ -1043,8 +1318,110 @@ func TestRoundWeights(t *testing.T) {
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			roundWeights(tc.weights)
+			roundWeights(tc.weights, 100)
 			require.Equal(t, tc.expected, tc.weights)
 		})
 	}
 }
+
+func TestRoundWeightsPrecision(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		units    float64
+		weights  map[string]float64
+		expected map[string]float64
+	}{
+		{
+			name:  "per-mille",
+			units: 1000,
+			weights: map[string]float64{
+				"v1": 100.0 / 3,
+				"v2": 100.0 / 3,
+				"v3": 100.0 / 3,
+			},
+			expected: map[string]float64{
+				"v1": 33.4,
+				"v2": 33.3,
+				"v3": 33.3,
+			},
+		},
+		{
+			name:  "per-mille canary",
+			units: 1000,
+			weights: map[string]float64{
+				"v1": 99.93,
+				"v2": 0.07,
+			},
+			expected: map[string]float64{
+				"v1": 99.9,
+				"v2": 0.1,
+			},
+		},
+		{
+			name:  "basis points",
+			units: 10000,
+			weights: map[string]float64{
+				"v1": 99.987,
+				"v2": 0.013,
+			},
+			expected: map[string]float64{
+				"v1": 99.99,
+				"v2": 0.01,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			roundWeights(tc.weights, tc.units)
+			require.InDeltaMapValues(t, tc.expected, tc.weights, 1e-9)
+		})
+	}
+}
+
+func TestTrafficSwitchPrecision(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		precision       zv1.TrafficPrecision
+		expectedWeights map[string]float64
+	}{
+		{
+			name: "percent by default",
+			expectedWeights: map[string]float64{
+				"foo-v1": 100,
+				"foo-v2": 0,
+			},
+		},
+		{
+			name:      "per-mille",
+			precision: zv1.TrafficPrecisionPerMille,
+			expectedWeights: map[string]float64{
+				"foo-v1": 99.9,
+				"foo-v2": 0.1,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Spec: zv1.StackSetSpec{
+						Ingress:          &zv1.StackSetIngressSpec{},
+						TrafficPrecision: tc.precision,
+					},
+				},
+				StackContainers: map[types.UID]*StackContainer{
+					"foo-v1": testStack("foo-v1").traffic(99.9, 100).ready(3).stack(),
+					"foo-v2": testStack("foo-v2").traffic(0.1, 0).ready(3).stack(),
+				},
+				TrafficReconciler: SimpleTrafficReconciler{},
+			}
+
+			err := c.ManageTraffic(time.Now())
+			require.NoError(t, err)
+
+			actualWeights := map[string]float64{}
+			for name := range tc.expectedWeights {
+				actualWeights[name] = c.StackContainers[types.UID(name)].actualTrafficWeight
+			}
+			require.InDeltaMapValues(t, tc.expectedWeights, actualWeights, 1e-9)
+		})
+	}
+}
@@ -10,8 +10,13 @@ import (
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	autoscaling "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
@@ -20,6 +25,19 @@ const (
 	defaultVersion             = "default"
 	defaultStackLifecycleLimit = 10
 	defaultScaledownTTL        = 300 * time.Second
+
+	// PinnedAnnotationKey is the annotation used to protect a stack from
+	// garbage collection and scale-down.
+	PinnedAnnotationKey = "stackset-controller.zalando.org/pinned"
+
+	// RecreateStackAnnotationKey is the annotation used to request that the
+	// stack of the given version is recreated after it was deleted.
+	RecreateStackAnnotationKey = "stackset-controller.zalando.org/recreate-stack"
+
+	// DeletedStackTrafficAnnotationKey is the annotation used to keep the
+	// desired traffic of the deleted stack of the current version until it's
+	// recreated.
+	DeletedStackTrafficAnnotationKey = "stackset-controller.zalando.org/deleted-stack-traffic"
 )
 
 // StackSetContainer is a container for storing the full state of a StackSet
@@ -35,6 +53,11 @@ type StackSetContainer struct {
 	// including the Stack sub resources like Deployments and Services.
 	StackContainers map[types.UID]*StackContainer
 
+	// ExternalStackContainers is a set of stacks of the external StackSets
+	// which can get traffic from the StackSet. They're only used for the
+	// traffic switching and are not managed by the StackSet.
+	ExternalStackContainers map[types.UID]*StackContainer
+
 	// Ingress defines the current Ingress resource belonging to the
 	// StackSet. This is a reference to the actual resource while
 	// `StackSet.Spec.Ingress` defines the ingress configuration specified
@@ -65,8 +88,31 @@ type StackSetContainer struct {
 	// clusterDomains stores the main domain names of the cluster;
 	// per-stack ingress hostnames are not generated for names outside of them
 	clusterDomains []string
+
+	// NamespaceAutoscalerDefaults are the autoscaler defaults of the
+	// namespace of the StackSet, applied after the ones of the StackSet.
+	NamespaceAutoscalerDefaults *zv1.AutoscalerDefaults
+
+	// templateDrift is the difference between the stack template and the
+	// current stack
+	templateDrift *TemplateDrift
 }
 
+// RemovalReason describes why a stack is garbage collected.
+type RemovalReason string
+
+const (
+	// RemovalReasonLimit is used for stacks deleted because the number of
+	// stacks exceeded the history limit.
+	RemovalReasonLimit RemovalReason = "Limit"
+	// RemovalReasonNoTraffic is used for stacks deleted because they
+	// didn't get traffic for longer than configured.
+	RemovalReasonNoTraffic RemovalReason = "NoTraffic"
+	// RemovalReasonMaxAge is used for stacks deleted because they are
+	// older than configured.
+	RemovalReasonMaxAge RemovalReason = "MaxAge"
+)
+
 // StackContainer is a container for storing the full state of a Stack
 // including all the managed sub-resources. This includes the Stack resource
 // itself and all the sub resources like Deployment, HPA and Service.
@@ -77,6 +123,9 @@ type StackContainer struct {
 	// PendingRemoval is set to true if the stack should be deleted
 	PendingRemoval bool
 
+	// RemovalReason describes the rule which caused the stack to be deleted
+	RemovalReason RemovalReason
+
 	// Resources contains Kubernetes entities for the Stack's resources (Deployment, Ingress, etc)
 	Resources StackResources
 
@@ -87,6 +136,10 @@ type StackContainer struct {
 	scaledownTTL   time.Duration
 	backendPort    *intstr.IntOrString
 	clusterDomains []string
+	hooks          *zv1.StackSetHooks
+	readinessCheck *zv1.ReadinessCheck
+	scaledown      *zv1.GradualScaledown
+	monitor        *zv1.StackSetMonitor
 
 	// Fields from the stack itself, with some defaults applied
 	stackReplicas int32
@@ -113,11 +166,36 @@ type StackContainer struct {
 	actualTrafficWeight            float64
 	desiredTrafficWeight           float64
 	noTrafficSince                 time.Time
+	lastTrafficReplicas            int32
 	prescalingActive               bool
 	prescalingReplicas             int32
+	prescalingOverscalePercent     int32
 	prescalingDesiredTrafficWeight float64
 	prescalingLastTrafficIncrease  time.Time
 	minReadyPercent                float64
+
+	// Minimum number of replicas for the traffic of the stack while the
+	// traffic is switched, 0 if it's not limited
+	trafficMinReplicas int32
+
+	// Number of replicas the stack had when the traffic switch started, 0
+	// if the traffic isn't switched
+	trafficSwitchReplicas int32
+
+	// Number of replicas the stack is kept at as warm standby, 0 if the
+	// stack is not the warm standby
+	warmStandbyReplicas int32
+
+	// Conditions of the stack, updated by the reconciliation logic
+	conditions []metav1.Condition
+
+	// external is set for stacks of another StackSet which get traffic
+	// from the StackSet
+	external bool
+
+	// externalTraffic is set if the stack gets traffic from another
+	// StackSet
+	externalTraffic bool
 }
 
 // TrafficChange contains information about a traffic change event
@@ -136,7 +214,7 @@ func (sc *StackContainer) HasBackendPort() bool {
 }
 
 func (sc *StackContainer) HasTraffic() bool {
-	return sc.actualTrafficWeight > 0 || sc.desiredTrafficWeight > 0
+	return sc.actualTrafficWeight > 0 || sc.desiredTrafficWeight > 0 || sc.externalTraffic
 }
 
 func (sc *StackContainer) IsReady() bool {
@@ -164,17 +242,38 @@ func (sc *StackContainer) IsAutoscaled() bool {
 	return sc.Stack.Spec.HorizontalPodAutoscaler != nil || sc.Stack.Spec.Autoscaler != nil
 }
 
+// IsPinned returns true if the stack is protected from garbage collection
+// and scale-down.
+func (sc *StackContainer) IsPinned() bool {
+	return sc.Stack.Annotations[PinnedAnnotationKey] == "true"
+}
+
 func (sc *StackContainer) ScaledDown() bool {
-	if sc.HasTraffic() {
+	if sc.HasTraffic() || sc.IsPinned() {
 		return false
 	}
 	return !sc.noTrafficSince.IsZero() && time.Since(sc.noTrafficSince) > sc.scaledownTTL
 }
 
+// IsWarmStandby returns true if the stack is kept scaled up after it
+// stopped getting traffic.
+func (sc *StackContainer) IsWarmStandby() bool {
+	return sc.warmStandbyReplicas > 0
+}
+
 func (sc *StackContainer) Name() string {
 	return sc.Stack.Name
 }
 
+// deploymentName returns the name of the Deployment of the stack. It's the
+// name of the stack unless the stack adopted a Deployment with another name.
+func (sc *StackContainer) deploymentName() string {
+	if sc.Resources.Deployment != nil {
+		return sc.Resources.Deployment.Name
+	}
+	return sc.Name()
+}
+
 func (sc *StackContainer) Namespace() string {
 	return sc.Stack.Namespace
 }
@@ -186,6 +285,26 @@ type StackResources struct {
 	Service    *v1.Service
 	Ingress    *networking.Ingress
 	RouteGroup *rgv1.RouteGroup
+	PDB        *policyv1.PodDisruptionBudget
+
+	// PreTrafficJob and PostTrafficJob are the Jobs created for the
+	// StackSet hooks.
+	PreTrafficJob  *batchv1.Job
+	PostTrafficJob *batchv1.Job
+
+	// ConfigMaps and Secrets are the stack's copies of the ConfigMaps and
+	// Secrets defined in the stack spec.
+	ConfigMaps []*v1.ConfigMap
+	Secrets    []*v1.Secret
+
+	// Monitors are the PodMonitors and ServiceMonitors of the stack.
+	Monitors []*unstructured.Unstructured
+
+	// ScaledObject is the KEDA ScaledObject used instead of the HPA.
+	ScaledObject *unstructured.Unstructured
+
+	// VPA is the VerticalPodAutoscaler of the stack.
+	VPA *unstructured.Unstructured
 }
 
 func NewContainer(stackset *zv1.StackSet, reconciler TrafficReconciler, backendWeightsAnnotationKey string, clusterDomains []string) *StackSetContainer {
@@ -218,7 +337,7 @@ func (ssc *StackSetContainer) updateDesiredTraffic() error {
 
 	// filter stacks and normalize weights
 	stacksetNames := make(map[string]struct{})
-	for _, sc := range ssc.StackContainers {
+	for _, sc := range ssc.trafficStackContainers() {
 		stacksetNames[sc.Name()] = struct{}{}
 	}
 	for name := range weights {
@@ -232,7 +351,7 @@ func (ssc *StackSetContainer) updateDesiredTraffic() error {
 	}
 
 	// save values in stack containers
-	for _, container := range ssc.StackContainers {
+	for _, container := range ssc.trafficStackContainers() {
 		container.desiredTrafficWeight = weights[container.Name()]
 	}
 
@@ -249,7 +368,7 @@ func (ssc *StackSetContainer) updateActualTraffic() error {
 
 	// filter stacks and normalize weights
 	stacksetNames := make(map[string]struct{})
-	for _, sc := range ssc.StackContainers {
+	for _, sc := range ssc.trafficStackContainers() {
 		stacksetNames[sc.Name()] = struct{}{}
 	}
 	for name := range weights {
@@ -262,7 +381,7 @@ func (ssc *StackSetContainer) updateActualTraffic() error {
 	}
 
 	// save values in stack containers
-	for _, container := range ssc.StackContainers {
+	for _, container := range ssc.trafficStackContainers() {
 		container.actualTrafficWeight = weights[container.Name()]
 		container.currentActualTrafficWeight = weights[container.Name()]
 	}
@@ -317,9 +436,24 @@ func (ssc *StackSetContainer) UpdateFromResources() error {
 		sc.routeGroupSpec = routeGroupSpec
 		sc.scaledownTTL = scaledownTTL
 		sc.clusterDomains = ssc.clusterDomains
+		sc.hooks = ssc.StackSet.Spec.Hooks
+		sc.readinessCheck = ssc.StackSet.Spec.ReadinessCheck
+		sc.scaledown = ssc.StackSet.Spec.StackLifecycle.GradualScaledown
+		sc.monitor = ssc.StackSet.Spec.Monitor
 		sc.updateFromResources()
 	}
 
+	// the stacks of the external StackSets are served on the backend port
+	// of the StackSet
+	for _, sc := range ssc.ExternalStackContainers {
+		sc.backendPort = backendPort
+	}
+
+	err := ssc.updateTemplateDrift()
+	if err != nil {
+		return err
+	}
+
 	// only populate traffic if traffic management is enabled
 	if ingressSpec != nil || routeGroupSpec != nil || externalIngress != nil {
 		err := ssc.updateDesiredTraffic()
@@ -336,7 +470,7 @@ func (ssc *StackSetContainer) UpdateFromResources() error {
 func (ssc *StackSetContainer) TrafficChanges() []TrafficChange {
 	var result []TrafficChange
 
-	for _, sc := range ssc.StackContainers {
+	for _, sc := range ssc.trafficStackContainers() {
 		oldWeight := sc.currentActualTrafficWeight
 		newWeight := sc.actualTrafficWeight
 
@@ -389,8 +523,11 @@ func (sc *StackContainer) updateFromResources() {
 		routeGroupUpdated = sc.Resources.RouteGroup == nil
 	}
 
-	// hpa
-	if sc.IsAutoscaled() {
+	// hpa or KEDA ScaledObject
+	if sc.UsesKEDA() {
+		scaledObject := sc.Resources.ScaledObject
+		hpaUpdated = sc.Resources.HPA == nil && scaledObject != nil && IsResourceUpToDate(sc.Stack, metav1.ObjectMeta{Annotations: scaledObject.GetAnnotations()})
+	} else if sc.IsAutoscaled() {
 		hpaUpdated = sc.Resources.HPA != nil && IsResourceUpToDate(sc.Stack, sc.Resources.HPA.ObjectMeta)
 	} else {
 		hpaUpdated = sc.Resources.HPA == nil
@@ -401,9 +538,20 @@ func (sc *StackContainer) updateFromResources() {
 
 	status := sc.Stack.Status
 	sc.noTrafficSince = unwrapTime(status.NoTrafficSince)
+	sc.lastTrafficReplicas = status.LastTrafficReplicas
+	sc.trafficSwitchReplicas = status.TrafficSwitchReplicas
+	sc.conditions = nil
+	for _, condition := range status.Conditions {
+		sc.conditions = append(sc.conditions, *condition.DeepCopy())
+	}
+	sc.updateHookConditions()
+	if sc.readinessCheck == nil {
+		meta.RemoveStatusCondition(&sc.conditions, zv1.ReadinessCheckSucceeded)
+	}
 	if status.Prescaling.Active {
 		sc.prescalingActive = true
 		sc.prescalingReplicas = status.Prescaling.Replicas
+		sc.prescalingOverscalePercent = status.Prescaling.OverscalePercent
 		sc.prescalingDesiredTrafficWeight = status.Prescaling.DesiredTrafficWeight
 		sc.prescalingLastTrafficIncrease = unwrapTime(status.Prescaling.LastTrafficIncrease)
 	}
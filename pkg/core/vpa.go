@@ -0,0 +1,203 @@
+package core
+
+import (
+	"encoding/json"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// VPAAPIVersion is the API version of the VerticalPodAutoscaler.
+	VPAAPIVersion = "autoscaling.k8s.io/v1"
+	// KindVerticalPodAutoscaler is the kind of the VerticalPodAutoscaler.
+	KindVerticalPodAutoscaler = "VerticalPodAutoscaler"
+
+	// VPASeedAnnotationKey is the annotation storing the recommendation of
+	// the previous stack used to seed the stack.
+	VPASeedAnnotationKey = "stackset-controller.zalando.org/vpa-seed"
+)
+
+// vpaRecommendation returns the target resources recommended by the
+// VerticalPodAutoscaler per container.
+func vpaRecommendation(vpa *unstructured.Unstructured) map[string]v1.ResourceList {
+	containerRecommendations, _, _ := unstructured.NestedSlice(vpa.Object, "status", "recommendation", "containerRecommendations")
+
+	result := make(map[string]v1.ResourceList)
+	for _, r := range containerRecommendations {
+		recommendation, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		containerName, _, _ := unstructured.NestedString(recommendation, "containerName")
+		target, _, _ := unstructured.NestedStringMap(recommendation, "target")
+		if containerName == "" || len(target) == 0 {
+			continue
+		}
+
+		resources := make(v1.ResourceList)
+		for name, value := range target {
+			quantity, err := resource.ParseQuantity(value)
+			if err != nil {
+				continue
+			}
+			resources[v1.ResourceName(name)] = quantity
+		}
+		result[containerName] = resources
+	}
+	return result
+}
+
+// previousStackRecommendation returns the recommendation of the
+// VerticalPodAutoscaler of the most recently created stack which has one.
+func (ssc *StackSetContainer) previousStackRecommendation() map[string]v1.ResourceList {
+	var previous *StackContainer
+	var result map[string]v1.ResourceList
+	for _, sc := range ssc.StackContainers {
+		if sc.Resources.VPA == nil {
+			continue
+		}
+		if previous != nil && !previous.Stack.CreationTimestamp.Before(&sc.Stack.CreationTimestamp) {
+			continue
+		}
+		recommendation := vpaRecommendation(sc.Resources.VPA)
+		if len(recommendation) == 0 {
+			continue
+		}
+		previous = sc
+		result = recommendation
+	}
+	return result
+}
+
+// vpaSeedAnnotations returns the annotations of a new stack with the given
+// spec storing the recommendation of the previous stack, if the stack should
+// be seeded with it.
+func (ssc *StackSetContainer) vpaSeedAnnotations(spec *zv1.StackSpec) (map[string]string, error) {
+	if spec.VerticalPodAutoscaler == nil || spec.VerticalPodAutoscaler.Seed == "" {
+		return nil, nil
+	}
+
+	recommendation := ssc.previousStackRecommendation()
+	if len(recommendation) == 0 {
+		return nil, nil
+	}
+
+	seed, err := json.Marshal(recommendation)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{VPASeedAnnotationKey: string(seed)}, nil
+}
+
+// vpaSeed returns the recommendation of the previous stack the stack was
+// seeded with.
+func (sc *StackContainer) vpaSeed() map[string]v1.ResourceList {
+	seed, ok := sc.Stack.Annotations[VPASeedAnnotationKey]
+	if !ok {
+		return nil
+	}
+
+	var result map[string]v1.ResourceList
+	err := json.Unmarshal([]byte(seed), &result)
+	if err != nil {
+		return nil
+	}
+	return result
+}
+
+// seedContainerRequests sets the resource requests of the containers to the
+// recommendation of the previous stack. Requests are capped at the limits
+// of the containers.
+func (sc *StackContainer) seedContainerRequests(podSpec *v1.PodSpec) {
+	vpaSpec := sc.Stack.Spec.VerticalPodAutoscaler
+	if vpaSpec == nil || vpaSpec.Seed != zv1.VPASeedRequests {
+		return
+	}
+
+	seed := sc.vpaSeed()
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		recommendation, ok := seed[container.Name]
+		if !ok {
+			continue
+		}
+
+		if container.Resources.Requests == nil {
+			container.Resources.Requests = make(v1.ResourceList)
+		}
+		for name, quantity := range recommendation {
+			if limit, ok := container.Resources.Limits[name]; ok && quantity.Cmp(limit) > 0 {
+				quantity = limit
+			}
+			container.Resources.Requests[name] = quantity
+		}
+	}
+}
+
+// GenerateVPA returns the VerticalPodAutoscaler of the stack as an
+// unstructured resource, or nil if it's not configured.
+func (sc *StackContainer) GenerateVPA() (*unstructured.Unstructured, error) {
+	vpaSpec := sc.Stack.Spec.VerticalPodAutoscaler
+	if vpaSpec == nil {
+		return nil, nil
+	}
+
+	updateMode := vpaSpec.UpdateMode
+	if updateMode == "" {
+		updateMode = zv1.VPAUpdateModeOff
+	}
+
+	spec := map[string]interface{}{
+		"targetRef": map[string]interface{}{
+			"apiVersion": apiVersionAppsV1,
+			"kind":       kindDeployment,
+			"name":       sc.deploymentName(),
+		},
+		"updatePolicy": map[string]interface{}{
+			"updateMode": string(updateMode),
+		},
+	}
+
+	if len(vpaSpec.MinAllowed) > 0 || len(vpaSpec.MaxAllowed) > 0 {
+		containerPolicy := map[string]interface{}{
+			"containerName": "*",
+		}
+		if len(vpaSpec.MinAllowed) > 0 {
+			containerPolicy["minAllowed"] = unstructuredResourceList(vpaSpec.MinAllowed)
+		}
+		if len(vpaSpec.MaxAllowed) > 0 {
+			containerPolicy["maxAllowed"] = unstructuredResourceList(vpaSpec.MaxAllowed)
+		}
+		spec["resourcePolicy"] = map[string]interface{}{
+			"containerPolicies": []interface{}{containerPolicy},
+		}
+	}
+
+	result := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": spec,
+		},
+	}
+	result.SetAPIVersion(VPAAPIVersion)
+	result.SetKind(KindVerticalPodAutoscaler)
+
+	objectMeta := sc.resourceMeta()
+	result.SetName(objectMeta.Name)
+	result.SetNamespace(objectMeta.Namespace)
+	result.SetLabels(objectMeta.Labels)
+	result.SetAnnotations(objectMeta.Annotations)
+	result.SetOwnerReferences(objectMeta.OwnerReferences)
+
+	return result, nil
+}
+
+func unstructuredResourceList(resources v1.ResourceList) map[string]interface{} {
+	result := make(map[string]interface{}, len(resources))
+	for name, quantity := range resources {
+		result[string(name)] = quantity.String()
+	}
+	return result
+}
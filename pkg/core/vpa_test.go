@@ -0,0 +1,250 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func testVPAWithRecommendation(cpu, memory string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"status": map[string]interface{}{
+				"recommendation": map[string]interface{}{
+					"containerRecommendations": []interface{}{
+						map[string]interface{}{
+							"containerName": "app",
+							"target": map[string]interface{}{
+								"cpu":    cpu,
+								"memory": memory,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestNewStackVPASeed(t *testing.T) {
+	now := time.Now()
+
+	older := testStack("foo-v1").stack()
+	older.Stack.CreationTimestamp = metav1.NewTime(now.Add(-time.Hour))
+	older.Resources.VPA = testVPAWithRecommendation("100m", "128Mi")
+
+	newer := testStack("foo-v2").stack()
+	newer.Stack.CreationTimestamp = metav1.NewTime(now.Add(-time.Minute))
+	newer.Resources.VPA = testVPAWithRecommendation("200m", "256Mi")
+
+	withoutRecommendation := testStack("foo-v3").stack()
+	withoutRecommendation.Stack.CreationTimestamp = metav1.NewTime(now)
+	withoutRecommendation.Resources.VPA = &unstructured.Unstructured{Object: map[string]interface{}{}}
+
+	for _, tc := range []struct {
+		name                string
+		vpa                 *zv1.VerticalPodAutoscaler
+		expectedAnnotations map[string]string
+	}{
+		{
+			name:                "no vpa",
+			expectedAnnotations: nil,
+		},
+		{
+			name:                "vpa without seed",
+			vpa:                 &zv1.VerticalPodAutoscaler{},
+			expectedAnnotations: nil,
+		},
+		{
+			name: "seeded from the newest recommendation",
+			vpa: &zv1.VerticalPodAutoscaler{
+				Seed: zv1.VPASeedRequests,
+			},
+			expectedAnnotations: map[string]string{
+				VPASeedAnnotationKey: `{"app":{"cpu":"200m","memory":"256Mi"}}`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stackset := &zv1.StackSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+				Spec: zv1.StackSetSpec{
+					StackTemplate: zv1.StackTemplate{
+						Spec: zv1.StackSpecTemplate{
+							StackSpec: zv1.StackSpec{
+								VerticalPodAutoscaler: tc.vpa,
+							},
+							Version: "v4",
+						},
+					},
+				},
+			}
+			ssc := NewContainer(stackset, SimpleTrafficReconciler{}, "", nil)
+			ssc.StackContainers = map[types.UID]*StackContainer{
+				"v1": older,
+				"v2": newer,
+				"v3": withoutRecommendation,
+			}
+
+			sc, _, err := ssc.NewStack()
+			require.NoError(t, err)
+			require.NotNil(t, sc)
+			require.Equal(t, tc.expectedAnnotations, sc.Stack.Annotations)
+		})
+	}
+}
+
+func TestSeedContainerRequests(t *testing.T) {
+	stack := testStack("foo-v1").stack()
+	stack.Stack.Annotations = map[string]string{
+		VPASeedAnnotationKey: `{"app":{"cpu":"200m","memory":"256Mi"}}`,
+	}
+	stack.Stack.Spec.VerticalPodAutoscaler = &zv1.VerticalPodAutoscaler{
+		Seed: zv1.VPASeedRequests,
+	}
+	stack.Stack.Spec.PodTemplate.Spec.Containers = []v1.Container{
+		{
+			Name: "app",
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("100m"),
+					v1.ResourceMemory: resource.MustParse("128Mi"),
+				},
+				Limits: v1.ResourceList{
+					v1.ResourceMemory: resource.MustParse("200Mi"),
+				},
+			},
+		},
+		{
+			Name: "sidecar",
+		},
+	}
+
+	deployment := stack.GenerateDeployment()
+	containers := deployment.Spec.Template.Spec.Containers
+	require.Equal(t, v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("200m"),
+		v1.ResourceMemory: resource.MustParse("200Mi"),
+	}, containers[0].Resources.Requests)
+	require.Nil(t, containers[1].Resources.Requests)
+
+	// Requests are only seeded in the Requests mode
+	stack.Stack.Spec.VerticalPodAutoscaler.Seed = ""
+	deployment = stack.GenerateDeployment()
+	require.Equal(t, resource.MustParse("100m"), deployment.Spec.Template.Spec.Containers[0].Resources.Requests[v1.ResourceCPU])
+}
+
+func TestGenerateVPA(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		vpa         *zv1.VerticalPodAutoscaler
+		annotations map[string]string
+		expected    map[string]interface{}
+	}{
+		{
+			name:     "no vpa",
+			expected: nil,
+		},
+		{
+			name: "recommend only by default",
+			vpa:  &zv1.VerticalPodAutoscaler{},
+			expected: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"targetRef": map[string]interface{}{
+						"apiVersion": "apps/v1",
+						"kind":       "Deployment",
+						"name":       "foo-v1",
+					},
+					"updatePolicy": map[string]interface{}{
+						"updateMode": "Off",
+					},
+				},
+			},
+		},
+		{
+			name: "auto mode with resource policy",
+			vpa: &zv1.VerticalPodAutoscaler{
+				UpdateMode: zv1.VPAUpdateModeAuto,
+				MinAllowed: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+				MaxAllowed: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+			},
+			expected: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"targetRef": map[string]interface{}{
+						"apiVersion": "apps/v1",
+						"kind":       "Deployment",
+						"name":       "foo-v1",
+					},
+					"updatePolicy": map[string]interface{}{
+						"updateMode": "Auto",
+					},
+					"resourcePolicy": map[string]interface{}{
+						"containerPolicies": []interface{}{
+							map[string]interface{}{
+								"containerName": "*",
+								"minAllowed":    map[string]interface{}{"cpu": "100m"},
+								"maxAllowed":    map[string]interface{}{"memory": "1Gi"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "seeded stack",
+			vpa: &zv1.VerticalPodAutoscaler{
+				Seed: zv1.VPASeedRequests,
+			},
+			annotations: map[string]string{
+				VPASeedAnnotationKey: `{"app":{"cpu":"200m"}}`,
+			},
+			expected: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"targetRef": map[string]interface{}{
+						"apiVersion": "apps/v1",
+						"kind":       "Deployment",
+						"name":       "foo-v1",
+					},
+					"updatePolicy": map[string]interface{}{
+						"updateMode": "Off",
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stackMeta := *testStackMeta.DeepCopy()
+			stackMeta.Annotations = tc.annotations
+			container := &StackContainer{
+				Stack: &zv1.Stack{
+					ObjectMeta: stackMeta,
+					Spec: zv1.StackSpec{
+						VerticalPodAutoscaler: tc.vpa,
+					},
+				},
+			}
+
+			vpa, err := container.GenerateVPA()
+			require.NoError(t, err)
+			if tc.expected == nil {
+				require.Nil(t, vpa)
+				return
+			}
+
+			require.Equal(t, "autoscaling.k8s.io/v1", vpa.GetAPIVersion())
+			require.Equal(t, "VerticalPodAutoscaler", vpa.GetKind())
+			require.Equal(t, testResourceMeta.Name, vpa.GetName())
+			require.Equal(t, testResourceMeta.Labels, vpa.GetLabels())
+			require.Equal(t, testResourceMeta.OwnerReferences, vpa.GetOwnerReferences())
+			require.Equal(t, tc.expected["spec"], vpa.Object["spec"])
+			require.Equal(t, tc.expected["status"], vpa.Object["status"])
+		})
+	}
+}
@@ -155,6 +155,19 @@ func (t *Switcher) getIngressTraffic(ctx context.Context, name, namespace string
 		}
 	}
 
+	// The backend weights are given in units of the traffic precision of
+	// the StackSet, e.g. adding up to 1000 or 10000, so they are converted
+	// to percent.
+	sum := float64(0)
+	for _, weight := range actualTraffic {
+		sum += weight
+	}
+	if sum > 0 {
+		for stack, weight := range actualTraffic {
+			actualTraffic[stack] = weight / sum * 100
+		}
+	}
+
 	return desiredTraffic, actualTraffic, nil
 }
 
@@ -0,0 +1,74 @@
+package traffic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	rgfake "github.com/szuecs/routegroup-client/client/clientset/versioned/fake"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	ssfake "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/fake"
+	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testStack(name string) *zv1.Stack {
+	return &zv1.Stack{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{stacksetHeritageLabelKey: "foo"},
+		},
+	}
+}
+
+func TestTrafficWeights(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		backendWeights string
+	}{
+		{
+			name:           "percent",
+			backendWeights: `{"foo-v1": 25, "foo-v2": 75}`,
+		},
+		{
+			name:           "per mille",
+			backendWeights: `{"foo-v1": 250, "foo-v2": 750}`,
+		},
+		{
+			name:           "basis points",
+			backendWeights: `{"foo-v1": 2500, "foo-v2": 7500}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ingress := &networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+					Annotations: map[string]string{
+						StackTrafficWeightsAnnotationKey:   `{"foo-v1": 25, "foo-v2": 75}`,
+						DefaultBackendWeightsAnnotationKey: tc.backendWeights,
+					},
+				},
+			}
+			client := clientset.NewClientset(
+				fake.NewSimpleClientset(ingress),
+				ssfake.NewSimpleClientset(testStack("foo-v1"), testStack("foo-v2")),
+				rgfake.NewSimpleClientset(),
+				nil,
+			)
+
+			switcher := NewSwitcher(client, DefaultBackendWeightsAnnotationKey)
+			weights, err := switcher.TrafficWeights(context.Background(), "foo", "default")
+			require.NoError(t, err)
+
+			actual := make(map[string]float64, len(weights))
+			for _, weight := range weights {
+				actual[weight.Name] = weight.ActualWeight
+			}
+			require.Equal(t, map[string]float64{"foo-v1": 25, "foo-v2": 75}, actual)
+		})
+	}
+}